@@ -0,0 +1,164 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/approval"
+	"github.com/FindoraNetwork/refunder/config"
+	"github.com/FindoraNetwork/refunder/metrics"
+)
+
+// StatusFunc returns a json encodable snapshot of a service
+type StatusFunc func() interface{}
+
+// Server is the admin http api of the daemon
+type Server struct {
+	mux       sync.RWMutex
+	statuses  map[string]StatusFunc
+	approvers map[string]approval.Approver
+	// operators are the operator names keyed by their bearer tokens
+	operators map[string]string
+
+	handler      *http.ServeMux
+	srv          *http.Server
+	stderrlogger *log.Logger
+}
+
+// New returns an admin server, the routes are registered before Start
+func New(conf *config.Admin) *Server {
+	s := &Server{
+		statuses:     make(map[string]StatusFunc),
+		operators:    make(map[string]string, len(conf.Tokens)),
+		handler:      http.NewServeMux(),
+		stderrlogger: log.New(os.Stderr, "admin:", log.Lmsgprefix),
+	}
+	s.srv = &http.Server{
+		Addr:              conf.ListenAddress,
+		Handler:           s.handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	for name, token := range conf.Tokens {
+		s.operators[token] = name
+	}
+	s.handler.HandleFunc("/status", s.status)
+	s.handler.Handle("/metrics", metrics.Default.Handler())
+	return s
+}
+
+// Handler returns the routes of the admin api
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// HandleFunc registers an extra route of the admin api
+func (s *Server) HandleFunc(pattern string, fn http.HandlerFunc) {
+	s.handler.HandleFunc(pattern, fn)
+}
+
+// RegisterStatus adds a service snapshot into the /status output under the name
+func (s *Server) RegisterStatus(name string, fn StatusFunc) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.statuses[name] = fn
+}
+
+// Start listens on the address and serves in a forked out goroutine,
+// it refuses a non loopback address without any operator, as nobody could be authenticated on it
+func (s *Server) Start() error {
+	if len(s.operators) == 0 && !isLoopback(s.srv.Addr) {
+		return fmt.Errorf("admin listen on %q refused: a non loopback address needs the operators configured", s.srv.Addr)
+	}
+
+	ln, err := net.Listen("tcp", s.srv.Addr)
+	if err != nil {
+		return fmt.Errorf("admin listen on %q failed:%w", s.srv.Addr, err)
+	}
+
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.stderrlogger.Printf("admin serve failed:%v", err)
+		}
+	}()
+	return nil
+}
+
+// Close shuts the http server down
+func (s *Server) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := s.srv.Shutdown(ctx); err != nil {
+		s.stderrlogger.Printf("admin shutdown failed:%v", err)
+	}
+}
+
+// isLoopback reports whether the listen address only accepts the local connections
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// operator returns the operator name authenticated by the bearer token of the request
+func (s *Server) operator(r *http.Request) (string, bool) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		return "", false
+	}
+	for t, name := range s.operators {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	s.mux.RLock()
+	names := make([]string, 0, len(s.statuses))
+	for name := range s.statuses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		out[name] = s.statuses[name]()
+	}
+	s.mux.RUnlock()
+
+	WriteJSON(w, http.StatusOK, out)
+}
+
+// WriteJSON writes v as the json response body
+func WriteJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// WriteError writes err as a json response body like {"error": "..."}
+func WriteError(w http.ResponseWriter, code int, err error) {
+	WriteJSON(w, code, map[string]string{"error": err.Error()})
+}
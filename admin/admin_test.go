@@ -0,0 +1,95 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/FindoraNetwork/refunder/admin"
+	"github.com/FindoraNetwork/refunder/approval"
+	"github.com/FindoraNetwork/refunder/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Status(t *testing.T) {
+	s := admin.New(&config.Admin{ListenAddress: "127.0.0.1:0"})
+	s.RegisterStatus("giveaway", func() interface{} { return map[string]int{"gave_wei": 3} })
+
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	rep, err := http.Get(srv.URL + "/status")
+	assert.NoError(t, err)
+	defer rep.Body.Close()
+	assert.Equal(t, http.StatusOK, rep.StatusCode)
+
+	got := map[string]map[string]int{}
+	assert.NoError(t, json.NewDecoder(rep.Body).Decode(&got))
+	assert.Equal(t, 3, got["giveaway"]["gave_wei"])
+
+	rep, err = http.Post(srv.URL+"/status", "application/json", nil)
+	assert.NoError(t, err)
+	defer rep.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, rep.StatusCode)
+}
+
+type approver struct {
+	by string
+}
+
+func (a *approver) List(approval.Status) []*approval.Item { return nil }
+
+func (a *approver) Approve(id uint64, by, note string) (*approval.Item, error) {
+	a.by = by
+	return &approval.Item{ID: id, Status: approval.Approved}, nil
+}
+
+func (a *approver) Reject(id uint64, by, note string) (*approval.Item, error) {
+	a.by = by
+	return &approval.Item{ID: id, Status: approval.Rejected}, nil
+}
+
+func Test_Approvals(t *testing.T) {
+	s := admin.New(&config.Admin{ListenAddress: "127.0.0.1:0", Tokens: map[string]string{"alice": "secret"}})
+	a := &approver{}
+	s.RegisterApprover("giveaway", a)
+
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	decide := func(token, body string) int {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/approvals/approve", strings.NewReader(body))
+		assert.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rep, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer rep.Body.Close()
+		return rep.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, decide("", `{"service": "giveaway", "id": 1}`))
+	assert.Equal(t, http.StatusUnauthorized, decide("wrong", `{"service": "giveaway", "id": 1}`))
+	assert.Equal(t, "", a.by)
+
+	// the by of the body is ignored, the authenticated operator is recorded
+	assert.Equal(t, http.StatusOK, decide("secret", `{"service": "giveaway", "id": 1, "by": "mallory"}`))
+	assert.Equal(t, "alice", a.by)
+}
+
+func Test_StartLoopback(t *testing.T) {
+	s := admin.New(&config.Admin{ListenAddress: "0.0.0.0:0"})
+	assert.Error(t, s.Start(), "a non loopback address without any operator is refused")
+
+	s = admin.New(&config.Admin{ListenAddress: "127.0.0.1:0"})
+	assert.NoError(t, s.Start())
+	s.Close()
+
+	s = admin.New(&config.Admin{ListenAddress: "0.0.0.0:0", Tokens: map[string]string{"alice": "secret"}})
+	assert.NoError(t, s.Start())
+	s.Close()
+}
@@ -0,0 +1,117 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/FindoraNetwork/refunder/approval"
+)
+
+// Decision is the request body of approving or rejecting an approval item
+type Decision struct {
+	Service string `json:"service"`
+	ID      uint64 `json:"id"`
+	Note    string `json:"note"`
+}
+
+// RegisterApprover exposes the approval queue of a service under the name,
+// the decisions need the bearer token of an operator, who is recorded as the decider
+//
+//	GET  /approvals?service=<name>&status=<status>
+//	POST /approvals/approve {"service": <name>, "id": <id>, "note": <note>}
+//	POST /approvals/reject  {"service": <name>, "id": <id>, "note": <note>}
+func (s *Server) RegisterApprover(name string, a approval.Approver) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.approvers == nil {
+		s.approvers = make(map[string]approval.Approver)
+		s.handler.HandleFunc("/approvals", s.listApprovals)
+		s.handler.HandleFunc("/approvals/approve", s.decideApproval(approval.Approved))
+		s.handler.HandleFunc("/approvals/reject", s.decideApproval(approval.Rejected))
+	}
+	s.approvers[name] = a
+}
+
+func (s *Server) listApprovals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		WriteError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	service := r.URL.Query().Get("service")
+	status := approval.Status(r.URL.Query().Get("status"))
+
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	names := make([]string, 0, len(s.approvers))
+	for name := range s.approvers {
+		if service == "" || service == name {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		WriteError(w, http.StatusNotFound, fmt.Errorf("service %q not found", service))
+		return
+	}
+	sort.Strings(names)
+
+	out := make(map[string][]*approval.Item, len(names))
+	for _, name := range names {
+		out[name] = s.approvers[name].List(status)
+	}
+	WriteJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) decideApproval(status approval.Status) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			WriteError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+
+		by, ok := s.operator(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			WriteError(w, http.StatusUnauthorized, errors.New("a bearer token of an operator is a MUST for the decisions"))
+			return
+		}
+
+		d := &Decision{}
+		if err := json.NewDecoder(r.Body).Decode(d); err != nil {
+			WriteError(w, http.StatusBadRequest, fmt.Errorf("json decode failed:%w", err))
+			return
+		}
+
+		s.mux.RLock()
+		a, ok := s.approvers[d.Service]
+		s.mux.RUnlock()
+		if !ok {
+			WriteError(w, http.StatusNotFound, fmt.Errorf("service %q not found", d.Service))
+			return
+		}
+
+		var item *approval.Item
+		var err error
+		if status == approval.Approved {
+			item, err = a.Approve(d.ID, by, d.Note)
+		} else {
+			item, err = a.Reject(d.ID, by, d.Note)
+		}
+
+		switch {
+		case errors.Is(err, approval.ErrNotFound):
+			WriteError(w, http.StatusNotFound, err)
+		case errors.Is(err, approval.ErrNotPending):
+			WriteError(w, http.StatusConflict, err)
+		case err != nil:
+			WriteError(w, http.StatusInternalServerError, err)
+		default:
+			WriteJSON(w, http.StatusOK, item)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package approval
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/config"
+	"github.com/FindoraNetwork/refunder/money"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type Status string
+
+const (
+	Pending  = Status("pending")
+	Approved = Status("approved")
+	Rejected = Status("rejected")
+	Sent     = Status("sent")
+	Failed   = Status("failed")
+)
+
+// Event is an audit record of an item
+type Event struct {
+	At     time.Time   `json:"at"`
+	Status Status      `json:"status"`
+	By     string      `json:"by,omitempty"`
+	Note   string      `json:"note,omitempty"`
+	TxHash common.Hash `json:"tx_hash,omitempty"`
+}
+
+// Item is a payout held in the queue
+type Item struct {
+	ID           uint64         `json:"id"`
+	Status       Status         `json:"status"`
+	TxHash       common.Hash    `json:"tx_hash"`
+	Token        common.Address `json:"token"`
+	Recipient    common.Address `json:"recipient"`
+	Wei          *big.Int       `json:"wei"`
+	Usdt         *money.Decimal `json:"usdt,omitempty"`
+	Reasons      []string       `json:"reasons"`
+	Campaign     string         `json:"campaign,omitempty"`
+	RefundTxHash *common.Hash   `json:"refund_tx_hash,omitempty"`
+	History      []*Event       `json:"history"`
+}
+
+func (it *Item) push(status Status, by, note string, txHash common.Hash) {
+	it.Status = status
+	it.History = append(it.History, &Event{At: time.Now().UTC(), Status: status, By: by, Note: note, TxHash: txHash})
+}
+
+// UsdtFloat returns the value in USDT for the ledger, nil if it's unknown
+func (it *Item) UsdtFloat() *big.Float {
+	if it.Usdt == nil {
+		return nil
+	}
+	return it.Usdt.Float()
+}
+
+var (
+	ErrNotFound   = errors.New("approval item not found")
+	ErrNotPending = errors.New("approval item is not pending")
+)
+
+// Approver is implemented by the services which hold their payouts in a queue
+type Approver interface {
+	List(status Status) []*Item
+	Approve(id uint64, by, note string) (*Item, error)
+	Reject(id uint64, by, note string) (*Item, error)
+}
+
+type state struct {
+	NextID uint64  `json:"next_id"`
+	Items  []*Item `json:"items"`
+}
+
+// Queue is a persistent approval queue, every change is written into the file
+type Queue struct {
+	mux           sync.Mutex
+	thresholdWei  *big.Int
+	thresholdUsdt *money.Decimal
+	filepath      string
+	state         *state
+}
+
+// New returns a Queue and loads the previous items from the file
+// a nil config returns a nil Queue which holds nothing
+func New(conf *config.Approval) (*Queue, error) {
+	if conf == nil {
+		return nil, nil
+	}
+
+	if conf.QueueFilepath == "" {
+		return nil, errors.New("approval queue_filepath is a MUST filled field")
+	}
+
+	q := &Queue{
+		thresholdWei:  conf.ThresholdWei,
+		thresholdUsdt: conf.ThresholdUsdt,
+		filepath:      conf.QueueFilepath,
+		state:         &state{NextID: 1},
+	}
+
+	b, err := ioutil.ReadFile(q.filepath)
+	switch {
+	case os.IsNotExist(err):
+		// first time start up
+	case err != nil:
+		return nil, fmt.Errorf("approval read file:%q failed:%w", q.filepath, err)
+	case len(b) > 0:
+		if err := json.Unmarshal(b, q.state); err != nil {
+			return nil, fmt.Errorf("approval json unmarshal queue failed:%w", err)
+		}
+	}
+
+	return q, nil
+}
+
+// Over tells the payout is over the thresholds, usdt can be nil if the value is unknown
+func (q *Queue) Over(wei *big.Int, usdt *money.Decimal) bool {
+	if q == nil {
+		return false
+	}
+	if q.thresholdWei != nil && wei.Cmp(q.thresholdWei) > 0 {
+		return true
+	}
+	return q.thresholdUsdt != nil && usdt != nil && usdt.Cmp(q.thresholdUsdt) > 0
+}
+
+// UsdtThreshold returns the threshold in USDT, nil means the value in USDT is not needed
+func (q *Queue) UsdtThreshold() *money.Decimal {
+	if q == nil {
+		return nil
+	}
+	return q.thresholdUsdt
+}
+
+// Hold appends a pending item into the queue
+func (q *Queue) Hold(it *Item) (*Item, error) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	it.ID = q.state.NextID
+	it.push(Pending, "", "", common.Hash{})
+
+	q.state.NextID++
+	q.state.Items = append(q.state.Items, it)
+	return it, q.save()
+}
+
+// List returns the items with the status, an empty status returns all items
+func (q *Queue) List(status Status) []*Item {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	items := make([]*Item, 0, len(q.state.Items))
+	for _, it := range q.state.Items {
+		if status == "" || it.Status == status {
+			items = append(items, it)
+		}
+	}
+	return items
+}
+
+// Get returns the item by the id
+func (q *Queue) Get(id uint64) (*Item, error) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	return q.find(id)
+}
+
+func (q *Queue) find(id uint64) (*Item, error) {
+	for _, it := range q.state.Items {
+		if it.ID == id {
+			return it, nil
+		}
+	}
+	return nil, fmt.Errorf("%w, id:%d", ErrNotFound, id)
+}
+
+// Decide approves or rejects a pending item
+func (q *Queue) Decide(id uint64, status Status, by, note string) (*Item, error) {
+	if status != Approved && status != Rejected {
+		return nil, fmt.Errorf("approval cannot decide with status:%s", status)
+	}
+
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	it, err := q.find(id)
+	if err != nil {
+		return nil, err
+	}
+	if it.Status != Pending {
+		return nil, fmt.Errorf("%w, id:%d, status:%s", ErrNotPending, id, it.Status)
+	}
+
+	it.push(status, by, note, common.Hash{})
+	return it, q.save()
+}
+
+// MarkSent records the refund transaction of an approved item
+func (q *Queue) MarkSent(id uint64, txHash common.Hash) (*Item, error) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	it, err := q.find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	it.RefundTxHash = &txHash
+	it.push(Sent, "", "", txHash)
+	return it, q.save()
+}
+
+// MarkFailed records the failure of an approved item, and sets it back to pending for another try
+func (q *Queue) MarkFailed(id uint64, cause error) (*Item, error) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	it, err := q.find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	it.push(Failed, "", cause.Error(), common.Hash{})
+	it.push(Pending, "", "", common.Hash{})
+	return it, q.save()
+}
+
+// Held tells the recipient has an item of the campaign not rejected, so it's waiting for a decision or paid through the queue
+func (q *Queue) Held(campaign string, recipient common.Address) bool {
+	if q == nil {
+		return false
+	}
+
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	for _, it := range q.state.Items {
+		if it.Campaign == campaign && it.Recipient == recipient && it.Status != Rejected {
+			return true
+		}
+	}
+	return false
+}
+
+// Pending counts the pending items
+func (q *Queue) Pending() int {
+	if q == nil {
+		return 0
+	}
+	return len(q.List(Pending))
+}
+
+func (q *Queue) save() error {
+	b, err := json.Marshal(q.state)
+	if err != nil {
+		return fmt.Errorf("approval json marshal queue failed:%w", err)
+	}
+	if err := ioutil.WriteFile(q.filepath, b, 0o600); err != nil {
+		return fmt.Errorf("approval write file:%q failed:%w", q.filepath, err)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package approval_test
+
+import (
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/FindoraNetwork/refunder/approval"
+	"github.com/FindoraNetwork/refunder/config"
+	"github.com/FindoraNetwork/refunder/money"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_New(t *testing.T) {
+	q, err := approval.New(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, q)
+	assert.False(t, q.Over(big.NewInt(1), nil))
+	assert.Equal(t, 0, q.Pending())
+	assert.False(t, q.Held("", common.HexToAddress("0x1")))
+
+	_, err = approval.New(&config.Approval{})
+	assert.Error(t, err)
+}
+
+func Test_Over(t *testing.T) {
+	q, err := approval.New(&config.Approval{
+		ThresholdWei:  big.NewInt(100),
+		ThresholdUsdt: money.New(5),
+		QueueFilepath: filepath.Join(t.TempDir(), "queue.json"),
+	})
+	assert.NoError(t, err)
+
+	assert.False(t, q.Over(big.NewInt(100), nil))
+	assert.True(t, q.Over(big.NewInt(101), nil))
+	assert.False(t, q.Over(big.NewInt(1), money.New(5)))
+	over, err := money.Parse("5.000000000000000001")
+	assert.NoError(t, err)
+	assert.True(t, q.Over(big.NewInt(1), over), "the smallest value over the threshold is held")
+}
+
+func Test_Queue(t *testing.T) {
+	conf := &config.Approval{QueueFilepath: filepath.Join(t.TempDir(), "queue.json")}
+	q, err := approval.New(conf)
+	assert.NoError(t, err)
+
+	recipient := common.HexToAddress("0x1")
+	for i := 0; i < 2; i++ {
+		it, err := q.Hold(&approval.Item{Recipient: recipient, Wei: big.NewInt(10), Reasons: []string{"over_threshold"}})
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(i+1), it.ID)
+	}
+	assert.Equal(t, 2, q.Pending())
+
+	_, err = q.Decide(1, approval.Sent, "alice", "")
+	assert.Error(t, err)
+	_, err = q.Decide(3, approval.Approved, "alice", "")
+	assert.True(t, errors.Is(err, approval.ErrNotFound))
+
+	it, err := q.Decide(1, approval.Approved, "alice", "looks fine")
+	assert.NoError(t, err)
+	assert.Equal(t, approval.Approved, it.Status)
+	_, err = q.Decide(1, approval.Rejected, "bob", "")
+	assert.True(t, errors.Is(err, approval.ErrNotPending))
+
+	it, err = q.MarkFailed(1, errors.New("nonce too low"))
+	assert.NoError(t, err)
+	assert.Equal(t, approval.Pending, it.Status)
+
+	_, err = q.Decide(1, approval.Approved, "alice", "retry")
+	assert.NoError(t, err)
+	txHash := common.HexToHash("0xabc")
+	it, err = q.MarkSent(1, txHash)
+	assert.NoError(t, err)
+	assert.Equal(t, approval.Sent, it.Status)
+	assert.Equal(t, txHash, *it.RefundTxHash)
+
+	_, err = q.Decide(2, approval.Rejected, "bob", "sybil")
+	assert.NoError(t, err)
+
+	// reload from the file
+	q, err = approval.New(conf)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, q.Pending())
+	assert.Len(t, q.List(""), 2)
+	assert.Len(t, q.List(approval.Rejected), 1)
+
+	it, err = q.Get(1)
+	assert.NoError(t, err)
+	statuses := make([]approval.Status, 0, len(it.History))
+	for _, e := range it.History {
+		statuses = append(statuses, e.Status)
+	}
+	assert.Equal(t, []approval.Status{
+		approval.Pending, approval.Approved, approval.Failed, approval.Pending, approval.Approved, approval.Sent,
+	}, statuses)
+	assert.Equal(t, "alice", it.History[1].By)
+
+	it, err = q.Hold(&approval.Item{Recipient: recipient, Wei: big.NewInt(10)})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), it.ID)
+}
+
+func Test_Held(t *testing.T) {
+	q, err := approval.New(&config.Approval{QueueFilepath: filepath.Join(t.TempDir(), "queue.json")})
+	assert.NoError(t, err)
+
+	alice, bob := common.HexToAddress("0x1"), common.HexToAddress("0x2")
+	for _, recipient := range []common.Address{alice, bob} {
+		_, err := q.Hold(&approval.Item{Recipient: recipient, Wei: big.NewInt(10), Campaign: "summer"})
+		assert.NoError(t, err)
+	}
+	assert.True(t, q.Held("summer", alice))
+	assert.False(t, q.Held("", alice), "another campaign")
+
+	// the approved one is still held, it's paid through the queue
+	_, err = q.Decide(1, approval.Approved, "carol", "")
+	assert.NoError(t, err)
+	assert.True(t, q.Held("summer", alice))
+
+	// the rejected one is eligible again
+	_, err = q.Decide(2, approval.Rejected, "carol", "")
+	assert.NoError(t, err)
+	assert.False(t, q.Held("summer", bob))
+}
@@ -0,0 +1,261 @@
+package balance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/client"
+	"github.com/FindoraNetwork/refunder/config"
+	"github.com/FindoraNetwork/refunder/metrics"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ErrPaused stops the payouts while the balance is below the reserve floor
+var ErrPaused = errors.New("payouts paused, the founding balance is below the reserve floor")
+
+type Level string
+
+const (
+	OK       = Level("ok")
+	Warning  = Level("warning")
+	Critical = Level("critical")
+)
+
+var (
+	balanceGauge = metrics.Default.Gauge("refunder_funding_balance_wei", "the balance of the founding source in wei", "service", "address")
+	levelGauge   = metrics.Default.Gauge("refunder_funding_level", "the founding balance level, 0 ok, 1 warning, 2 critical", "service")
+	pausedGauge  = metrics.Default.Gauge("refunder_payouts_paused", "1 if the payouts are paused below the reserve floor", "service")
+)
+
+// Alert is raised once the level or the pause changes
+type Alert struct {
+	Service    string         `json:"service"`
+	Address    common.Address `json:"address"`
+	BalanceWei *big.Int       `json:"balance_wei"`
+	Previous   Level          `json:"previous"`
+	Level      Level          `json:"level"`
+	Paused     bool           `json:"paused"`
+}
+
+func (a *Alert) String() string {
+	return fmt.Sprintf("service:%s, address:%s, balance_wei:%s, level:%s -> %s, paused:%v", a.Service, a.Address, a.BalanceWei, a.Previous, a.Level, a.Paused)
+}
+
+// Status is the snapshot of the founding balance
+type Status struct {
+	Address         common.Address `json:"address"`
+	BalanceWei      *big.Int       `json:"balance_wei"`
+	Level           Level          `json:"level"`
+	Paused          bool           `json:"paused"`
+	ReserveFloorWei *big.Int       `json:"reserve_floor_wei,omitempty"`
+	CheckedAt       time.Time      `json:"checked_at"`
+	Error           string         `json:"error,omitempty"`
+}
+
+// Monitor checks the balance of a founding source periodically
+type Monitor struct {
+	service  string
+	address  common.Address
+	client   client.Client
+	interval time.Duration
+	timeout  time.Duration
+
+	warningWei      *big.Int
+	criticalWei     *big.Int
+	reserveFloorWei *big.Int
+
+	mux     sync.RWMutex
+	status  *Status
+	onAlert []func(*Alert)
+
+	stdoutlogger *log.Logger
+	stderrlogger *log.Logger
+	done         chan struct{}
+}
+
+// New returns a Monitor of the address, a nil config returns a nil Monitor which never pauses
+func New(service string, c client.Client, address common.Address, conf *config.BalanceMonitor) *Monitor {
+	if conf == nil {
+		return nil
+	}
+
+	m := &Monitor{
+		service:         service,
+		address:         address,
+		client:          c,
+		interval:        time.Minute,
+		timeout:         10 * time.Second,
+		warningWei:      conf.WarningWei,
+		criticalWei:     conf.CriticalWei,
+		reserveFloorWei: conf.ReserveFloorWei,
+		status:          &Status{Address: address, Level: OK, ReserveFloorWei: conf.ReserveFloorWei},
+		stdoutlogger:    log.New(os.Stdout, service+"Balance:", log.Lmsgprefix),
+		stderrlogger:    log.New(os.Stderr, service+"Balance:", log.Lmsgprefix),
+		done:            make(chan struct{}),
+	}
+	if conf.IntervalSec > 0 {
+		m.interval = time.Duration(conf.IntervalSec) * time.Second
+	}
+	if conf.TimeoutSec > 0 {
+		m.timeout = time.Duration(conf.TimeoutSec) * time.Second
+	}
+	return m
+}
+
+// OnAlert adds a callback of the alerts, the alerts are logged into stderr without any callback
+func (m *Monitor) OnAlert(fn func(*Alert)) {
+	if m == nil {
+		return
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.onAlert = append(m.onAlert, fn)
+}
+
+// Start checks the balance once, then forks out a goroutine checking periodically
+func (m *Monitor) Start() {
+	if m == nil {
+		return
+	}
+
+	if err := m.Check(); err != nil {
+		m.stderrlogger.Println(err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.done:
+				return
+			case <-ticker.C:
+				if err := m.Check(); err != nil {
+					m.stderrlogger.Println(err)
+				}
+			}
+		}
+	}()
+}
+
+// Close stops the fork out goroutine from Start method
+func (m *Monitor) Close() {
+	if m == nil {
+		return
+	}
+	close(m.done)
+}
+
+func (m *Monitor) level(balance *big.Int) Level {
+	switch {
+	case m.criticalWei != nil && balance.Cmp(m.criticalWei) < 0:
+		return Critical
+	case m.warningWei != nil && balance.Cmp(m.warningWei) < 0:
+		return Warning
+	default:
+		return OK
+	}
+}
+
+// Check fetches the latest balance, updates the metrics and the pause, and raises an alert on any change
+func (m *Monitor) Check() error {
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	balance, err := m.balanceAt(ctx)
+
+	m.mux.Lock()
+	if err != nil {
+		m.status.Error = err.Error()
+		m.status.CheckedAt = time.Now().UTC()
+		m.mux.Unlock()
+		return err
+	}
+
+	prev := *m.status
+	st := &Status{
+		Address:         m.address,
+		BalanceWei:      balance,
+		Level:           m.level(balance),
+		Paused:          m.reserveFloorWei != nil && balance.Cmp(m.reserveFloorWei) < 0,
+		ReserveFloorWei: m.reserveFloorWei,
+		CheckedAt:       time.Now().UTC(),
+	}
+	m.status = st
+	callbacks := m.onAlert
+	m.mux.Unlock()
+
+	fbalance, _ := new(big.Float).SetInt(balance).Float64()
+	balanceGauge.Set(fbalance, m.service, m.address.String())
+	levelGauge.Set(map[Level]float64{OK: 0, Warning: 1, Critical: 2}[st.Level], m.service)
+	paused := 0.0
+	if st.Paused {
+		paused = 1
+	}
+	pausedGauge.Set(paused, m.service)
+
+	if st.Level == prev.Level && st.Paused == prev.Paused {
+		return nil
+	}
+
+	alert := &Alert{
+		Service:    m.service,
+		Address:    m.address,
+		BalanceWei: balance,
+		Previous:   prev.Level,
+		Level:      st.Level,
+		Paused:     st.Paused,
+	}
+	if st.Level == OK && !st.Paused {
+		m.stdoutlogger.Printf("balance recovered, %s", alert)
+	} else {
+		m.stderrlogger.Printf("balance alert, %s", alert)
+	}
+	for _, fn := range callbacks {
+		fn(alert)
+	}
+
+	return nil
+}
+
+func (m *Monitor) balanceAt(ctx context.Context) (*big.Int, error) {
+	c, err := m.client.DialRPC()
+	if err != nil {
+		return nil, fmt.Errorf("balance client.DialRPC failed:%w", err)
+	}
+	defer c.Close()
+
+	balance, err := c.BalanceAt(ctx, m.address, nil)
+	if err != nil {
+		return nil, fmt.Errorf("balance BalanceAt failed:%w, address:%s", err, m.address)
+	}
+	return balance, nil
+}
+
+// Paused tells the payouts should be paused
+func (m *Monitor) Paused() bool {
+	if m == nil {
+		return false
+	}
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	return m.status.Paused
+}
+
+// Status returns the snapshot of the last check
+func (m *Monitor) Status() *Status {
+	if m == nil {
+		return nil
+	}
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	st := *m.status
+	return &st
+}
@@ -0,0 +1,74 @@
+package balance_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/FindoraNetwork/refunder/balance"
+	"github.com/FindoraNetwork/refunder/client"
+	"github.com/FindoraNetwork/refunder/config"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Monitor(t *testing.T) {
+	priv, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	address := crypto.PubkeyToAddress(priv.PublicKey)
+
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{
+		address: {Balance: big.NewInt(1e18)},
+	}, 4712388)
+	defer backend.Close()
+
+	assert.False(t, (*balance.Monitor)(nil).Paused())
+
+	m := balance.New("giveaway", &client.MockClient{Client: backend}, address, &config.BalanceMonitor{
+		WarningWei:      big.NewInt(2e18),
+		CriticalWei:     big.NewInt(5e17),
+		ReserveFloorWei: big.NewInt(1e17),
+	})
+
+	var alerts []*balance.Alert
+	m.OnAlert(func(a *balance.Alert) { alerts = append(alerts, a) })
+
+	assert.NoError(t, m.Check())
+	st := m.Status()
+	assert.Equal(t, balance.Warning, st.Level)
+	assert.False(t, st.Paused)
+	assert.Equal(t, big.NewInt(1e18), st.BalanceWei)
+	assert.Len(t, alerts, 1)
+
+	// no alert without any change
+	assert.NoError(t, m.Check())
+	assert.Len(t, alerts, 1)
+
+	// spends most of the balance
+	to := common.HexToAddress("0x49C86Ee3Aca6ADE64127FA170445cd0B97CBBd4c")
+	gasPrice, err := backend.SuggestGasPrice(context.Background())
+	assert.NoError(t, err)
+	tx, err := types.SignTx(types.NewTx(&types.LegacyTx{
+		To:       &to,
+		Value:    big.NewInt(95e16),
+		Gas:      21000,
+		GasPrice: gasPrice,
+	}), types.NewEIP155Signer(backend.Blockchain().Config().ChainID), priv)
+	assert.NoError(t, err)
+	assert.NoError(t, backend.SendTransaction(context.Background(), tx))
+	backend.Commit()
+
+	assert.NoError(t, m.Check())
+	assert.True(t, m.Paused())
+	assert.Equal(t, balance.Critical, m.Status().Level)
+	if assert.Len(t, alerts, 2) {
+		assert.Equal(t, balance.Warning, alerts[1].Previous)
+		assert.Equal(t, balance.Critical, alerts[1].Level)
+		assert.True(t, alerts[1].Paused)
+	}
+}
@@ -0,0 +1,339 @@
+package budget
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/config"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Exceeded tells which limit stops the payout
+type Exceeded struct {
+	Limit  string
+	Detail string
+}
+
+func (e *Exceeded) Error() string {
+	return fmt.Sprintf("limit:%s exceeded, detail:%s", e.Limit, e.Detail)
+}
+
+// IsExceeded reports whether err is caused by a limit
+func IsExceeded(err error) bool {
+	var e *Exceeded
+	return errors.As(err, &e)
+}
+
+type record struct {
+	At        time.Time      `json:"at"`
+	Token     common.Address `json:"token"`
+	Recipient common.Address `json:"recipient"`
+	Wei       *big.Int       `json:"wei"`
+}
+
+type state struct {
+	Records      []*record `json:"records"`
+	TrippedUntil time.Time `json:"tripped_until"`
+}
+
+type budget struct {
+	window time.Duration
+	maxWei *big.Int
+}
+
+// Limiter holds the rolling budgets and rate limits, the payout records are persisted into a file
+type Limiter struct {
+	mux sync.Mutex
+
+	budgets             []budget
+	tokenBudgets        map[common.Address][]budget
+	recipientWindow     time.Duration
+	recipientMaxPayouts int
+	recipientMaxWei     *big.Int
+	maxPayoutsPerMinute int
+	breakerCooldown     time.Duration
+	filepath            string
+
+	// retention is the longest window, the older records are pruned
+	retention time.Duration
+	state     *state
+	// reserved are the payouts waiting in a batch, counted like the sent ones but never persisted
+	reserved []*record
+}
+
+func toBudgets(confs []*config.Budget) ([]budget, error) {
+	bs := make([]budget, 0, len(confs))
+	for _, conf := range confs {
+		if conf.WindowSec == 0 || conf.MaxWei == nil {
+			return nil, fmt.Errorf("budget needs both window_sec and max_wei:%+v", conf)
+		}
+		bs = append(bs, budget{window: time.Duration(conf.WindowSec) * time.Second, maxWei: conf.MaxWei})
+	}
+	return bs, nil
+}
+
+// New returns a Limiter and loads the previous records from the state file
+// a nil config returns a nil Limiter which allows everything
+func New(conf *config.Limits) (*Limiter, error) {
+	if conf == nil {
+		return nil, nil
+	}
+
+	if conf.StateFilepath == "" {
+		return nil, errors.New("limits state_filepath is a MUST filled field")
+	}
+
+	l := &Limiter{
+		tokenBudgets:        make(map[common.Address][]budget),
+		recipientWindow:     time.Duration(conf.RecipientWindowSec) * time.Second,
+		recipientMaxPayouts: conf.RecipientMaxPayouts,
+		recipientMaxWei:     conf.RecipientMaxWei,
+		maxPayoutsPerMinute: conf.MaxPayoutsPerMinute,
+		breakerCooldown:     time.Duration(conf.BreakerCooldownSec) * time.Second,
+		filepath:            conf.StateFilepath,
+		retention:           time.Minute,
+		state:               &state{},
+	}
+
+	var err error
+	if l.budgets, err = toBudgets(conf.Budgets); err != nil {
+		return nil, err
+	}
+	for token, confs := range conf.TokenBudgets {
+		if l.tokenBudgets[common.HexToAddress(token)], err = toBudgets(confs); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, b := range l.budgets {
+		l.extend(b.window)
+	}
+	for _, bs := range l.tokenBudgets {
+		for _, b := range bs {
+			l.extend(b.window)
+		}
+	}
+	l.extend(l.recipientWindow)
+
+	b, err := ioutil.ReadFile(l.filepath)
+	switch {
+	case os.IsNotExist(err):
+		// first time start up
+	case err != nil:
+		return nil, fmt.Errorf("limits read file:%q failed:%w", l.filepath, err)
+	case len(b) > 0:
+		if err := json.Unmarshal(b, l.state); err != nil {
+			return nil, fmt.Errorf("limits json unmarshal state failed:%w", err)
+		}
+	}
+
+	return l, nil
+}
+
+func (l *Limiter) extend(window time.Duration) {
+	if window > l.retention {
+		l.retention = window
+	}
+}
+
+// sum returns the paid wei and payouts count since the given time which match the filter
+func (l *Limiter) sum(since time.Time, match func(*record) bool) (*big.Int, int) {
+	total, count := big.NewInt(0), 0
+	for _, records := range [][]*record{l.state.Records, l.reserved} {
+		for _, r := range records {
+			if r.At.After(since) && match(r) {
+				total.Add(total, r.Wei)
+				count++
+			}
+		}
+	}
+	return total, count
+}
+
+func (l *Limiter) checkBudgets(now time.Time, name string, bs []budget, wei *big.Int, match func(*record) bool) error {
+	for _, b := range bs {
+		spent, _ := l.sum(now.Add(-b.window), match)
+		if spent.Add(spent, wei).Cmp(b.maxWei) > 0 {
+			return &Exceeded{
+				Limit:  name,
+				Detail: fmt.Sprintf("window:%s, spent_with_payout:%s, max:%s", b.window, spent, b.maxWei),
+			}
+		}
+	}
+	return nil
+}
+
+// Allow checks the payout against all the limits, it returns an *Exceeded error if any limit stops it
+func (l *Limiter) Allow(now time.Time, token, recipient common.Address, wei *big.Int) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if now.Before(l.state.TrippedUntil) {
+		return &Exceeded{Limit: "circuit_breaker", Detail: fmt.Sprintf("tripped until:%s", l.state.TrippedUntil)}
+	}
+
+	if l.maxPayoutsPerMinute > 0 {
+		if _, count := l.sum(now.Add(-time.Minute), func(*record) bool { return true }); count >= l.maxPayoutsPerMinute {
+			l.state.TrippedUntil = now.Add(l.breakerCooldown)
+			if err := l.save(); err != nil {
+				return err
+			}
+			return &Exceeded{Limit: "circuit_breaker", Detail: fmt.Sprintf("payouts:%d in the last minute, tripped until:%s", count, l.state.TrippedUntil)}
+		}
+	}
+
+	if err := l.checkBudgets(now, "service_budget", l.budgets, wei, func(*record) bool { return true }); err != nil {
+		return err
+	}
+
+	if err := l.checkBudgets(now, "token_budget", l.tokenBudgets[token], wei, func(r *record) bool { return r.Token == token }); err != nil {
+		return err
+	}
+
+	if l.recipientWindow > 0 {
+		paid, count := l.sum(now.Add(-l.recipientWindow), func(r *record) bool { return r.Recipient == recipient })
+		if l.recipientMaxPayouts > 0 && count >= l.recipientMaxPayouts {
+			return &Exceeded{Limit: "recipient_payouts", Detail: fmt.Sprintf("to_address:%s, payouts:%d, max:%d", recipient, count, l.recipientMaxPayouts)}
+		}
+		if l.recipientMaxWei != nil && paid.Add(paid, wei).Cmp(l.recipientMaxWei) > 0 {
+			return &Exceeded{Limit: "recipient_wei", Detail: fmt.Sprintf("to_address:%s, paid_with_payout:%s, max:%s", recipient, paid, l.recipientMaxWei)}
+		}
+	}
+
+	return nil
+}
+
+// Record saves a sent payout into the windows
+func (l *Limiter) Record(now time.Time, token, recipient common.Address, wei *big.Int) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	l.state.Records = append(l.state.Records, &record{
+		At:        now,
+		Token:     token,
+		Recipient: recipient,
+		Wei:       big.NewInt(0).Set(wei),
+	})
+
+	// prune the records out of all the windows
+	since := now.Add(-l.retention)
+	i := sort.Search(len(l.state.Records), func(i int) bool { return l.state.Records[i].At.After(since) })
+	l.state.Records = l.state.Records[i:]
+
+	return l.save()
+}
+
+// Reserve counts a payout waiting in a batch, so the later payouts are checked with it,
+// release drops it once the payout is recorded or failed
+func (l *Limiter) Reserve(now time.Time, token, recipient common.Address, wei *big.Int) (release func()) {
+	if l == nil {
+		return func() {}
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	r := &record{At: now, Token: token, Recipient: recipient, Wei: big.NewInt(0).Set(wei)}
+	l.reserved = append(l.reserved, r)
+	return func() {
+		l.mux.Lock()
+		defer l.mux.Unlock()
+		for i, v := range l.reserved {
+			if v == r {
+				l.reserved = append(l.reserved[:i], l.reserved[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (l *Limiter) save() error {
+	b, err := json.Marshal(l.state)
+	if err != nil {
+		return fmt.Errorf("limits json marshal state failed:%w", err)
+	}
+	if err := ioutil.WriteFile(l.filepath, b, 0o600); err != nil {
+		return fmt.Errorf("limits write file:%q failed:%w", l.filepath, err)
+	}
+	return nil
+}
+
+// BudgetStatus is the remaining of a rolling budget
+type BudgetStatus struct {
+	Token     string   `json:"token,omitempty"`
+	WindowSec uint     `json:"window_sec"`
+	MaxWei    *big.Int `json:"max_wei"`
+	SpentWei  *big.Int `json:"spent_wei"`
+	RemainWei *big.Int `json:"remain_wei"`
+}
+
+// Status is the snapshot of the limits
+type Status struct {
+	Budgets        []*BudgetStatus `json:"budgets"`
+	PayoutsLastMin int             `json:"payouts_last_minute"`
+	TrippedUntil   *time.Time      `json:"tripped_until,omitempty"`
+}
+
+// Status returns the remaining budgets at the given time
+func (l *Limiter) Status(now time.Time) *Status {
+	if l == nil {
+		return nil
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	st := &Status{Budgets: make([]*BudgetStatus, 0, len(l.budgets))}
+	collect := func(token string, bs []budget, match func(*record) bool) {
+		for _, b := range bs {
+			spent, _ := l.sum(now.Add(-b.window), match)
+			remain := big.NewInt(0).Sub(b.maxWei, spent)
+			if remain.Sign() < 0 {
+				remain.SetInt64(0)
+			}
+			st.Budgets = append(st.Budgets, &BudgetStatus{
+				Token:     token,
+				WindowSec: uint(b.window / time.Second),
+				MaxWei:    b.maxWei,
+				SpentWei:  spent,
+				RemainWei: remain,
+			})
+		}
+	}
+
+	collect("", l.budgets, func(*record) bool { return true })
+
+	tokens := make([]common.Address, 0, len(l.tokenBudgets))
+	for token := range l.tokenBudgets {
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Hash().Big().Cmp(tokens[j].Hash().Big()) < 0 })
+	for _, token := range tokens {
+		token := token
+		collect(token.String(), l.tokenBudgets[token], func(r *record) bool { return r.Token == token })
+	}
+
+	_, st.PayoutsLastMin = l.sum(now.Add(-time.Minute), func(*record) bool { return true })
+	if now.Before(l.state.TrippedUntil) {
+		until := l.state.TrippedUntil
+		st.TrippedUntil = &until
+	}
+
+	return st
+}
@@ -0,0 +1,122 @@
+package budget_test
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/budget"
+	"github.com/FindoraNetwork/refunder/config"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	token     = common.HexToAddress("0x49C86Ee3Aca6ADE64127FA170445cd0B97CBBd4c")
+	recipient = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	other     = common.HexToAddress("0x1000000000000000000000000000000000000002")
+)
+
+func Test_Limiter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "Test_Limiter_*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	conf := &config.Limits{
+		Budgets: []*config.Budget{
+			{WindowSec: 3600, MaxWei: big.NewInt(100)},
+		},
+		TokenBudgets: map[string][]*config.Budget{
+			token.String(): {{WindowSec: 86400, MaxWei: big.NewInt(150)}},
+		},
+		RecipientWindowSec:  86400,
+		RecipientMaxPayouts: 2,
+		MaxPayoutsPerMinute: 2,
+		BreakerCooldownSec:  600,
+		StateFilepath:       filepath.Join(dir, "limits.json"),
+	}
+
+	l, err := budget.New(conf)
+	assert.NoError(t, err)
+
+	now := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.NoError(t, l.Allow(now, token, recipient, big.NewInt(60)))
+	assert.NoError(t, l.Record(now, token, recipient, big.NewInt(60)))
+
+	// service budget: 60 + 50 > 100 in the same hour
+	err = l.Allow(now, token, other, big.NewInt(50))
+	assert.True(t, budget.IsExceeded(err))
+	assert.Equal(t, "service_budget", err.(*budget.Exceeded).Limit)
+
+	// an hour later the service budget rolls over, but the daily token budget doesn't
+	now = now.Add(time.Hour + time.Second)
+	assert.NoError(t, l.Allow(now, token, other, big.NewInt(50)))
+	err = l.Allow(now, token, other, big.NewInt(91))
+	assert.Equal(t, "token_budget", err.(*budget.Exceeded).Limit)
+
+	// the records survive a restart
+	l, err = budget.New(conf)
+	assert.NoError(t, err)
+
+	assert.NoError(t, l.Record(now, token, recipient, big.NewInt(10)))
+	err = l.Allow(now, token, recipient, big.NewInt(10))
+	assert.Equal(t, "recipient_payouts", err.(*budget.Exceeded).Limit)
+
+	st := l.Status(now)
+	assert.Equal(t, big.NewInt(90), st.Budgets[0].RemainWei)
+	assert.Equal(t, big.NewInt(80), st.Budgets[1].RemainWei)
+	assert.Nil(t, st.TrippedUntil)
+
+	// the 2nd payout in a minute trips the breaker for all recipients
+	assert.NoError(t, l.Record(now, common.Address{}, other, big.NewInt(1)))
+	err = l.Allow(now, common.Address{}, common.HexToAddress("0x03"), big.NewInt(1))
+	assert.Equal(t, "circuit_breaker", err.(*budget.Exceeded).Limit)
+	err = l.Allow(now.Add(5*time.Minute), common.Address{}, common.HexToAddress("0x03"), big.NewInt(1))
+	assert.Equal(t, "circuit_breaker", err.(*budget.Exceeded).Limit)
+	assert.NoError(t, l.Allow(now.Add(11*time.Minute), common.Address{}, common.HexToAddress("0x03"), big.NewInt(1)))
+}
+
+func Test_Reserve(t *testing.T) {
+	conf := &config.Limits{
+		Budgets:       []*config.Budget{{WindowSec: 3600, MaxWei: big.NewInt(100)}},
+		StateFilepath: filepath.Join(t.TempDir(), "limits.json"),
+	}
+	l, err := budget.New(conf)
+	assert.NoError(t, err)
+
+	now := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	// a payout waiting in a batch counts until it's released
+	release := l.Reserve(now, token, recipient, big.NewInt(60))
+	err = l.Allow(now, token, other, big.NewInt(50))
+	assert.Equal(t, "service_budget", err.(*budget.Exceeded).Limit)
+	assert.Equal(t, big.NewInt(40), l.Status(now).Budgets[0].RemainWei)
+
+	release()
+	release()
+	assert.NoError(t, l.Allow(now, token, other, big.NewInt(50)))
+
+	// the reservations are not persisted
+	l.Reserve(now, token, recipient, big.NewInt(60))
+	assert.NoError(t, l.Record(now, token, other, big.NewInt(10)))
+	l, err = budget.New(conf)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Allow(now, token, other, big.NewInt(90)))
+}
+
+func Test_NilLimiter(t *testing.T) {
+	l, err := budget.New(nil)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Allow(time.Now(), token, recipient, big.NewInt(1)))
+	assert.NoError(t, l.Record(time.Now(), token, recipient, big.NewInt(1)))
+	l.Reserve(time.Now(), token, recipient, big.NewInt(1))()
+	assert.Nil(t, l.Status(time.Now()))
+
+	_, err = budget.New(&config.Limits{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/admin"
+)
+
+const approvalsHelp = `
+Usage refunder approvals [--admin ADDRESS] COMMAND [OPTION]...
+
+Commands:
+list       list the approval items
+           --service  only the service, like gasfee, giveaway or bsc.gasfee on a named network
+           --status   only the status, like pending, approved, rejected, sent
+approve    approve a pending item, and send it through the service
+reject     reject a pending item
+           --service  the service of the item
+           --id       the item id
+           --note     an optional note for the audit records
+           --token    the bearer token of the operator, recorded as the decider, default the env ADMIN_TOKEN
+
+Options:
+--admin    the admin api address, default http://127.0.0.1:8080
+`
+
+// Approvals talks to the admin api for listing, approving and rejecting the held payouts
+func Approvals(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("approvals", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), approvalsHelp) }
+	adminAddr := fs.String("admin", "http://127.0.0.1:8080", "the admin api address")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("approvals expecting a command")
+	}
+
+	cmd, cmdArgs := fs.Arg(0), fs.Args()[1:]
+	sub := flag.NewFlagSet("approvals "+cmd, flag.ContinueOnError)
+	sub.Usage = fs.Usage
+	service := sub.String("service", "", "the service name")
+	status := sub.String("status", "", "the item status")
+	id := sub.Uint64("id", 0, "the item id")
+	token := sub.String("token", os.Getenv("ADMIN_TOKEN"), "the operator bearer token")
+	note := sub.String("note", "", "the note")
+	if err := sub.Parse(cmdArgs); err != nil {
+		return err
+	}
+
+	c := &http.Client{Timeout: 30 * time.Second}
+
+	var rep *http.Response
+	var err error
+	switch cmd {
+	case "list":
+		q := url.Values{}
+		if *service != "" {
+			q.Set("service", *service)
+		}
+		if *status != "" {
+			q.Set("status", *status)
+		}
+		rep, err = c.Get(*adminAddr + "/approvals?" + q.Encode())
+	case "approve", "reject":
+		if *service == "" || *id == 0 {
+			return fmt.Errorf("approvals %s expecting both --service and --id", cmd)
+		}
+		if *token == "" {
+			return fmt.Errorf("approvals %s expecting --token or the env ADMIN_TOKEN", cmd)
+		}
+		body, merr := json.Marshal(&admin.Decision{Service: *service, ID: *id, Note: *note})
+		if merr != nil {
+			return fmt.Errorf("approvals json marshal failed:%w", merr)
+		}
+		req, rerr := http.NewRequest(http.MethodPost, *adminAddr+"/approvals/"+cmd, bytes.NewReader(body))
+		if rerr != nil {
+			return fmt.Errorf("approvals %s request failed:%w", cmd, rerr)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+*token)
+		rep, err = c.Do(req)
+	default:
+		fs.Usage()
+		return fmt.Errorf("approvals unknown command:%q", cmd)
+	}
+	if err != nil {
+		return fmt.Errorf("approvals %s request failed:%w", cmd, err)
+	}
+	defer rep.Body.Close()
+
+	return writeResponse(stdout, rep)
+}
+
+// writeResponse pretty prints the json response body, and turns the non 2xx status into an error
+func writeResponse(stdout io.Writer, rep *http.Response) error {
+	b, err := ioutil.ReadAll(rep.Body)
+	if err != nil {
+		return fmt.Errorf("read response body failed:%w", err)
+	}
+
+	if rep.StatusCode/100 != 2 {
+		return fmt.Errorf("admin api responded %s: %s", rep.Status, bytes.TrimSpace(b))
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, b, "", "  "); err != nil {
+		out.Write(b)
+	}
+	_, err = fmt.Fprintln(stdout, out.String())
+	return err
+}
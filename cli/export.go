@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/client"
+	"github.com/FindoraNetwork/refunder/config"
+	"github.com/FindoraNetwork/refunder/ledger"
+)
+
+const exportHelp = `
+Usage refunder export --config FILE [OPTION]...
+
+Options:
+--config     the config file holding the ledger_filepath of the services
+--network    only the network name, default all, the top-level services are named ""
+--service    only the service, giveaway, gasfee or all, default all
+--since      only the records at or after the time, RFC3339 or 2006-01-02
+--until      only the records before the time, RFC3339 or 2006-01-02
+--format     csv or json, default csv
+--reconcile  look up the on-chain receipts of the sent payouts, default true
+`
+
+func parseTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", v)
+}
+
+// Export writes the ledger records of the payouts for the accounting, reconciled with the on-chain receipts
+func Export(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), exportHelp) }
+	configFile := fs.String("config", "", "the config file")
+	network := fs.String("network", "all", "the network name")
+	service := fs.String("service", "all", "the service name")
+	sinceArg := fs.String("since", "", "the start time")
+	untilArg := fs.String("until", "", "the end time")
+	format := fs.String("format", "csv", "csv or json")
+	reconcile := fs.Bool("reconcile", true, "look up the on-chain receipts")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *configFile == "" {
+		fs.Usage()
+		return errors.New("export expecting --config")
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("export unknown format:%q", *format)
+	}
+
+	since, err := parseTime(*sinceArg)
+	if err != nil {
+		return fmt.Errorf("export parsing --since failed:%w", err)
+	}
+	until, err := parseTime(*untilArg)
+	if err != nil {
+		return fmt.Errorf("export parsing --until failed:%w", err)
+	}
+
+	conf, err := config.Load("--config", *configFile)
+	if err != nil {
+		return err
+	}
+
+	type source struct {
+		name     string
+		filepath string
+		server   *config.Server
+	}
+
+	var sources []*source
+	for _, n := range conf.AllNetworks() {
+		if *network != "all" && *network != n.Name {
+			continue
+		}
+		if (*service == "all" || *service == "giveaway") && n.GiveawayService != nil && n.GiveawayService.LedgerFilepath != "" {
+			sources = append(sources, &source{config.Namespaced(n.Name, "giveaway"), n.GiveawayService.LedgerFilepath, n.Server})
+		}
+		if (*service == "all" || *service == "gasfee") && n.GasfeeService != nil && n.GasfeeService.LedgerFilepath != "" {
+			sources = append(sources, &source{config.Namespaced(n.Name, "gasfee"), n.GasfeeService.LedgerFilepath, n.Server})
+		}
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("export no ledger_filepath configured for network:%q, service:%q", *network, *service)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	records := []*ledger.Record{}
+	for _, src := range sources {
+		rs, err := ledger.Open(src.filepath).Query(since, until)
+		if err != nil {
+			return err
+		}
+
+		// the services are allowed to share a ledger file
+		own := []*ledger.Record{}
+		for _, r := range rs {
+			if r.Service == src.name {
+				own = append(own, r)
+			}
+		}
+
+		// the receipts are looked up on the network of the service
+		if *reconcile && len(own) > 0 {
+			c, err := client.New(src.server).DialRPC()
+			if err != nil {
+				return fmt.Errorf("export client dialing failed:%w, service:%s", err, src.name)
+			}
+			ledger.Reconcile(ctx, c, own)
+			c.Close()
+		}
+
+		records = append(records, own...)
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].At.Before(records[j].At) })
+
+	if *format == "json" {
+		return ledger.WriteJSON(stdout, records)
+	}
+	return ledger.WriteCSV(stdout, records)
+}
@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/FindoraNetwork/refunder/signer"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const keysHelp = `
+Usage refunder keys COMMAND [OPTION]...
+
+Commands:
+generate   generate a new funding key into an encrypted keystore file
+           --keystore-dir     the directory of the keystore files
+           --passphrase-file  the file holding the passphrase
+           --light-kdf        use the light scrypt parameters, for testing only
+import     encrypt an existing hex private key into a keystore file
+           --keystore-dir     the directory of the keystore files
+           --passphrase-file  the file holding the passphrase
+           --key-file         the file holding the hex private key, default reading from the stdin
+           --light-kdf        use the light scrypt parameters, for testing only
+address    show the address of a keystore file
+           --keystore         the keystore file
+           --passphrase-file  decrypt the keystore file to verify the passphrase, optional
+`
+
+// Keys manages the encrypted keystore files of the funding keys, so the hex private key never touches the env
+func Keys(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("keys", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), keysHelp) }
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("keys expecting a command")
+	}
+
+	cmd, cmdArgs := fs.Arg(0), fs.Args()[1:]
+	sub := flag.NewFlagSet("keys "+cmd, flag.ContinueOnError)
+	sub.Usage = fs.Usage
+	keystoreDir := sub.String("keystore-dir", "", "the directory of the keystore files")
+	keystoreFile := sub.String("keystore", "", "the keystore file")
+	passphraseFile := sub.String("passphrase-file", "", "the file holding the passphrase")
+	keyFile := sub.String("key-file", "", "the file holding the hex private key")
+	lightKDF := sub.Bool("light-kdf", false, "use the light scrypt parameters")
+	if err := sub.Parse(cmdArgs); err != nil {
+		return err
+	}
+
+	newKeyStore := func() (*keystore.KeyStore, string, error) {
+		if *keystoreDir == "" || *passphraseFile == "" {
+			return nil, "", fmt.Errorf("keys %s expecting both --keystore-dir and --passphrase-file", cmd)
+		}
+		passphrase, err := signer.ReadPassphrase(*passphraseFile)
+		if err != nil {
+			return nil, "", err
+		}
+		if passphrase == "" {
+			return nil, "", fmt.Errorf("keys passphrase file:%q is empty", *passphraseFile)
+		}
+
+		scryptN, scryptP := keystore.StandardScryptN, keystore.StandardScryptP
+		if *lightKDF {
+			scryptN, scryptP = keystore.LightScryptN, keystore.LightScryptP
+		}
+		return keystore.NewKeyStore(*keystoreDir, scryptN, scryptP), passphrase, nil
+	}
+
+	switch cmd {
+	case "generate":
+		ks, passphrase, err := newKeyStore()
+		if err != nil {
+			return err
+		}
+		account, err := ks.NewAccount(passphrase)
+		if err != nil {
+			return fmt.Errorf("keys generate failed:%w", err)
+		}
+		fmt.Fprintf(stdout, "address:%s\nkeystore:%s\n", account.Address, account.URL.Path)
+		return nil
+
+	case "import":
+		ks, passphrase, err := newKeyStore()
+		if err != nil {
+			return err
+		}
+
+		var hexKey string
+		if *keyFile != "" {
+			b, err := ioutil.ReadFile(*keyFile)
+			if err != nil {
+				return fmt.Errorf("keys read key file:%q failed:%w", *keyFile, err)
+			}
+			hexKey = string(b)
+		} else if hexKey, err = bufio.NewReader(stdin).ReadString('\n'); err != nil && err != io.EOF {
+			return fmt.Errorf("keys read key from the stdin failed:%w", err)
+		}
+
+		key, err := crypto.HexToECDSA(strings.TrimPrefix(strings.TrimSpace(hexKey), "0x"))
+		if err != nil {
+			return fmt.Errorf("keys crypto.HexToECDSA private key failed:%w", err)
+		}
+		account, err := ks.ImportECDSA(key, passphrase)
+		if err != nil {
+			return fmt.Errorf("keys import failed:%w", err)
+		}
+		fmt.Fprintf(stdout, "address:%s\nkeystore:%s\n", account.Address, account.URL.Path)
+		return nil
+
+	case "address":
+		if *keystoreFile == "" {
+			return errors.New("keys address expecting --keystore")
+		}
+
+		if *passphraseFile != "" {
+			passphrase, err := signer.ReadPassphrase(*passphraseFile)
+			if err != nil {
+				return err
+			}
+			key, err := signer.NewKeystore(*keystoreFile, passphrase)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "address:%s\n", key.Address())
+			return nil
+		}
+
+		b, err := ioutil.ReadFile(*keystoreFile)
+		if err != nil {
+			return fmt.Errorf("keys read keystore file:%q failed:%w", *keystoreFile, err)
+		}
+		v := struct {
+			Address string `json:"address"`
+		}{}
+		if err := json.Unmarshal(b, &v); err != nil {
+			return fmt.Errorf("keys json unmarshal keystore file failed:%w", err)
+		}
+		if !common.IsHexAddress(v.Address) {
+			return fmt.Errorf("keys keystore file:%q has no address", *keystoreFile)
+		}
+		fmt.Fprintf(stdout, "address:%s\n", common.HexToAddress(v.Address))
+		return nil
+
+	default:
+		fs.Usage()
+		return fmt.Errorf("keys unknown command:%q", cmd)
+	}
+}
@@ -0,0 +1,67 @@
+package cli_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/FindoraNetwork/refunder/cli"
+	"github.com/FindoraNetwork/refunder/config"
+	"github.com/FindoraNetwork/refunder/signer"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+// keystorePath picks the keystore file path out of the command output
+func keystorePath(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "keystore:") {
+			return strings.TrimPrefix(line, "keystore:")
+		}
+	}
+	return ""
+}
+
+func Test_Keys(t *testing.T) {
+	dir := t.TempDir()
+	passphraseFile := filepath.Join(dir, "passphrase")
+	assert.NoError(t, ioutil.WriteFile(passphraseFile, []byte("secret\n"), 0600))
+
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	address := crypto.PubkeyToAddress(key.PublicKey)
+
+	out := &bytes.Buffer{}
+	stdin := strings.NewReader(hexutil.Encode(crypto.FromECDSA(key)) + "\n")
+	assert.NoError(t, cli.Keys([]string{
+		"import", "--keystore-dir", filepath.Join(dir, "keystore"), "--passphrase-file", passphraseFile, "--light-kdf",
+	}, stdin, out))
+	assert.Contains(t, out.String(), "address:"+address.String())
+	path := keystorePath(out.String())
+
+	out.Reset()
+	assert.NoError(t, cli.Keys([]string{"address", "--keystore", path}, nil, out))
+	assert.Equal(t, "address:"+address.String()+"\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, cli.Keys([]string{"address", "--keystore", path, "--passphrase-file", passphraseFile}, nil, out))
+	assert.Equal(t, "address:"+address.String()+"\n", out.String())
+
+	// the service loads the same key with the passphrase file
+	s, err := signer.New(&config.Signer{Kind: config.KeystoreSigner, KeystoreFilepath: path, PassphraseFilepath: passphraseFile}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, address, s.Address())
+
+	out.Reset()
+	assert.NoError(t, cli.Keys([]string{
+		"generate", "--keystore-dir", filepath.Join(dir, "keystore"), "--passphrase-file", passphraseFile, "--light-kdf",
+	}, nil, out))
+	assert.NotEqual(t, path, keystorePath(out.String()))
+
+	assert.Error(t, cli.Keys([]string{"generate", "--keystore-dir", dir}, nil, out))
+	assert.Error(t, cli.Keys([]string{"unknown"}, nil, out))
+}
@@ -31,6 +31,8 @@ type Client interface {
 	ethereum.PendingStateReader
 	ethereum.GasPricer
 	ethereum.ChainReader
+	ethereum.ContractCaller
+	ethereum.GasEstimator
 }
 
 type client struct {
@@ -485,3 +487,33 @@ func (c *client) SuggestGasPrice(ctx context.Context) (v *big.Int, err error) {
 	}
 	return
 }
+
+// CallContract calls the ethclient.CallContract directly
+func (c *client) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) (v []byte, err error) {
+	if c.rpcclient == nil {
+		return nil, ErrDialFirst
+	}
+	for i := 0; i < c.retryTimes; i++ {
+		v, err = c.rpcclient.CallContract(ctx, call, blockNumber)
+		if err == nil {
+			return v, nil
+		}
+		time.Sleep(c.retryPeriod)
+	}
+	return
+}
+
+// EstimateGas calls the ethclient.EstimateGas directly
+func (c *client) EstimateGas(ctx context.Context, call ethereum.CallMsg) (v uint64, err error) {
+	if c.rpcclient == nil {
+		return 0, ErrDialFirst
+	}
+	for i := 0; i < c.retryTimes; i++ {
+		v, err = c.rpcclient.EstimateGas(ctx, call)
+		if err == nil {
+			return v, nil
+		}
+		time.Sleep(c.retryPeriod)
+	}
+	return
+}
@@ -27,11 +27,11 @@ func (c *MockClient) DialWS() (Client, error) {
 }
 
 func (c *MockClient) TransactionByHash(ctx context.Context, txHash common.Hash) (tx *types.Transaction, isPending bool, err error) {
-	return
+	return c.Client.TransactionByHash(ctx, txHash)
 }
 
 func (c *MockClient) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
-	return nil, nil
+	return c.Client.TransactionReceipt(ctx, txHash)
 }
 
 func (c *MockClient) BlockNumber(context.Context) (uint64, error) {
@@ -124,3 +124,11 @@ func (c *MockClient) TransactionInBlock(ctx context.Context, blockHash common.Ha
 func (c *MockClient) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
 	return c.Client.SubscribeNewHead(ctx, ch)
 }
+
+func (c *MockClient) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	return c.Client.CallContract(ctx, call, blockNumber)
+}
+
+func (c *MockClient) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	return c.Client.EstimateGas(ctx, call)
+}
@@ -7,7 +7,12 @@ import (
 	"io/ioutil"
 	"math/big"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
+
+	"github.com/FindoraNetwork/refunder/money"
 )
 
 type Config struct {
@@ -17,6 +22,230 @@ type Config struct {
 	GiveawayService *GiveawayService `json:"giveaway_service"`
 	// GasfeeService is the configuration for Type 2: Gas Refund
 	GasfeeService *GasfeeService `json:"gasfee_service"`
+	// Admin is the configuration for the admin http api
+	Admin *Admin `json:"admin"`
+	// Notifier is the configuration for sending the events of the services to the webhooks
+	Notifier *Notifier `json:"notifier"`
+	// Networks runs an isolated client and service set on each named network, along with the top-level ones if any
+	Networks []*Network `json:"networks"`
+}
+
+// Network is a named EVM network with its own server and services
+// the name namespaces the logs, the metrics, the notifications, the ledger records and the admin api of its services
+// and it prefixes the env names of the secrets, like "BSC_GASFEE_SERVICE_PK" for the network "bsc"
+type Network struct {
+	// Name is a MUST filled field, made of the lowercase letters, the digits, "-" and "_"
+	Name string `json:"name"`
+	// Server is the configuration for dialing to the EVM server of the network
+	Server *Server `json:"server"`
+	// GiveawayService is the giveaway service configuration of the network
+	GiveawayService *GiveawayService `json:"giveaway_service"`
+	// GasfeeService is the gasfee service configuration of the network
+	GasfeeService *GasfeeService `json:"gasfee_service"`
+}
+
+// AllNetworks returns the top-level server and services as an unnamed network if any, followed by the named networks
+func (c *Config) AllNetworks() []*Network {
+	networks := make([]*Network, 0, len(c.Networks)+1)
+	if c.Server != nil || c.GiveawayService != nil || c.GasfeeService != nil {
+		networks = append(networks, &Network{Server: c.Server, GiveawayService: c.GiveawayService, GasfeeService: c.GasfeeService})
+	}
+	return append(networks, c.Networks...)
+}
+
+// Namespaced returns the service name qualified by the network name, the unnamed network keeps the service name
+func Namespaced(network, service string) string {
+	if network == "" {
+		return service
+	}
+	return network + "." + service
+}
+
+type Notifier struct {
+	// Sinks are the webhooks receiving the events
+	Sinks []*NotifierSink `json:"sinks"`
+	// QueueSize is the buffered events waiting for sending, the new events are dropped once it's full, default 100
+	QueueSize int `json:"queue_size"`
+}
+
+// NotifierFormat is the payload format of a webhook
+type NotifierFormat string
+
+const (
+	// JSONFormat posts the event as it is
+	JSONFormat = NotifierFormat("json")
+	// SlackFormat posts {"text": ...} to a Slack incoming webhook
+	SlackFormat = NotifierFormat("slack")
+	// DiscordFormat posts {"content": ...} to a Discord webhook
+	DiscordFormat = NotifierFormat("discord")
+	// TelegramFormat posts {"chat_id": ..., "text": ...} to the Telegram bot sendMessage api
+	TelegramFormat = NotifierFormat("telegram")
+)
+
+type NotifierSink struct {
+	// Name is used in the logs only
+	Name string `json:"name"`
+	// Format is one of "json", "slack", "discord" and "telegram", empty for "json"
+	Format NotifierFormat `json:"format"`
+	// URL is the webhook url, like "https://api.telegram.org/bot<token>/sendMessage" for telegram
+	URL string `json:"url"`
+	// ChatID is the target chat of the telegram format
+	ChatID string `json:"chat_id"`
+	// Events routes only the listed event kinds to the sink, empty for all
+	Events []string `json:"events"`
+	// MaxPerMinute limits the events sent in a rolling minute, the others are dropped, 0 for no limit
+	MaxPerMinute int `json:"max_per_minute"`
+	// TimeoutSec is the timeout second of a webhook request, default 10 seconds
+	TimeoutSec uint `json:"timeout_sec"`
+}
+
+type Admin struct {
+	// ListenAddress is the address the admin http api listening on, like "127.0.0.1:8080"
+	ListenAddress string `json:"listen_address"`
+	// Operators are the names allowed to approve and reject the held payouts, each one authenticated by a bearer token
+	// read from the env, like "ADMIN_ALICE_TOKEN" for the operator "alice", the api is only bound to a loopback address without any
+	Operators []string `json:"operators"`
+	// Tokens are the bearer tokens of the Operators read from the env, keyed by the operator name
+	Tokens map[string]string `json:"-"`
+}
+
+// SignerKind is the backend signing the payouts
+type SignerKind string
+
+const (
+	// KeySigner signs with the in-memory PrivateKey
+	KeySigner = SignerKind("key")
+	// KeystoreSigner signs with an encrypted go-ethereum keystore file
+	KeystoreSigner = SignerKind("keystore")
+	// ClefSigner asks an external signer speaking the Clef / eth_signTransaction JSON-RPC
+	ClefSigner = SignerKind("clef")
+	// RemoteSigner asks a generic remote http signing service
+	RemoteSigner = SignerKind("remote")
+)
+
+type Signer struct {
+	// Kind is one of "key", "keystore", "clef" and "remote", empty for "key"
+	Kind SignerKind `json:"kind"`
+	// KeystoreFilepath is the encrypted keystore json file for the "keystore" kind
+	KeystoreFilepath string `json:"keystore_filepath"`
+	// PassphraseFilepath is the file holding the passphrase of the keystore file
+	PassphraseFilepath string `json:"passphrase_filepath"`
+	// Passphrase decrypts the keystore file, read from the env, it takes precedence over the PassphraseFilepath
+	Passphrase string `json:"-"`
+	// URL is the endpoint of the "clef" and "remote" kinds
+	URL string `json:"url"`
+	// Address is the founding source address held by the "clef" and "remote" kinds
+	Address string `json:"address"`
+	// Method is the JSON-RPC method of the "clef" kind, default "account_signTransaction"
+	// like "eth_signTransaction" for a node holding the account
+	Method string `json:"method"`
+	// TimeoutSec is the timeout second of a signing request, default 30 seconds
+	TimeoutSec uint `json:"timeout_sec"`
+	// AuthToken is sent as a bearer token to the "remote" kind, read from the env
+	AuthToken string `json:"-"`
+}
+
+type Report struct {
+	// Dir is the directory the report files are written into
+	Dir string `json:"dir"`
+	// Formats are "json" and/or "csv", empty for both
+	Formats []string `json:"formats"`
+	// WebhookURL receives the json report in a POST request, optional
+	WebhookURL string `json:"webhook_url"`
+	// TimeoutSec is the timeout second of the webhook request, default 10 seconds
+	TimeoutSec uint `json:"timeout_sec"`
+}
+
+// Trigger is an event driving the payouts
+type Trigger struct {
+	// Event is the event signature naming the fields, like "Transfer(address indexed from, address indexed to, uint256 value)"
+	Event string `json:"event"`
+	// Addresses are the contracts emitting the event, the token addresses of the service if empty
+	Addresses []string `json:"addresses"`
+	// Filters are the values the indexed fields must equal, like {"from": "0x..."} for the releases from a vault
+	Filters map[string]string `json:"filters"`
+	// RecipientField is the address field of the recipient
+	RecipientField string `json:"recipient_field"`
+	// AmountField is the uint field of the bridged amount
+	AmountField string `json:"amount_field"`
+	// TokenField is the address field of the bridged token, the emitting contract is the token if empty
+	TokenField string `json:"token_field"`
+}
+
+// Payout is the ERC20 token paid out, the amounts, the caps and the limits in wei are in the smallest unit of the token
+type Payout struct {
+	// TokenAddress is the ERC20 token the founding source pays out, a MUST filled field
+	TokenAddress string `json:"token_address"`
+	// Decimal of the token converts the amounts in USDT, default 18,
+	// the gasfee takes the decimal of the denominator in the crawling_mapper instead
+	Decimal int `json:"decimal"`
+}
+
+// Batch calls disperseEther(address[],uint256[]), or disperseToken(address,address[],uint256[]) with the Payout,
+// of a multisend contract like Disperse
+type Batch struct {
+	// ContractAddress is the multisend contract, a MUST filled field,
+	// the founding source approves it to spend the Payout token beforehand
+	ContractAddress string `json:"contract_address"`
+	// MaxSize is the most payouts in a batch, default 100
+	MaxSize int `json:"max_size"`
+	// WindowSec is how long the giveaway collects the payouts into a batch, default 60
+	WindowSec uint `json:"window_sec"`
+}
+
+// Gas pads and caps the gas of each payout estimated by the node
+type Gas struct {
+	// Multiplier pads the estimated gas, default 1
+	Multiplier float64 `json:"multiplier"`
+	// Ceiling is the most gas of a payout, 0 for no ceiling
+	Ceiling uint64 `json:"ceiling"`
+	// OnFailure handles a recipient whose estimate fails or is over the ceiling,
+	// "skip" by default records the payout failed and notifies it, "hold" puts it into the approval queue
+	OnFailure string `json:"on_failure"`
+}
+
+// RecipientBalance decides the refund by the native balance of the recipient read at the refunding
+type RecipientBalance struct {
+	// SufficientWei is the native balance enough for the gas, a MUST filled field
+	SufficientWei *big.Int `json:"sufficient_wei"`
+	// Mode is "skip" by default, skipping the recipient holding SufficientWei or more,
+	// or "reduce", reducing the refund to top the balance up to SufficientWei, which needs the native payout
+	Mode string `json:"mode"`
+}
+
+// NativeTrigger drives the payouts by the plain value transfers of the native token, scanned from the blocks
+type NativeTrigger struct {
+	// FromAddresses are the bridge or relayer addresses crediting the recipients
+	FromAddresses []string `json:"from_addresses"`
+	// TokenAddress is the key of the native token in the per token settings, like the crawling_mapper, default the zero address
+	TokenAddress string `json:"token_address"`
+	// Confirmations keeps the live scanning N blocks behind the latest block
+	Confirmations uint64 `json:"confirmations"`
+}
+
+// Window is an activation window, every empty bound is open
+type Window struct {
+	// StartAt is the time in RFC 3339 format the window opens at
+	StartAt time.Time `json:"start_at"`
+	// EndAt is the time in RFC 3339 format the window closes at, exclusive
+	EndAt time.Time `json:"end_at"`
+	// StartBlock is the first block number of the window
+	StartBlock uint64 `json:"start_block"`
+	// EndBlock is the last block number of the window, inclusive
+	EndBlock uint64 `json:"end_block"`
+}
+
+type BalanceMonitor struct {
+	// IntervalSec is the period of checking the balance, default 60 seconds
+	IntervalSec uint `json:"interval_sec"`
+	// TimeoutSec is the timeout second of a balance check, default 10 seconds
+	TimeoutSec uint `json:"timeout_sec"`
+	// WarningWei alerts a warning once the balance is below it
+	WarningWei *big.Int `json:"warning_wei"`
+	// CriticalWei alerts a critical once the balance is below it
+	CriticalWei *big.Int `json:"critical_wei"`
+	// ReserveFloorWei pauses the payouts once the balance is below it, until the wallet is topped up
+	ReserveFloorWei *big.Int `json:"reserve_floor_wei"`
 }
 
 type Server struct {
@@ -31,35 +260,70 @@ type Server struct {
 }
 
 type GasfeeService struct {
+	// Network is the name of the network the service running on, filled by Load
+	Network string `json:"-"`
 	// IsEnable is a switch to enable this service or not
 	IsEnable bool `json:"is_enable"`
 	// PrivateKey for the founding source
 	PrivateKey string `json:"-"`
+	// Signer replaces the PrivateKey with another signing backend, leave it empty for the PrivateKey
+	Signer *Signer `json:"signer"`
 	// CrawleInEveryMinutes specific a time period to crawle the gate.io information
 	CrawleInEveryMinutes uint `json:"crawle_in_every_minutes"`
 	// RefundEveryDayAt specific a time in RFC 3339 format which takes the HH:MM:SS only
 	// and will using 24 hours as it's period
 	RefundEveryDayAt time.Time `json:"refund_every_day_at"`
+	// RefundSchedule replaces the RefundEveryDayAt with a cron expression or the continuous mode, optional
+	RefundSchedule *RefundSchedule `json:"refund_schedule"`
 	// RefunderTotalTimeoutSec is the timeout second for all operations in the refunder function
 	RefunderTotalTimeoutSec uint `json:"refunder_total_timeout_sec"`
 	// RefunderStartBlockNumber defines the the FilterQuery.FromBlock on the first time start up
 	RefunderStartBlockNumber uint64 `json:"refunder_start_block_number"`
 	// RefunderScrapBlockStep is an interval scale of the FilterQuery.ToBlock should be while querying the event logs
 	RefunderScrapBlockStep int `json:"refunder_scrap_block_step"`
+	// RefunderScrapMaxBlockStep is the largest step grown to while the ranges are empty, default RefunderScrapBlockStep
+	RefunderScrapMaxBlockStep int `json:"refunder_scrap_max_block_step"`
+	// RefunderScanConcurrency is the number of the ranges queried at the same time, default 1
+	RefunderScanConcurrency int `json:"refunder_scan_concurrency"`
 	// CrawlerTotalTimeoutSec is the timeout second for all operations in the crawler function
 	CrawlerTotalTimeoutSec uint `json:"crawler_total_timeout_sec"`
 	// RefundThreshold defines the transaction refunding threshold
 	// In USDT as unit currently
-	RefundThreshold *big.Float `json:"refund_threshold"`
-	// RefundMaxCapWei is the total maximum incentive amount in wei
+	RefundThreshold *money.Decimal `json:"refund_threshold"`
+	// RefundMaxCapWei is the total maximum incentive amount in wei, leave it empty for no lifetime cap
 	// Like 20000 FRA = 20000000000000000000000 wei
 	RefundMaxCapWei *big.Int `json:"refund_max_cap_wei"`
+	// Limits are the rolling budgets and rate limits of the payouts
+	Limits *Limits `json:"limits"`
+	// Approval holds the refunds over the thresholds for the manual approval
+	Approval *Approval `json:"approval"`
+	// Window is the activation window of the service, the events outside of it are ignored and logged
+	// a final summary is notified once it ends, leave it empty to run forever
+	Window *Window `json:"window"`
+	// Triggers are the events driving the payouts, leave it empty for the Transfer events minted to the token addresses
+	Triggers []*Trigger `json:"triggers"`
+	// NativeTrigger drives the payouts by the plain value transfers instead, exclusive with the Triggers
+	NativeTrigger *NativeTrigger `json:"native_trigger"`
+	// BalanceMonitor checks the balance of the founding source periodically
+	BalanceMonitor *BalanceMonitor `json:"balance_monitor"`
+	// Payout pays in an ERC20 token instead of the native token, leave it empty for the native token
+	Payout *Payout `json:"payout"`
+	// Batch groups the payouts into a single call of a multisend contract, leave it empty to send them one by one
+	Batch *Batch `json:"batch"`
+	// Gas pads and caps the estimated gas of the payouts, leave it empty to take the estimates as they are
+	Gas *Gas `json:"gas"`
+	// RecipientBalance skips or reduces the refunds of the recipients already holding enough gas, leave it empty to refund everyone
+	RecipientBalance *RecipientBalance `json:"recipient_balance"`
+	// LedgerFilepath is the append-only json lines file recording every payout, leave it empty for no ledger
+	LedgerFilepath string `json:"ledger_filepath"`
+	// Report exports a structured report at the end of each refunder run
+	Report *Report `json:"report"`
 	// IsUsingDynamicGasPrice enables the usage of XXX form 2
 	IsUsingDynamicGasPrice bool `json:"is_using_dynamic_gas_price"`
 	// RefundMaxUsdtEach limits each refunding FRA token should not be over the specific USDT price
-	RefundMaxUsdtEach *big.Float `json:"refund_max_usdt_each"`
+	RefundMaxUsdtEach *money.Decimal `json:"refund_max_usdt_each"`
 	// RefundBaseRateWei is the base rate XXX form 1 from the readme in wei if IsUsingDynamicGasPrice == false
-	RefundBaseRateWei *big.Float `json:"refund_base_rate_wei"`
+	RefundBaseRateWei *money.Decimal `json:"refund_base_rate_wei"`
 	// RefundedWeiFilepath stores the current refunded wei information
 	RefundedWeiFilepath string `json:"refunded_wei_filepath"`
 	// RefundedListFilepath stores the refunded addresses as a json array format to avoid multiple refunding
@@ -70,8 +334,15 @@ type GasfeeService struct {
 	Denominator CurrencyPair `json:"denominator"`
 	// CurrentBlockNumberFilepath stores the current served block high information
 	CurrentBlockNumberFilepath string `json:"current_block_number_filepath"`
+	// FailedRangesFilepath stores the block ranges failed to be queried, they are retried in the next run
+	FailedRangesFilepath string `json:"failed_ranges_filepath"`
 	// CrawlingAddress is the target address to crawle
 	CrawlingAddress string `json:"crawling_address"`
+	// Campaigns run independently on the same scanned blocks, each with its own parameters, dedup list, cap and report
+	// the first campaign refunding or holding a transfer claims it, so the later ones never pay it twice
+	// the RefundThreshold, the RefundBaseRateWei, the RefundMaxUsdtEach and the Report above are the defaults of the campaigns
+	// leave it empty to run a single campaign with the fields above
+	Campaigns []*GasfeeCampaign `json:"campaigns"`
 	// CrawlingMapper defines the crawling target and its own settings
 	// example:
 	// "FRA_USDT": {
@@ -82,6 +353,46 @@ type GasfeeService struct {
 	CrawlingMapper map[CurrencyPair]*CrawlingMate `json:"crawling_mapper"`
 }
 
+// RefundSchedule is either a cron expression or the continuous mode
+type RefundSchedule struct {
+	// Cron is a five fields cron expression "minute hour day-of-month month day-of-week", like "0 */6 * * *"
+	Cron string `json:"cron"`
+	// Timezone is the IANA timezone of the Cron, like "Asia/Taipei", default UTC
+	Timezone string `json:"timezone"`
+	// ContinuousEveryMinutes runs the refunder every N minutes instead of the Cron
+	ContinuousEveryMinutes uint `json:"continuous_every_minutes"`
+	// Confirmations keeps the refunder N blocks behind the latest block, so only the confirmed blocks are refunded
+	Confirmations uint64 `json:"confirmations"`
+	// PriceWindowMinutes keeps the highest or lowest price crawled in the rolling window instead of since the last run
+	// default 1440 minutes in the continuous mode
+	PriceWindowMinutes uint `json:"price_window_minutes"`
+	// LastRunFilepath stores the time of the last run, a run missed during the downtime is run on startup
+	LastRunFilepath string `json:"last_run_filepath"`
+}
+
+type GasfeeCampaign struct {
+	// Name is a MUST filled field, unique in the service
+	Name string `json:"name"`
+	// TokenAddresses are the bridged tokens the campaign refunds, they must be in the CrawlingMapper, empty for all of them
+	TokenAddresses []string `json:"token_addresses"`
+	// RefundThreshold in USDT, empty for the service's one
+	RefundThreshold *money.Decimal `json:"refund_threshold"`
+	// RefundBaseRateWei is the base rate in wei, empty for the service's one
+	RefundBaseRateWei *money.Decimal `json:"refund_base_rate_wei"`
+	// RefundMaxUsdtEach limits each refund in USDT, empty for the service's one
+	RefundMaxUsdtEach *money.Decimal `json:"refund_max_usdt_each"`
+	// RefundMaxCapWei is the budget of the campaign in wei, leave it empty for no cap
+	RefundMaxCapWei *big.Int `json:"refund_max_cap_wei"`
+	// RefundedWeiFilepath stores the refunded wei of the campaign, a MUST filled field
+	RefundedWeiFilepath string `json:"refunded_wei_filepath"`
+	// RefundedListFilepath stores the refunded addresses of the campaign, a MUST filled field
+	RefundedListFilepath string `json:"refunded_list_filepath"`
+	// Window stops the campaign paying outside of it, the block bounds apply to the block of the transfer
+	Window *Window `json:"window"`
+	// Report exports the report of the campaign, empty for the service's one
+	Report *Report `json:"report"`
+}
+
 type (
 	CurrencyPair string
 	PriceKind    int
@@ -104,35 +415,209 @@ type CrawlingMate struct {
 }
 
 type GiveawayService struct {
+	// Network is the name of the network the service running on, filled by Load
+	Network string `json:"-"`
 	// IsEnable is a switch to enable this service or not
 	IsEnable bool `json:"is_enable"`
 	// PrivateKey for the founding source
 	PrivateKey string `json:"-"`
+	// Signer replaces the PrivateKey with another signing backend, leave it empty for the PrivateKey
+	Signer *Signer `json:"signer"`
 	// HandlerTotalTimeoutSec is the timeout second for all operations in the handle function
 	HandlerTotalTimeoutSec uint `json:"handler_operations_timeout_sec"`
 	// SubscripTimeoutSec is the timeout second for dialing and subscribing to the server
 	SubscripTimeoutSec uint `json:"subscrip_timeout_sec"`
 	// EventLogPoolSize is the size of the subscribed buffered channel
 	EventLogPoolSize int `json:"event_log_pool_size"`
+	// CursorFilepath stores the position of the handled events, the events missed during a downtime or a reconnection
+	// are backfilled from it, leave it empty for the live events only
+	CursorFilepath string `json:"cursor_filepath"`
+	// StartBlockNumber is where the backfill starts on the first time start up with the CursorFilepath
+	StartBlockNumber uint64 `json:"start_block_number"`
 	// FixedGiveawayWei is the constant amount of token to do the incentive
 	// Like 0.003 FRA = 30000000000000000 wei
 	FixedGiveawayWei *big.Int `json:"fixed_giveaway_wei"`
-	// MaxCapWei is the total maximum incentive amount in Wei
+	// MaxCapWei is the total maximum incentive amount in Wei, leave it empty for no lifetime cap
 	// Like 20000 FRA = 20000000000000000000000 wei
 	MaxCapWei *big.Int `json:"max_cap_wei"`
+	// Limits are the rolling budgets and rate limits of the payouts
+	Limits *Limits `json:"limits"`
 	// TokenAddresses is the address of tokens gonna to listen to incentive
 	TokenAddresses []string `json:"token_addresses"`
 	// CurrentGaveWeiFilepath stores the current gave out wei information
 	CurrentGaveWeiFilepath string `json:"current_gave_wei_filepath"`
+	// GaveListFilepath stores the recipients given away, who are never given away again,
+	// a MUST filled field with the Payout as paying a token leaves the native balance and the nonce of the recipient as they were
+	GaveListFilepath string `json:"gave_list_filepath"`
+	// EligibilityRules defines the rule set of each token address a recipient must pass
+	// the "*" key is the fallback for the tokens without their own rule set
+	// leaving it empty keeps the original `balance == 0 && nonce == 0` condition
+	// example:
+	// "0x49C86Ee3Aca6ADE64127FA170445cd0B97CBBd4c": {
+	//	"min_transfer_amount": 1000000,
+	//	"max_nonce": 0,
+	//      ...
+	// }
+	EligibilityRules map[string]*EligibilityRules `json:"eligibility_rules"`
+	// GiveawayAmounts defines the giveaway amount of each token address
+	// the "*" key is the fallback, and FixedGiveawayWei is used if neither of them has been configured
+	GiveawayAmounts map[string]*GiveawayAmount `json:"giveaway_amounts"`
+	// CrawlingAddress is the gate.io candlesticks api address, a MUST filled field if any amount is in USDT
+	CrawlingAddress string `json:"crawling_address"`
+	// NativeCurrencyPair is the native token price pair like "FRA_USDT" for converting USDT into wei,
+	// or the price pair of the Payout token
+	NativeCurrencyPair CurrencyPair `json:"native_currency_pair"`
+	// NativePriceKind defines which kind of price is used for converting USDT into wei
+	NativePriceKind PriceKind `json:"native_price_kind"`
+	// NativePriceTTLSec is how long a crawled native token price is reused
+	NativePriceTTLSec uint `json:"native_price_ttl_sec"`
+	// SybilDetection holds the suspicious payouts in the Approval queue instead of sending them
+	SybilDetection *SybilDetection `json:"sybil_detection"`
+	// Approval is the manual approval queue, a MUST filled field if SybilDetection is configured
+	Approval *Approval `json:"approval"`
+	// Window is the activation window of the service, the events outside of it are ignored and logged
+	// a final summary is notified once it ends, leave it empty to run forever
+	Window *Window `json:"window"`
+	// Triggers are the events driving the payouts, leave it empty for the Transfer events minted to the token addresses
+	Triggers []*Trigger `json:"triggers"`
+	// NativeTrigger drives the payouts by the plain value transfers instead, exclusive with the Triggers
+	NativeTrigger *NativeTrigger `json:"native_trigger"`
+	// BalanceMonitor checks the balance of the founding source periodically
+	BalanceMonitor *BalanceMonitor `json:"balance_monitor"`
+	// Payout pays in an ERC20 token instead of the native token, leave it empty for the native token
+	Payout *Payout `json:"payout"`
+	// Batch groups the payouts into a single call of a multisend contract, leave it empty to send them one by one
+	Batch *Batch `json:"batch"`
+	// Gas pads and caps the estimated gas of the payouts, leave it empty to take the estimates as they are
+	Gas *Gas `json:"gas"`
+	// LedgerFilepath is the append-only json lines file recording every payout, leave it empty for no ledger
+	LedgerFilepath string `json:"ledger_filepath"`
+}
+
+// SybilDetection defines the heuristics on the recipients in a rolling window, 0 disables a heuristic
+// the source is the sender of the bridge transaction
+// the funding path is the source, the bridge contract (the bridge transaction's to address) and the token
+type SybilDetection struct {
+	// WindowSec is the rolling window of the heuristics
+	WindowSec uint `json:"window_sec"`
+	// MaxRecipientsPerSource is the maximum distinct recipients funded by one source
+	MaxRecipientsPerSource int `json:"max_recipients_per_source"`
+	// MaxRecipientsPerTx is the maximum distinct recipients funded by one bridge transaction
+	MaxRecipientsPerTx int `json:"max_recipients_per_tx"`
+	// MaxRecipientsPerPath is the maximum distinct recipients funded through one funding path
+	MaxRecipientsPerPath int `json:"max_recipients_per_path"`
+	// MaxRecipientsPerWindow is the maximum distinct recipients of all sources
+	MaxRecipientsPerWindow int `json:"max_recipients_per_window"`
+	// StateFilepath stores the observed recipients in the window as a json format
+	StateFilepath string `json:"state_filepath"`
+}
+
+// Approval holds the payouts over the thresholds, or flagged by the risk checks, for the manual approval
+type Approval struct {
+	// ThresholdWei holds the payouts over the amount in wei, leave it empty to disable
+	ThresholdWei *big.Int `json:"threshold_wei"`
+	// ThresholdUsdt holds the payouts over the value in USDT, leave it empty to disable
+	ThresholdUsdt *money.Decimal `json:"threshold_usdt"`
+	// QueueFilepath stores the approval queue as a json format
+	QueueFilepath string `json:"queue_filepath"`
+}
+
+// GiveawayAmount is either in wei or in USDT, the Wei takes the priority if both are filled
+type GiveawayAmount struct {
+	// Wei is the amount in wei for the transfers which are not matching any tier
+	Wei *big.Int `json:"wei"`
+	// Usdt is the amount in USDT for the transfers which are not matching any tier
+	Usdt *big.Float `json:"usdt"`
+	// Tiers are keyed on the bridged amount, the tier with the highest matched MinTransferAmount wins
+	Tiers []*GiveawayTier `json:"tiers"`
+}
+
+type GiveawayTier struct {
+	// MinTransferAmount is the minimum bridged amount in the token's smallest unit to reach this tier
+	MinTransferAmount *big.Int `json:"min_transfer_amount"`
+	// Wei is the amount in wei of this tier
+	Wei *big.Int `json:"wei"`
+	// Usdt is the amount in USDT of this tier
+	Usdt *big.Float `json:"usdt"`
+}
+
+type Limits struct {
+	// Budgets are the rolling budgets of the whole service
+	Budgets []*Budget `json:"budgets"`
+	// TokenBudgets are the rolling budgets keyed by the bridged token address
+	TokenBudgets map[string][]*Budget `json:"token_budgets"`
+	// RecipientWindowSec is the rolling window of the per-recipient limits
+	RecipientWindowSec uint `json:"recipient_window_sec"`
+	// RecipientMaxPayouts is the maximum payouts count of a recipient in the window, 0 for no limit
+	RecipientMaxPayouts int `json:"recipient_max_payouts"`
+	// RecipientMaxWei is the maximum paid wei of a recipient in the window
+	RecipientMaxWei *big.Int `json:"recipient_max_wei"`
+	// MaxPayoutsPerMinute trips the circuit breaker once the payouts in the last minute reach it, 0 for no limit
+	MaxPayoutsPerMinute int `json:"max_payouts_per_minute"`
+	// BreakerCooldownSec is how long the tripped circuit breaker stops all payouts
+	BreakerCooldownSec uint `json:"breaker_cooldown_sec"`
+	// StateFilepath stores the payout records in the windows as a json format
+	StateFilepath string `json:"state_filepath"`
+}
+
+type Budget struct {
+	// WindowSec is the rolling window like 3600 for hourly, 86400 for daily or 604800 for weekly
+	WindowSec uint `json:"window_sec"`
+	// MaxWei is the maximum paid wei in the window
+	MaxWei *big.Int `json:"max_wei"`
+}
+
+// AnyToken is the EligibilityRules key which applies to all tokens without their own rule set
+const AnyToken = "*"
+
+type RecipientKind string
+
+const (
+	// AnyRecipient accepts both contracts and EOAs
+	AnyRecipient = RecipientKind("")
+	// EOARecipient accepts the recipients without code only
+	EOARecipient = RecipientKind("eoa")
+	// ContractRecipient accepts the recipients with code only
+	ContractRecipient = RecipientKind("contract")
+)
+
+// EligibilityRules are composable predicates, every non-empty field is a rule and all of them must pass
+type EligibilityRules struct {
+	// MinTransferAmount is the minimum bridged amount in the token's smallest unit
+	MinTransferAmount *big.Int `json:"min_transfer_amount"`
+	// MaxTransferAmount is the maximum bridged amount in the token's smallest unit
+	MaxTransferAmount *big.Int `json:"max_transfer_amount"`
+	// MaxNativeBalanceWei is the maximum native balance of the recipient in wei
+	MaxNativeBalanceWei *big.Int `json:"max_native_balance_wei"`
+	// IsNativeToken tells the bridged amount is already included in the latest native balance
+	// so it will be subtracted before comparing with MaxNativeBalanceWei
+	IsNativeToken bool `json:"is_native_token"`
+	// MaxNonce is the maximum nonce of the recipient
+	MaxNonce *uint64 `json:"max_nonce"`
+	// MinAccountAgeBlocks requires the recipient has a balance or nonce at the given blocks before the transfer
+	MinAccountAgeBlocks uint64 `json:"min_account_age_blocks"`
+	// MaxAccountAgeBlocks requires the recipient has neither balance nor nonce at the given blocks before the transfer
+	MaxAccountAgeBlocks uint64 `json:"max_account_age_blocks"`
+	// RecipientKind limits the recipient to be an "eoa" or a "contract", empty for both
+	RecipientKind RecipientKind `json:"recipient_kind"`
+	// Allowlist only accepts the listed recipient addresses if it's not empty
+	Allowlist []string `json:"allowlist"`
+	// Denylist rejects the listed recipient addresses
+	Denylist []string `json:"denylist"`
 }
 
 const (
 	envGiveawayServicePrivateKey = "GIVEAWAY_SERVICE_PK"
 	envGasfeeServicePrivateKey   = "GASFEE_SERVICE_PK"
+
+	envGiveawayServiceSignerPassphrase = "GIVEAWAY_SERVICE_SIGNER_PASSPHRASE"
+	envGasfeeServiceSignerPassphrase   = "GASFEE_SERVICE_SIGNER_PASSPHRASE"
+	envGiveawayServiceSignerAuthToken  = "GIVEAWAY_SERVICE_SIGNER_AUTH_TOKEN"
+	envGasfeeServiceSignerAuthToken    = "GASFEE_SERVICE_SIGNER_AUTH_TOKEN"
 )
 
 // Load simply loading the config from a json file which is specificed
-// and read the private keys from the env
+// and read the private keys and the signer secrets from the env
 func Load(cmd, filepath string) (*Config, error) {
 	if cmd != "--config" {
 		return nil, errors.New("config expecting a command --config along with the config filepath")
@@ -148,13 +633,134 @@ func Load(cmd, filepath string) (*Config, error) {
 		return nil, fmt.Errorf("config json unmarshal failed: %w", err)
 	}
 
-	if c.GiveawayService != nil {
-		c.GiveawayService.PrivateKey = os.Getenv(envGiveawayServicePrivateKey)
+	names := make(map[string]struct{}, len(c.Networks))
+	for i, n := range c.Networks {
+		if n == nil || !networkNameRe.MatchString(n.Name) {
+			return nil, fmt.Errorf("config network:%d name is a MUST filled field matching %s", i, networkNameRe)
+		}
+		if _, ok := names[n.Name]; ok {
+			return nil, fmt.Errorf("config network name:%q is duplicated", n.Name)
+		}
+		names[n.Name] = struct{}{}
 	}
 
-	if c.GasfeeService != nil {
-		c.GasfeeService.PrivateKey = os.Getenv(envGasfeeServicePrivateKey)
+	if err := c.Admin.loadTokens(); err != nil {
+		return nil, err
+	}
+
+	owners := make(map[string]string)
+	for _, n := range c.AllNetworks() {
+		prefix := ""
+		if n.Name != "" {
+			prefix = strings.ToUpper(strings.ReplaceAll(n.Name, "-", "_")) + "_"
+		}
+
+		if n.GiveawayService != nil {
+			n.GiveawayService.Network = n.Name
+			n.GiveawayService.PrivateKey = os.Getenv(prefix + envGiveawayServicePrivateKey)
+			if n.GiveawayService.Signer != nil {
+				n.GiveawayService.Signer.Passphrase = os.Getenv(prefix + envGiveawayServiceSignerPassphrase)
+				n.GiveawayService.Signer.AuthToken = os.Getenv(prefix + envGiveawayServiceSignerAuthToken)
+			}
+		}
+
+		if n.GasfeeService != nil {
+			n.GasfeeService.Network = n.Name
+			n.GasfeeService.PrivateKey = os.Getenv(prefix + envGasfeeServicePrivateKey)
+			if n.GasfeeService.Signer != nil {
+				n.GasfeeService.Signer.Passphrase = os.Getenv(prefix + envGasfeeServiceSignerPassphrase)
+				n.GasfeeService.Signer.AuthToken = os.Getenv(prefix + envGasfeeServiceSignerAuthToken)
+			}
+		}
+
+		// the state of a service must never be touched by another one, in the same network or not
+		for _, fp := range n.stateFilepaths() {
+			if owner, ok := owners[fp]; ok {
+				if owner == n.Name {
+					return nil, fmt.Errorf("config state filepath:%q is used twice in the network:%q", fp, n.Name)
+				}
+				return nil, fmt.Errorf("config state filepath:%q is shared by the networks:%q and %q", fp, owner, n.Name)
+			}
+			owners[fp] = n.Name
+		}
 	}
 
 	return c, nil
 }
+
+var networkNameRe = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// loadTokens reads the bearer tokens of the operators from the env
+func (a *Admin) loadTokens() error {
+	if a == nil || len(a.Operators) == 0 {
+		return nil
+	}
+
+	a.Tokens = make(map[string]string, len(a.Operators))
+	seen := make(map[string]string, len(a.Operators))
+	for i, name := range a.Operators {
+		if !networkNameRe.MatchString(name) {
+			return fmt.Errorf("config admin operator:%d name is a MUST filled field matching %s", i, networkNameRe)
+		}
+		if _, ok := a.Tokens[name]; ok {
+			return fmt.Errorf("config admin operator:%q is duplicated", name)
+		}
+
+		env := "ADMIN_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_TOKEN"
+		token := os.Getenv(env)
+		if token == "" {
+			return fmt.Errorf("config admin operator:%q token is a MUST filled env %s", name, env)
+		}
+		if other, ok := seen[token]; ok {
+			return fmt.Errorf("config admin operators:%q and %q share a token", other, name)
+		}
+		seen[token] = name
+		a.Tokens[name] = token
+	}
+	return nil
+}
+
+// stateFilepaths returns the state files of the services, the ledger is left out as its records carry the service name
+func (n *Network) stateFilepaths() []string {
+	var fps []string
+	add := func(vs ...string) {
+		for _, v := range vs {
+			if v != "" {
+				fps = append(fps, filepath.Clean(v))
+			}
+		}
+	}
+
+	if g := n.GiveawayService; g != nil {
+		add(g.CurrentGaveWeiFilepath, g.GaveListFilepath, g.CursorFilepath)
+		if g.Limits != nil {
+			add(g.Limits.StateFilepath)
+		}
+		if g.Approval != nil {
+			add(g.Approval.QueueFilepath)
+		}
+		if g.SybilDetection != nil {
+			add(g.SybilDetection.StateFilepath)
+		}
+	}
+
+	if g := n.GasfeeService; g != nil {
+		add(g.RefundedWeiFilepath, g.RefundedListFilepath, g.CurrentBlockNumberFilepath, g.FailedRangesFilepath)
+		if g.RefundSchedule != nil {
+			add(g.RefundSchedule.LastRunFilepath)
+		}
+		for _, campaign := range g.Campaigns {
+			if campaign != nil {
+				add(campaign.RefundedWeiFilepath, campaign.RefundedListFilepath)
+			}
+		}
+		if g.Limits != nil {
+			add(g.Limits.StateFilepath)
+		}
+		if g.Approval != nil {
+			add(g.Approval.QueueFilepath)
+		}
+	}
+
+	return fps
+}
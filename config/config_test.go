@@ -97,3 +97,90 @@ func Test_ReadConfig(t *testing.T) {
 
 	}
 }
+
+func Test_Networks(t *testing.T) {
+	load := func(content string) (*config.Config, error) {
+		f, err := ioutil.TempFile("", "Test_Networks.*.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+
+		if _, err := f.WriteString(content); err != nil {
+			t.Fatal(err)
+		}
+		return config.Load("--config", f.Name())
+	}
+
+	t.Setenv("GASFEE_SERVICE_PK", "top")
+	t.Setenv("BSC_MAIN_GASFEE_SERVICE_PK", "bsc")
+
+	c, err := load(`{
+		"gasfee_service": {"refunded_list_filepath": "./refunded.json"},
+		"networks": [
+			{"name": "bsc-main", "gasfee_service": {"refunded_list_filepath": "./bsc/refunded.json"}},
+			{"name": "findora", "giveaway_service": {"current_gave_wei_filepath": "./findora/gave"}}
+		]
+	}`)
+	assert.NoError(t, err)
+
+	networks := c.AllNetworks()
+	assert.Len(t, networks, 3)
+	assert.Equal(t, "", networks[0].Name)
+	assert.Equal(t, "top", networks[0].GasfeeService.PrivateKey)
+	assert.Equal(t, "bsc-main", networks[1].GasfeeService.Network)
+	assert.Equal(t, "bsc", networks[1].GasfeeService.PrivateKey)
+	assert.Equal(t, "findora", networks[2].GiveawayService.Network)
+	assert.Equal(t, "findora.giveaway", config.Namespaced(networks[2].Name, "giveaway"))
+	assert.Equal(t, "gasfee", config.Namespaced(networks[0].Name, "gasfee"))
+
+	_, err = load(`{"networks": [{"name": "BSC"}]}`)
+	assert.Error(t, err)
+	_, err = load(`{"networks": [{"name": "bsc"}, {"name": "bsc"}]}`)
+	assert.Error(t, err)
+	_, err = load(`{"networks": [
+		{"name": "bsc", "gasfee_service": {"refunded_list_filepath": "./refunded.json"}},
+		{"name": "eth", "gasfee_service": {"refunded_list_filepath": "refunded.json"}}
+	]}`)
+	assert.Error(t, err)
+
+	// the services of the same network never share a state file either
+	_, err = load(`{"networks": [{"name": "bsc",
+		"gasfee_service": {"approval": {"queue_filepath": "./queue.json"}},
+		"giveaway_service": {"approval": {"queue_filepath": "queue.json"}}
+	}]}`)
+	assert.ErrorContains(t, err, "used twice in the network")
+	_, err = load(`{"giveaway_service": {"current_gave_wei_filepath": "./state", "cursor_filepath": "./state"}}`)
+	assert.ErrorContains(t, err, "used twice in the network")
+}
+
+func Test_AdminOperators(t *testing.T) {
+	load := func(content string) (*config.Config, error) {
+		f, err := ioutil.TempFile("", "Test_AdminOperators.*.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+
+		if _, err := f.WriteString(content); err != nil {
+			t.Fatal(err)
+		}
+		return config.Load("--config", f.Name())
+	}
+
+	t.Setenv("ADMIN_ALICE_TOKEN", "a")
+	t.Setenv("ADMIN_BOB_OPS_TOKEN", "b")
+
+	c, err := load(`{"admin": {"listen_address": "0.0.0.0:8080", "operators": ["alice", "bob-ops"]}}`)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"alice": "a", "bob-ops": "b"}, c.Admin.Tokens)
+
+	_, err = load(`{"admin": {"operators": ["carol"]}}`)
+	assert.Error(t, err, "the token is missing in the env")
+	_, err = load(`{"admin": {"operators": ["alice", "alice"]}}`)
+	assert.Error(t, err)
+
+	t.Setenv("ADMIN_BOB_OPS_TOKEN", "a")
+	_, err = load(`{"admin": {"operators": ["alice", "bob-ops"]}}`)
+	assert.Error(t, err, "a token shared by the operators")
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/FindoraNetwork/refunder/config"
 	"github.com/FindoraNetwork/refunder/e2e/gasfee/contract"
 	"github.com/FindoraNetwork/refunder/gasfee"
+	"github.com/FindoraNetwork/refunder/money"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
@@ -43,7 +44,7 @@ type gasfeeTestSuite struct {
 	evmPRCAddress    string
 	gateIOServer     *httptest.Server
 	startBlockNumber uint64
-	baseRate         *big.Float
+	baseRate         *money.Decimal
 }
 
 func TestE2EGasfeeTestSuite(t *testing.T) {
@@ -141,7 +142,8 @@ func (s *gasfeeTestSuite) setupSuiteStartService() {
 	err = ioutil.WriteFile(tmpRefundedList.Name(), []byte("[]"), os.ModeType)
 	s.Require().NoErrorf(err, "ioutil.WriteFile:%v", err)
 
-	baseRate := big.NewFloat((0.00053251 * 0.5) * 1000000000000000000)
+	// (0.00053251 * 0.5) * 10^18 wei
+	baseRate := money.New(266255000000000)
 
 	srv, err := gasfee.New(
 		client.New(&config.Server{
@@ -156,7 +158,7 @@ func (s *gasfeeTestSuite) setupSuiteStartService() {
 			RefunderStartBlockNumber:   s.startBlockNumber,
 			RefunderScrapBlockStep:     200,
 			CrawlerTotalTimeoutSec:     3,
-			RefundThreshold:            big.NewFloat(999.99),    // 999.99 USDT
+			RefundThreshold:            mustParse("999.99"),     // 999.99 USDT
 			RefundMaxCapWei:            big.NewInt(14589226245), // 0.000000014589226245 wei
 			CrawlingAddress:            s.gateIOServer.URL,
 			RefundedWeiFilepath:        tmpRefunded.Name(),
@@ -177,7 +179,7 @@ func (s *gasfeeTestSuite) setupSuiteStartService() {
 					TokenAddress: s.tokenAddr.String(),
 				},
 			},
-		})
+		}, nil)
 	s.Require().NoErrorf(err, "gasfee.New:%v", err)
 	s.serv = srv
 	s.baseRate = baseRate
@@ -209,13 +211,12 @@ func (s *gasfeeTestSuite) Test_E2E_Gasfee() {
 	s.Require().NoErrorf(err, "ethclient.DialContext:%v", err)
 
 	// at mock gate.io server the Highest price of FRA_USDT
-	fraPrice := big.NewFloat(0.0198)
+	fraPrice := mustParse("0.0198")
 	// at mock gate.io server the Lowest price of DEMO_USDT
-	demoPrice := big.NewFloat(361.3522)
-	// 361.3522 / 0.0198 = 18250.1111111
-	fluctuation := fraPrice.Quo(demoPrice, fraPrice)
-	// wantBalance = 18250.1111111 * 266255000000000 = 4859183333890000000 wei
-	wantBalance, _ := big.NewFloat(0).Mul(s.baseRate, fluctuation).Int(nil)
+	demoPrice := mustParse("361.3522")
+	// wantBalance = 266255000000000 * 361.3522 / 0.0198 = 4859183333888888888.88 wei truncated
+	wantBalance := s.baseRate.Mul(demoPrice).Quo(fraPrice).Int()
+	s.Require().Equal("4859183333888888888", wantBalance.String())
 	// 3 tokens of DEMO * 361.3522 USDT == 1084.0566 USDT
 	mint3tokens := big.NewInt(3000000)
 	type want struct {
@@ -324,3 +325,11 @@ func (s *gasfeeTestSuite) Test_E2E_Gasfee() {
 		)
 	}
 }
+
+func mustParse(s string) *money.Decimal {
+	d, err := money.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
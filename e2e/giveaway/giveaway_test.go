@@ -84,7 +84,7 @@ func (s *giveawayTestSuite) setupSuiteStartService() {
 			MaxCapWei:              s.maxCapWei,
 			TokenAddresses:         []string{s.tokenAddr.String()},
 			CurrentGaveWeiFilepath: tempF.Name(),
-		})
+		}, nil)
 	s.Require().NoErrorf(err, "giveaway.New:%v", err)
 
 	s.serv = srv
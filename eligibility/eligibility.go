@@ -0,0 +1,352 @@
+package eligibility
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/FindoraNetwork/refunder/client"
+	"github.com/FindoraNetwork/refunder/config"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Candidate is a recipient waiting for the eligibility checking
+// the on-chain states are fetched lazily and cached, so each of them is queried once only
+type Candidate struct {
+	Token       common.Address
+	Recipient   common.Address
+	Amount      *big.Int
+	BlockNumber uint64
+
+	balance *big.Int
+	nonce   *uint64
+	code    []byte
+}
+
+func (c *Candidate) nativeBalance(ctx context.Context, cli client.Client) (*big.Int, error) {
+	if c.balance == nil {
+		// there has an issue if specific the blockNumber
+		// BalanceAt failed: block number: 200408 exceeds version range: 1..200407
+		// so use latest blockNumber
+		v, err := cli.BalanceAt(ctx, c.Recipient, nil)
+		if err != nil {
+			return nil, fmt.Errorf("BalanceAt failed:%w, to_address:%s", err, c.Recipient)
+		}
+		c.balance = v
+	}
+	return c.balance, nil
+}
+
+func (c *Candidate) latestNonce(ctx context.Context, cli client.Client) (uint64, error) {
+	if c.nonce == nil {
+		v, err := cli.NonceAt(ctx, c.Recipient, nil)
+		if err != nil {
+			return 0, fmt.Errorf("NonceAt failed:%w, to_address:%s", err, c.Recipient)
+		}
+		c.nonce = &v
+	}
+	return *c.nonce, nil
+}
+
+func (c *Candidate) latestCode(ctx context.Context, cli client.Client) ([]byte, error) {
+	if c.code == nil {
+		v, err := cli.CodeAt(ctx, c.Recipient, nil)
+		if err != nil {
+			return nil, fmt.Errorf("CodeAt failed:%w, to_address:%s", err, c.Recipient)
+		}
+		c.code = append([]byte{}, v...)
+	}
+	return c.code, nil
+}
+
+// existedAt tells the recipient has any balance or nonce at the given blocks before the transfer
+func (c *Candidate) existedAt(ctx context.Context, cli client.Client, blocksBefore uint64) (bool, error) {
+	if blocksBefore >= c.BlockNumber {
+		return false, nil
+	}
+	at := big.NewInt(0).SetUint64(c.BlockNumber - blocksBefore)
+
+	balance, err := cli.BalanceAt(ctx, c.Recipient, at)
+	if err != nil {
+		return false, fmt.Errorf("BalanceAt failed:%w, to_address:%s, block_number:%s", err, c.Recipient, at)
+	}
+	if balance.Sign() > 0 {
+		return true, nil
+	}
+
+	nonce, err := cli.NonceAt(ctx, c.Recipient, at)
+	if err != nil {
+		return false, fmt.Errorf("NonceAt failed:%w, to_address:%s, block_number:%s", err, c.Recipient, at)
+	}
+	return nonce > 0, nil
+}
+
+// Rejection describes which rule a candidate failed on
+type Rejection struct {
+	Rule   string
+	Detail string
+}
+
+func (r *Rejection) String() string {
+	return fmt.Sprintf("rule:%s, detail:%s", r.Rule, r.Detail)
+}
+
+// Rule is a single predicate, it returns a nil Rejection when the candidate passes
+type Rule struct {
+	Name  string
+	Check func(ctx context.Context, cli client.Client, c *Candidate) (*Rejection, error)
+}
+
+func (r Rule) reject(format string, args ...interface{}) *Rejection {
+	return &Rejection{Rule: r.Name, Detail: fmt.Sprintf(format, args...)}
+}
+
+// Rules is a composed rule set, all rules must pass in order
+type Rules []Rule
+
+// Check runs the rules in order and stops at the first rejection or error
+func (rs Rules) Check(ctx context.Context, cli client.Client, c *Candidate) (*Rejection, error) {
+	for _, r := range rs {
+		rej, err := r.Check(ctx, cli, c)
+		if err != nil {
+			return nil, fmt.Errorf("eligibility rule:%s failed:%w", r.Name, err)
+		}
+		if rej != nil {
+			return rej, nil
+		}
+	}
+	return nil, nil
+}
+
+// Default is the original condition: balance(address) == 0 and nonce(address) == 0
+func Default() Rules {
+	return defaults(false)
+}
+
+// defaults is the Default, the bridged amount of a native token is already in the balance, so it's subtracted before the comparing
+func defaults(isNativeToken bool) Rules {
+	zero := uint64(0)
+	return New(&config.EligibilityRules{MaxNativeBalanceWei: big.NewInt(0), IsNativeToken: isNativeToken, MaxNonce: &zero})
+}
+
+// New composes the rule set from the config, the cheap rules are placed before the ones querying the chain
+func New(conf *config.EligibilityRules) Rules {
+	var rs Rules
+
+	if len(conf.Denylist) > 0 {
+		rs = append(rs, Denylist(conf.Denylist))
+	}
+	if len(conf.Allowlist) > 0 {
+		rs = append(rs, Allowlist(conf.Allowlist))
+	}
+	if conf.MinTransferAmount != nil {
+		rs = append(rs, MinTransferAmount(conf.MinTransferAmount))
+	}
+	if conf.MaxTransferAmount != nil {
+		rs = append(rs, MaxTransferAmount(conf.MaxTransferAmount))
+	}
+	if conf.MaxNativeBalanceWei != nil {
+		rs = append(rs, MaxNativeBalance(conf.MaxNativeBalanceWei, conf.IsNativeToken))
+	}
+	if conf.MaxNonce != nil {
+		rs = append(rs, MaxNonce(*conf.MaxNonce))
+	}
+	if conf.RecipientKind != config.AnyRecipient {
+		rs = append(rs, Kind(conf.RecipientKind))
+	}
+	if conf.MinAccountAgeBlocks > 0 {
+		rs = append(rs, MinAccountAge(conf.MinAccountAgeBlocks))
+	}
+	if conf.MaxAccountAgeBlocks > 0 {
+		rs = append(rs, MaxAccountAge(conf.MaxAccountAgeBlocks))
+	}
+
+	return rs
+}
+
+// ByToken maps the token addresses to their own rule set, with a fallback for the others
+type ByToken struct {
+	rules    map[common.Address]Rules
+	fallback Rules
+}
+
+// NewByToken builds rule sets from the config which is keyed by token address or config.AnyToken
+// it falls back to Default if neither the token nor config.AnyToken has been configured,
+// the native is the key of the native token transferred by the native trigger, nil for none, its Default subtracts the bridged amount
+func NewByToken(confs map[string]*config.EligibilityRules, native *common.Address) *ByToken {
+	b := &ByToken{rules: make(map[common.Address]Rules), fallback: Default()}
+	anyToken := false
+	for k, conf := range confs {
+		if strings.TrimSpace(k) == config.AnyToken {
+			b.fallback, anyToken = New(conf), true
+			continue
+		}
+		b.rules[common.HexToAddress(k)] = New(conf)
+	}
+
+	if native != nil && !anyToken {
+		if _, ok := b.rules[*native]; !ok {
+			b.rules[*native] = defaults(true)
+		}
+	}
+	return b
+}
+
+// Get returns the rule set of the token
+func (b *ByToken) Get(token common.Address) Rules {
+	if rs, ok := b.rules[token]; ok {
+		return rs
+	}
+	return b.fallback
+}
+
+func toSet(addresses []string) map[common.Address]struct{} {
+	set := make(map[common.Address]struct{}, len(addresses))
+	for _, addr := range addresses {
+		set[common.HexToAddress(addr)] = struct{}{}
+	}
+	return set
+}
+
+// Denylist rejects the listed recipients
+func Denylist(addresses []string) Rule {
+	set := toSet(addresses)
+	r := Rule{Name: "denylist"}
+	r.Check = func(_ context.Context, _ client.Client, c *Candidate) (*Rejection, error) {
+		if _, ok := set[c.Recipient]; ok {
+			return r.reject("to_address:%s is denied", c.Recipient), nil
+		}
+		return nil, nil
+	}
+	return r
+}
+
+// Allowlist accepts the listed recipients only
+func Allowlist(addresses []string) Rule {
+	set := toSet(addresses)
+	r := Rule{Name: "allowlist"}
+	r.Check = func(_ context.Context, _ client.Client, c *Candidate) (*Rejection, error) {
+		if _, ok := set[c.Recipient]; !ok {
+			return r.reject("to_address:%s is not allowed", c.Recipient), nil
+		}
+		return nil, nil
+	}
+	return r
+}
+
+// MinTransferAmount rejects the transfers under the amount
+func MinTransferAmount(min *big.Int) Rule {
+	r := Rule{Name: "min_transfer_amount"}
+	r.Check = func(_ context.Context, _ client.Client, c *Candidate) (*Rejection, error) {
+		if c.Amount.Cmp(min) < 0 {
+			return r.reject("amount:%s < min:%s", c.Amount, min), nil
+		}
+		return nil, nil
+	}
+	return r
+}
+
+// MaxTransferAmount rejects the transfers over the amount
+func MaxTransferAmount(max *big.Int) Rule {
+	r := Rule{Name: "max_transfer_amount"}
+	r.Check = func(_ context.Context, _ client.Client, c *Candidate) (*Rejection, error) {
+		if c.Amount.Cmp(max) > 0 {
+			return r.reject("amount:%s > max:%s", c.Amount, max), nil
+		}
+		return nil, nil
+	}
+	return r
+}
+
+// MaxNativeBalance rejects the recipients holding more native token than max
+// if isNativeToken is true, the bridged amount is subtracted from the latest balance first
+func MaxNativeBalance(max *big.Int, isNativeToken bool) Rule {
+	r := Rule{Name: "max_native_balance"}
+	r.Check = func(ctx context.Context, cli client.Client, c *Candidate) (*Rejection, error) {
+		balance, err := c.nativeBalance(ctx, cli)
+		if err != nil {
+			return nil, err
+		}
+
+		before := big.NewInt(0).Set(balance)
+		if isNativeToken {
+			before.Sub(before, c.Amount)
+		}
+		if before.Cmp(max) > 0 {
+			return r.reject("balance:%s > max:%s", before, max), nil
+		}
+		return nil, nil
+	}
+	return r
+}
+
+// MaxNonce rejects the recipients whose nonce is over max
+func MaxNonce(max uint64) Rule {
+	r := Rule{Name: "max_nonce"}
+	r.Check = func(ctx context.Context, cli client.Client, c *Candidate) (*Rejection, error) {
+		nonce, err := c.latestNonce(ctx, cli)
+		if err != nil {
+			return nil, err
+		}
+		if nonce > max {
+			return r.reject("nonce:%d > max:%d", nonce, max), nil
+		}
+		return nil, nil
+	}
+	return r
+}
+
+// Kind rejects the recipients which are not the expected kind
+func Kind(kind config.RecipientKind) Rule {
+	r := Rule{Name: "recipient_kind"}
+	r.Check = func(ctx context.Context, cli client.Client, c *Candidate) (*Rejection, error) {
+		code, err := c.latestCode(ctx, cli)
+		if err != nil {
+			return nil, err
+		}
+
+		got := config.EOARecipient
+		if len(code) > 0 {
+			got = config.ContractRecipient
+		}
+		if got != kind {
+			return r.reject("to_address:%s is %s, want:%s", c.Recipient, got, kind), nil
+		}
+		return nil, nil
+	}
+	return r
+}
+
+// MinAccountAge rejects the recipients which did not exist at the given blocks before the transfer
+func MinAccountAge(blocks uint64) Rule {
+	r := Rule{Name: "min_account_age"}
+	r.Check = func(ctx context.Context, cli client.Client, c *Candidate) (*Rejection, error) {
+		existed, err := c.existedAt(ctx, cli, blocks)
+		if err != nil {
+			return nil, err
+		}
+		if !existed {
+			return r.reject("to_address:%s is younger than %d blocks", c.Recipient, blocks), nil
+		}
+		return nil, nil
+	}
+	return r
+}
+
+// MaxAccountAge rejects the recipients which already existed at the given blocks before the transfer
+func MaxAccountAge(blocks uint64) Rule {
+	r := Rule{Name: "max_account_age"}
+	r.Check = func(ctx context.Context, cli client.Client, c *Candidate) (*Rejection, error) {
+		existed, err := c.existedAt(ctx, cli, blocks)
+		if err != nil {
+			return nil, err
+		}
+		if existed {
+			return r.reject("to_address:%s is older than %d blocks", c.Recipient, blocks), nil
+		}
+		return nil, nil
+	}
+	return r
+}
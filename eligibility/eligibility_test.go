@@ -0,0 +1,202 @@
+package eligibility_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/FindoraNetwork/refunder/client"
+	"github.com/FindoraNetwork/refunder/config"
+	"github.com/FindoraNetwork/refunder/eligibility"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	rich     = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	fresh    = common.HexToAddress("0x1000000000000000000000000000000000000002")
+	token    = common.HexToAddress("0x49C86Ee3Aca6ADE64127FA170445cd0B97CBBd4c")
+	deployer common.Address
+	contract common.Address
+)
+
+func setup(t *testing.T) client.Client {
+	priv, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployer = crypto.PubkeyToAddress(priv.PublicKey)
+
+	sim := backends.NewSimulatedBackend(core.GenesisAlloc{
+		deployer: {Balance: big.NewInt(1000000000000000000)},
+		rich:     {Balance: big.NewInt(5000)},
+	}, uint64(4712388))
+
+	ctx := context.Background()
+	gasPrice, err := sim.SuggestGasPrice(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// PUSH1 0x01 PUSH1 0x00 RETURN, deploys a single byte runtime code
+	tx, err := types.SignTx(
+		types.NewContractCreation(0, big.NewInt(0), uint64(100000), gasPrice, common.FromHex("0x60016000f3")),
+		types.HomesteadSigner{},
+		priv,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sim.SendTransaction(ctx, tx); err != nil {
+		t.Fatal(err)
+	}
+	sim.Commit()
+	contract = crypto.CreateAddress(deployer, 0)
+
+	return &client.MockClient{Client: sim}
+}
+
+func Test_Rules(t *testing.T) {
+	c := setup(t)
+	zero := uint64(0)
+
+	tests := []struct {
+		name      string
+		conf      *config.EligibilityRules
+		candidate *eligibility.Candidate
+		wantRule  string
+	}{
+		{
+			name:      "empty rules",
+			conf:      &config.EligibilityRules{},
+			candidate: &eligibility.Candidate{Recipient: rich, Amount: big.NewInt(1)},
+		},
+		{
+			name:      "denied",
+			conf:      &config.EligibilityRules{Denylist: []string{fresh.String()}},
+			candidate: &eligibility.Candidate{Recipient: fresh, Amount: big.NewInt(1)},
+			wantRule:  "denylist",
+		},
+		{
+			name:      "not allowed",
+			conf:      &config.EligibilityRules{Allowlist: []string{rich.String()}},
+			candidate: &eligibility.Candidate{Recipient: fresh, Amount: big.NewInt(1)},
+			wantRule:  "allowlist",
+		},
+		{
+			name:      "under min transfer amount",
+			conf:      &config.EligibilityRules{MinTransferAmount: big.NewInt(10)},
+			candidate: &eligibility.Candidate{Recipient: fresh, Amount: big.NewInt(9)},
+			wantRule:  "min_transfer_amount",
+		},
+		{
+			name:      "over max transfer amount",
+			conf:      &config.EligibilityRules{MaxTransferAmount: big.NewInt(10)},
+			candidate: &eligibility.Candidate{Recipient: fresh, Amount: big.NewInt(11)},
+			wantRule:  "max_transfer_amount",
+		},
+		{
+			name:      "over max native balance",
+			conf:      &config.EligibilityRules{MaxNativeBalanceWei: big.NewInt(0)},
+			candidate: &eligibility.Candidate{Recipient: rich, Amount: big.NewInt(1)},
+			wantRule:  "max_native_balance",
+		},
+		{
+			name:      "native token transfer is excluded from the balance",
+			conf:      &config.EligibilityRules{MaxNativeBalanceWei: big.NewInt(0), IsNativeToken: true},
+			candidate: &eligibility.Candidate{Recipient: rich, Amount: big.NewInt(5000)},
+		},
+		{
+			name:      "over max nonce",
+			conf:      &config.EligibilityRules{MaxNonce: &zero},
+			candidate: &eligibility.Candidate{Recipient: deployer, Amount: big.NewInt(1)},
+			wantRule:  "max_nonce",
+		},
+		{
+			name:      "eoa only",
+			conf:      &config.EligibilityRules{RecipientKind: config.EOARecipient},
+			candidate: &eligibility.Candidate{Recipient: contract, Amount: big.NewInt(1)},
+			wantRule:  "recipient_kind",
+		},
+		{
+			name:      "contract only",
+			conf:      &config.EligibilityRules{RecipientKind: config.ContractRecipient},
+			candidate: &eligibility.Candidate{Recipient: fresh, Amount: big.NewInt(1)},
+			wantRule:  "recipient_kind",
+		},
+		{
+			name:      "default rules pass a fresh address",
+			candidate: &eligibility.Candidate{Recipient: fresh, Amount: big.NewInt(1)},
+		},
+		{
+			name:      "default rules reject a funded address",
+			candidate: &eligibility.Candidate{Recipient: rich, Amount: big.NewInt(1)},
+			wantRule:  "max_native_balance",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			rules := eligibility.Default()
+			if tt.conf != nil {
+				rules = eligibility.New(tt.conf)
+			}
+
+			got, err := rules.Check(context.Background(), c, tt.candidate)
+			assert.NoError(t, err)
+			if tt.wantRule == "" {
+				assert.Nil(t, got)
+			} else if assert.NotNil(t, got) {
+				assert.Equal(t, tt.wantRule, got.Rule)
+			}
+		})
+	}
+}
+
+func Test_ByToken(t *testing.T) {
+	other := common.HexToAddress("0x0000000000000000000000000000000000001000")
+
+	b := eligibility.NewByToken(map[string]*config.EligibilityRules{
+		token.String():  {MinTransferAmount: big.NewInt(10)},
+		config.AnyToken: {MaxTransferAmount: big.NewInt(10)},
+	}, nil)
+	assert.Equal(t, "min_transfer_amount", b.Get(token)[0].Name)
+	assert.Equal(t, "max_transfer_amount", b.Get(other)[0].Name)
+
+	b = eligibility.NewByToken(nil, nil)
+	assert.Len(t, b.Get(token), 2)
+}
+
+func Test_ByTokenNative(t *testing.T) {
+	c := setup(t)
+	ctx := context.Background()
+	native := common.Address{}
+
+	// the Default of the native token subtracts the bridged amount already in the balance
+	b := eligibility.NewByToken(nil, &native)
+	rejection, err := b.Get(native).Check(ctx, c, &eligibility.Candidate{Token: native, Recipient: rich, Amount: big.NewInt(5000)})
+	assert.NoError(t, err)
+	assert.Nil(t, rejection, "a fresh recipient credited by the native transfer passes")
+	rejection, err = b.Get(native).Check(ctx, c, &eligibility.Candidate{Token: native, Recipient: rich, Amount: big.NewInt(4999)})
+	assert.NoError(t, err)
+	if assert.NotNil(t, rejection) {
+		assert.Equal(t, "max_native_balance", rejection.Rule)
+	}
+	rejection, err = b.Get(token).Check(ctx, c, &eligibility.Candidate{Token: token, Recipient: rich, Amount: big.NewInt(5000)})
+	assert.NoError(t, err)
+	assert.NotNil(t, rejection, "the other tokens keep the Default")
+
+	// the configured rules are kept as they are
+	b = eligibility.NewByToken(map[string]*config.EligibilityRules{
+		config.AnyToken: {MaxNativeBalanceWei: big.NewInt(0)},
+	}, &native)
+	rejection, err = b.Get(native).Check(ctx, c, &eligibility.Candidate{Token: native, Recipient: rich, Amount: big.NewInt(5000)})
+	assert.NoError(t, err)
+	assert.NotNil(t, rejection)
+}
@@ -0,0 +1,78 @@
+package gasfee
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/balance"
+	"github.com/FindoraNetwork/refunder/client"
+	"github.com/FindoraNetwork/refunder/ledger"
+	"github.com/FindoraNetwork/refunder/report"
+)
+
+// ErrBatched tells the refund is waiting in the batch, it's reported once the batch is sent
+var ErrBatched = errors.New("refund waiting in the batch")
+
+// pending is a refund waiting in the batch of a run
+type pending struct {
+	run     *campaignRun
+	rec     *ledger.Record
+	entry   *report.Entry
+	release func()
+}
+
+// enqueue puts the refund into the batch, the cap and the limits count it until it's sent or failed
+func (s *Service) enqueue(run *campaignRun, rec *ledger.Record, entry *report.Entry) *pending {
+	run.pend(rec.Recipient, rec.Wei)
+	return &pending{
+		run:     run,
+		rec:     rec,
+		entry:   entry,
+		release: s.limits.Reserve(time.Now(), rec.Token, rec.Recipient, rec.Wei),
+	}
+}
+
+// sendBatch sends the refunds waiting in the batch by a single multisend, a failed batch falls back to the refunds one by one,
+// the entries are reported with the results, and the errors of the failed refunds are returned
+func (s *Service) sendBatch(ctx context.Context, c client.Client, items []*pending) ([]string, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	recs := make([]*ledger.Record, 0, len(items))
+	for _, item := range items {
+		recs = append(recs, item.rec)
+	}
+	results := s.sender.SendBatch(ctx, c, recs, s.settle)
+	for _, item := range items {
+		item.release()
+		item.run.unpend(item.rec.Recipient, item.rec.Wei)
+	}
+
+	var errs []string
+	var stopErr error
+	for i, item := range items {
+		r := results[i]
+		if r.Err != nil {
+			err := fmt.Errorf("refunder %w, tx_hash:%s, addr:%s", r.Err, item.rec.SourceTxHash, item.rec.Token)
+			item.entry.Status, item.entry.Reason = report.Failed, err.Error()
+			item.run.rep.Add(item.entry)
+			errs = append(errs, err.Error())
+			if errors.Is(err, balance.ErrPaused) {
+				stopErr = err
+			}
+			continue
+		}
+
+		s.stdoutlogger.Printf(`refunder success, campaign:%q, to_address:%s, tx_hash:%s, token_address:%s, refund_tx_hash:%s, refund_value:%s, refunded_wei:%s`,
+			item.run.name, item.rec.Recipient, item.rec.SourceTxHash, item.rec.Token, r.Tx.Hash(), item.rec.Wei, r.Total,
+		)
+		refundTxHash := r.Tx.Hash()
+		item.entry.RefundTxHash = &refundTxHash
+		item.run.markRefunded(item.rec.Recipient)
+		item.run.rep.Add(item.entry)
+	}
+	return errs, stopErr
+}
@@ -0,0 +1,295 @@
+package gasfee
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sync"
+
+	"github.com/FindoraNetwork/refunder/config"
+	"github.com/FindoraNetwork/refunder/money"
+	"github.com/FindoraNetwork/refunder/report"
+	"github.com/FindoraNetwork/refunder/window"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// campaign is a set of refunding parameters with its own dedup list, cap and report
+type campaign struct {
+	// name is empty for the single campaign built from the service config
+	name                 string
+	reportName           string
+	tokens               map[common.Address]struct{}
+	threshold            *money.Decimal
+	baseRate             *money.Decimal
+	maxUsdt              *money.Decimal
+	maxCapWei            *big.Int
+	refundedWeiFilepath  string
+	refundedListFilepath string
+	window               *window.Window
+	report               *report.Exporter
+	// listMux guards the refunded list file, written by the runs and the approval decisions
+	listMux sync.Mutex
+}
+
+func newCampaigns(name string, conf *config.GasfeeService, mapper map[common.Address]*crawlingMate, exporter *report.Exporter) ([]*campaign, error) {
+	if len(conf.Campaigns) == 0 {
+		return []*campaign{{
+			reportName:           name,
+			threshold:            conf.RefundThreshold,
+			baseRate:             conf.RefundBaseRateWei,
+			maxUsdt:              conf.RefundMaxUsdtEach,
+			maxCapWei:            conf.RefundMaxCapWei,
+			refundedWeiFilepath:  conf.RefundedWeiFilepath,
+			refundedListFilepath: conf.RefundedListFilepath,
+			report:               exporter,
+		}}, nil
+	}
+
+	names := make(map[string]struct{}, len(conf.Campaigns))
+	campaigns := make([]*campaign, 0, len(conf.Campaigns))
+	for i, cc := range conf.Campaigns {
+		if cc == nil || cc.Name == "" {
+			return nil, fmt.Errorf("campaign:%d name is a MUST filled field", i)
+		}
+		if _, ok := names[cc.Name]; ok {
+			return nil, fmt.Errorf("campaign name:%q is duplicated", cc.Name)
+		}
+		names[cc.Name] = struct{}{}
+
+		if cc.RefundedWeiFilepath == "" || cc.RefundedListFilepath == "" {
+			return nil, fmt.Errorf("campaign:%q refunded_wei_filepath and refunded_list_filepath are MUST filled fields", cc.Name)
+		}
+
+		c := &campaign{
+			name:                 cc.Name,
+			reportName:           name + "." + cc.Name,
+			tokens:               make(map[common.Address]struct{}, len(cc.TokenAddresses)),
+			threshold:            conf.RefundThreshold,
+			baseRate:             conf.RefundBaseRateWei,
+			maxUsdt:              conf.RefundMaxUsdtEach,
+			maxCapWei:            cc.RefundMaxCapWei,
+			refundedWeiFilepath:  cc.RefundedWeiFilepath,
+			refundedListFilepath: cc.RefundedListFilepath,
+			window:               window.New(cc.Window),
+			report:               exporter,
+		}
+		if cc.RefundThreshold != nil {
+			c.threshold = cc.RefundThreshold
+		}
+		if cc.RefundBaseRateWei != nil {
+			c.baseRate = cc.RefundBaseRateWei
+		}
+		if cc.RefundMaxUsdtEach != nil {
+			c.maxUsdt = cc.RefundMaxUsdtEach
+		}
+		if cc.Report != nil {
+			e, err := report.NewExporter(cc.Report)
+			if err != nil {
+				return nil, fmt.Errorf("campaign:%q report failed:%w", cc.Name, err)
+			}
+			c.report = e
+		}
+
+		for _, address := range cc.TokenAddresses {
+			token := common.HexToAddress(address)
+			if _, ok := mapper[token]; !ok {
+				return nil, fmt.Errorf("campaign:%q token_address:%s is not in the crawling_mapper", cc.Name, token)
+			}
+			c.tokens[token] = struct{}{}
+		}
+
+		campaigns = append(campaigns, c)
+	}
+
+	return campaigns, nil
+}
+
+// covers tells the campaign refunds the token
+func (c *campaign) covers(token common.Address) bool {
+	if len(c.tokens) == 0 {
+		return true
+	}
+	_, ok := c.tokens[token]
+	return ok
+}
+
+// refundedWei reads the refunded wei of the campaign, a missing file means nothing refunded yet
+func (c *campaign) refundedWei() (*big.Int, error) {
+	b, err := ioutil.ReadFile(c.refundedWeiFilepath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read file:%q failed:%w", c.refundedWeiFilepath, err)
+	}
+	return big.NewInt(0).SetBytes(b), nil
+}
+
+// addRefundedWei adds the value into the refunded wei of the campaign and returns the sum
+func (c *campaign) addRefundedWei(v *big.Int) (*big.Int, error) {
+	refundedWei, err := c.refundedWei()
+	if err != nil {
+		return nil, err
+	}
+
+	refundedWei.Add(refundedWei, v)
+	if err := ioutil.WriteFile(c.refundedWeiFilepath, refundedWei.Bytes(), 0o600); err != nil {
+		return nil, fmt.Errorf("write file:%q failed:%w", c.refundedWeiFilepath, err)
+	}
+	return refundedWei, nil
+}
+
+// capReached tells the refunded wei reaches the cap of the campaign
+func (c *campaign) capReached(refundedWei *big.Int) bool {
+	return c.maxCapWei != nil && refundedWei.Cmp(c.maxCapWei) >= 0
+}
+
+// campaignRun is the state of a campaign during a refunder run
+type campaignRun struct {
+	*campaign
+	refundedList []string
+	refundedMap  map[string]struct{}
+	// added are the recipients refunded in the run, merged into the refunded list file once it's done
+	added      []string
+	rep        *report.Report
+	capReached bool
+	// pending are the recipients waiting in a batch, and pendingWei is the sum of them
+	pending    map[string]struct{}
+	pendingWei *big.Int
+}
+
+func (c *campaign) newRun(rep *report.Report) (*campaignRun, error) {
+	c.listMux.Lock()
+	list, err := c.readRefundedList()
+	c.listMux.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	run := &campaignRun{
+		campaign:     c,
+		refundedList: list,
+		refundedMap:  make(map[string]struct{}, len(list)),
+		rep:          rep,
+		pending:      make(map[string]struct{}),
+		pendingWei:   big.NewInt(0),
+	}
+	for _, addr := range run.refundedList {
+		run.refundedMap[addr] = struct{}{}
+	}
+	return run, nil
+}
+
+// readRefundedList reads the refunded list of the campaign, a missing file means nobody refunded yet
+func (c *campaign) readRefundedList() ([]string, error) {
+	list := []string{}
+	b, err := ioutil.ReadFile(c.refundedListFilepath)
+	if errors.Is(err, os.ErrNotExist) {
+		return list, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read file:%q failed:%w", c.refundedListFilepath, err)
+	}
+
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, fmt.Errorf("json unmarshal refunded list:%q failed:%w", c.refundedListFilepath, err)
+	}
+	return list, nil
+}
+
+// writeRefundedList writes the refunded list of the campaign
+func (c *campaign) writeRefundedList(list []string) error {
+	b, err := json.Marshal(list)
+	if err != nil {
+		return fmt.Errorf("json marshal refunded list failed:%w", err)
+	}
+
+	if err := ioutil.WriteFile(c.refundedListFilepath, b, 0o600); err != nil {
+		return fmt.Errorf("write file:%q failed:%w", c.refundedListFilepath, err)
+	}
+	return nil
+}
+
+// mergeRefunded adds the recipients missing in the refunded list file
+func (c *campaign) mergeRefunded(addrs ...string) error {
+	c.listMux.Lock()
+	defer c.listMux.Unlock()
+
+	list, err := c.readRefundedList()
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]struct{}, len(list))
+	for _, addr := range list {
+		seen[addr] = struct{}{}
+	}
+	for _, addr := range addrs {
+		if _, ok := seen[addr]; !ok {
+			seen[addr] = struct{}{}
+			list = append(list, addr)
+		}
+	}
+	return c.writeRefundedList(list)
+}
+
+// addRefunded adds the recipient paid out of a run, like the approved one, into the refunded list file
+func (c *campaign) addRefunded(toAddr common.Address) error {
+	return c.mergeRefunded(toAddr.String())
+}
+
+// dropRefunded removes the recipient from the refunded list file
+func (c *campaign) dropRefunded(toAddr common.Address) error {
+	c.listMux.Lock()
+	defer c.listMux.Unlock()
+
+	list, err := c.readRefundedList()
+	if err != nil {
+		return err
+	}
+
+	kept := list[:0]
+	for _, addr := range list {
+		if addr != toAddr.String() {
+			kept = append(kept, addr)
+		}
+	}
+	if len(kept) == len(list) {
+		return nil
+	}
+	return c.writeRefundedList(kept)
+}
+
+func (r *campaignRun) refunded(toAddr common.Address) bool {
+	_, ok := r.refundedMap[toAddr.String()]
+	_, pending := r.pending[toAddr.String()]
+	return ok || pending
+}
+
+// pend puts the refund into the batch, it's counted in the cap until it's sent or failed
+func (r *campaignRun) pend(toAddr common.Address, wei *big.Int) {
+	r.pending[toAddr.String()] = struct{}{}
+	r.pendingWei.Add(r.pendingWei, wei)
+}
+
+func (r *campaignRun) unpend(toAddr common.Address, wei *big.Int) {
+	delete(r.pending, toAddr.String())
+	r.pendingWei.Sub(r.pendingWei, wei)
+}
+
+func (r *campaignRun) markRefunded(toAddr common.Address) {
+	r.refundedList = append(r.refundedList, toAddr.String())
+	r.refundedMap[toAddr.String()] = struct{}{}
+	r.added = append(r.added, toAddr.String())
+}
+
+// saveRefundedList merges the recipients refunded in the run into the refunded list file,
+// so the ones approved or rejected meanwhile are kept
+func (r *campaignRun) saveRefundedList() error {
+	if err := r.mergeRefunded(r.added...); err != nil {
+		return err
+	}
+	r.added = nil
+	return nil
+}
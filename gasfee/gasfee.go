@@ -2,57 +2,72 @@ package gasfee
 
 import (
 	"context"
-	"crypto/ecdsa"
 	"encoding/binary"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"math"
 	"math/big"
-	"net/http"
 	"os"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/FindoraNetwork/refunder/approval"
+	"github.com/FindoraNetwork/refunder/balance"
+	"github.com/FindoraNetwork/refunder/budget"
 	"github.com/FindoraNetwork/refunder/client"
 	"github.com/FindoraNetwork/refunder/config"
+	"github.com/FindoraNetwork/refunder/indexer"
+	"github.com/FindoraNetwork/refunder/ledger"
+	"github.com/FindoraNetwork/refunder/money"
+	"github.com/FindoraNetwork/refunder/notifier"
+	"github.com/FindoraNetwork/refunder/payout"
+	"github.com/FindoraNetwork/refunder/price"
+	"github.com/FindoraNetwork/refunder/report"
+	"github.com/FindoraNetwork/refunder/schedule"
+	"github.com/FindoraNetwork/refunder/signer"
+	"github.com/FindoraNetwork/refunder/window"
 
-	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 )
 
 type Service struct {
+	// name is the service name qualified by the network name
+	name                   string
 	client                 client.Client
 	stdoutlogger           *log.Logger
 	stderrlogger           *log.Logger
-	privateKey             *ecdsa.PrivateKey
+	sender                 *payout.Sender
+	payer                  *payout.Payer
+	batcher                *payout.Batcher
+	gas                    *payout.Gas
+	balanceRule            *balanceRule
 	fromAddress            common.Address
 	done                   chan struct{}
 	crawlerTick            *time.Ticker
 	refundTick             *refundTicker
-	filterQuery            ethereum.FilterQuery
+	lastRun                *schedule.LastRun
+	confirmations          uint64
+	indexer                *indexer.Indexer
+	failedRanges           *failedRanges
 	refunderTimeout        time.Duration
 	crawlerTimeout         time.Duration
 	curBlockNumberFilepath string
-	refundThreshold        *big.Float
-	refundMaxCapWei        *big.Int
-	refundedWeiFilepath    string
-	refundedListFilepath   string
+	campaigns              []*campaign
 	prices                 *prices
-	crawlingAddr           string
+	priceSource            *price.GateIO
 	numerator              common.Address
 	denominator            common.Address
 	mapper                 map[common.Address]*crawlingMate
-	blockInterval          int
-	baseRate               *big.Float
 	isDynGasPrice          bool
-	refundMaxUsdt          *big.Float
+	limits                 *budget.Limiter
+	queue                  *approval.Queue
+	balance                *balance.Monitor
+	notifier               *notifier.Notifier
+	ledger                 *ledger.Ledger
+	window                 *window.Window
 }
 
 type crawlingMate struct {
@@ -61,15 +76,25 @@ type crawlingMate struct {
 	decimal      int
 }
 
-func New(c client.Client, conf *config.GasfeeService) (*Service, error) {
-	privateKey, err := crypto.HexToECDSA(conf.PrivateKey)
+func New(c client.Client, conf *config.GasfeeService, n *notifier.Notifier) (*Service, error) {
+	txSigner, err := signer.New(conf.Signer, conf.PrivateKey)
 	if err != nil {
-		return nil, fmt.Errorf("new on crypto.HexToECDSA private key failed:%w", err)
+		return nil, fmt.Errorf("new on signer failed:%w", err)
 	}
 
-	publicKey, ok := privateKey.Public().(*ecdsa.PublicKey)
-	if !ok {
-		return nil, fmt.Errorf("new on casting public key to ECDSA failed")
+	limits, err := budget.New(conf.Limits)
+	if err != nil {
+		return nil, fmt.Errorf("new on limits failed:%w", err)
+	}
+
+	queue, err := approval.New(conf.Approval)
+	if err != nil {
+		return nil, fmt.Errorf("new on approval queue failed:%w", err)
+	}
+
+	exporter, err := report.NewExporter(conf.Report)
+	if err != nil {
+		return nil, fmt.Errorf("new on report failed:%w", err)
 	}
 
 	mapper := make(map[common.Address]*crawlingMate)
@@ -98,42 +123,126 @@ func New(c client.Client, conf *config.GasfeeService) (*Service, error) {
 		}
 	}
 
+	payer, err := payout.New(conf.Payout)
+	if err != nil {
+		return nil, fmt.Errorf("new on payout failed:%w", err)
+	}
+	// the refund is priced in the denominator, so the token paid out must be it
+	if token := payer.Token(); token != nil && *token != denominator {
+		return nil, fmt.Errorf("new on payout failed: token_address:%s is not the token of the denominator:%s", token, conf.Denominator)
+	}
+
+	batcher, err := payout.NewBatcher(conf.Batch)
+	if err != nil {
+		return nil, fmt.Errorf("new on batch failed:%w", err)
+	}
+
+	gas, err := payout.NewGas(conf.Gas)
+	if err != nil {
+		return nil, fmt.Errorf("new on gas failed:%w", err)
+	}
+	if gas.Holds() && queue == nil {
+		return nil, errors.New("new on gas failed: on_failure hold needs the approval")
+	}
+
+	balanceRule, err := newBalanceRule(conf.RecipientBalance, payer)
+	if err != nil {
+		return nil, fmt.Errorf("new on recipient balance failed:%w", err)
+	}
+
+	refundSchedule, priceWindow, err := newSchedule(conf)
+	if err != nil {
+		return nil, fmt.Errorf("new on refund schedule failed:%w", err)
+	}
+
+	failed, err := newFailedRanges(conf.FailedRangesFilepath)
+	if err != nil {
+		return nil, fmt.Errorf("new on failed ranges failed:%w", err)
+	}
+
+	triggers, err := indexer.NewTriggers(conf.Triggers, addresses)
+	if err != nil {
+		return nil, fmt.Errorf("new on triggers failed:%w", err)
+	}
+	if conf.NativeTrigger != nil && len(conf.Triggers) > 0 {
+		return nil, errors.New("native_trigger and triggers are exclusive")
+	}
+	native, err := indexer.NewNativeTrigger(conf.NativeTrigger)
+	if err != nil {
+		return nil, fmt.Errorf("new on native trigger failed:%w", err)
+	}
+
+	name := config.Namespaced(conf.Network, "gasfee")
+	ix, err := indexer.New(c, &indexer.Options{
+		Name:         name,
+		Triggers:     triggers,
+		Native:       native,
+		BlockStep:    conf.RefunderScrapBlockStep,
+		MaxBlockStep: conf.RefunderScrapMaxBlockStep,
+		Concurrency:  conf.RefunderScanConcurrency,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("new on indexer failed:%w", err)
+	}
+
+	campaigns, err := newCampaigns(name, conf, mapper, exporter)
+	if err != nil {
+		return nil, fmt.Errorf("new on campaigns failed:%w", err)
+	}
+
 	s := &Service{
-		client:       c,
-		privateKey:   privateKey,
-		fromAddress:  crypto.PubkeyToAddress(*publicKey),
-		stdoutlogger: log.New(os.Stdout, "gasfeeService:", log.Lmsgprefix),
-		stderrlogger: log.New(os.Stderr, "gasfeeService:", log.Lmsgprefix),
-		done:         make(chan struct{}),
-		crawlerTick:  time.NewTicker(time.Duration(conf.CrawleInEveryMinutes) * time.Minute),
-		filterQuery: ethereum.FilterQuery{
-			Addresses: addresses,
-			Topics: [][]common.Hash{
-				{crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))},
-				{common.BytesToHash([]byte(""))},
-			},
-		},
-		refundTick:             &refundTicker{period: 24 * time.Hour, at: conf.RefundEveryDayAt},
+		name:                   name,
+		client:                 c,
+		payer:                  payer,
+		batcher:                batcher,
+		gas:                    gas,
+		balanceRule:            balanceRule,
+		fromAddress:            txSigner.Address(),
+		stdoutlogger:           log.New(os.Stdout, name+"Service:", log.Lmsgprefix),
+		stderrlogger:           log.New(os.Stderr, name+"Service:", log.Lmsgprefix),
+		done:                   make(chan struct{}),
+		crawlerTick:            time.NewTicker(time.Duration(conf.CrawleInEveryMinutes) * time.Minute),
+		indexer:                ix,
+		failedRanges:           failed,
+		refundTick:             &refundTicker{schedule: refundSchedule},
 		refunderTimeout:        time.Duration(conf.RefunderTotalTimeoutSec) * time.Second,
 		crawlerTimeout:         time.Duration(conf.CrawlerTotalTimeoutSec) * time.Second,
-		refundThreshold:        conf.RefundThreshold,
-		prices:                 &prices{mux: new(sync.RWMutex), values: make(map[common.Address]*big.Float)},
-		crawlingAddr:           conf.CrawlingAddress,
+		campaigns:              campaigns,
+		prices:                 newPrices(priceWindow),
+		priceSource:            price.NewGateIO(conf.CrawlingAddress),
 		denominator:            denominator,
 		numerator:              numerator,
 		mapper:                 mapper,
 		curBlockNumberFilepath: conf.CurrentBlockNumberFilepath,
-		blockInterval:          conf.RefunderScrapBlockStep,
-		refundMaxCapWei:        conf.RefundMaxCapWei,
-		refundedWeiFilepath:    conf.RefundedWeiFilepath,
-		refundedListFilepath:   conf.RefundedListFilepath,
-		baseRate:               conf.RefundBaseRateWei,
 		isDynGasPrice:          conf.IsUsingDynamicGasPrice,
-		refundMaxUsdt:          conf.RefundMaxUsdtEach,
+		limits:                 limits,
+		queue:                  queue,
+		balance:                balance.New(name, c, txSigner.Address(), conf.BalanceMonitor),
+		notifier:               n,
+		ledger:                 ledger.Open(conf.LedgerFilepath),
+		window:                 window.New(conf.Window),
 	}
+	if conf.RefundSchedule != nil {
+		s.lastRun = schedule.NewLastRun(conf.RefundSchedule.LastRunFilepath)
+		s.confirmations = conf.RefundSchedule.Confirmations
+	}
+
+	s.sender = payout.NewSender(&payout.SenderOptions{
+		Name:     name,
+		Signer:   txSigner,
+		Payer:    payer,
+		Batcher:  batcher,
+		Gas:      gas,
+		Balance:  s.balance,
+		Ledger:   s.ledger,
+		Notifier: n,
+	})
 
 	s.resetPrices()
-	s.Start()
+	s.balance.OnAlert(func(a *balance.Alert) {
+		s.notifier.Notify(notifier.LowBalance, s.name, a.String(), nil)
+	})
+	s.balance.Start()
 
 	curBlockNumB, err := ioutil.ReadFile(s.curBlockNumberFilepath)
 	if err != nil {
@@ -148,80 +257,183 @@ func New(c client.Client, conf *config.GasfeeService) (*Service, error) {
 		}
 	}
 
+	s.Start()
 	s.stdoutlogger.Printf("gasfeeService starting: %+v\n", conf)
 
 	return s, nil
 }
 
+// newSchedule returns the refund schedule and the rolling price window, a zero window resets the prices after each run
+func newSchedule(conf *config.GasfeeService) (schedule.Schedule, time.Duration, error) {
+	rs := conf.RefundSchedule
+	if rs == nil {
+		return &schedule.Daily{At: conf.RefundEveryDayAt}, 0, nil
+	}
+
+	priceWindow := time.Duration(rs.PriceWindowMinutes) * time.Minute
+	switch {
+	case rs.Cron != "" && rs.ContinuousEveryMinutes > 0:
+		return nil, 0, errors.New("cron and continuous_every_minutes are exclusive")
+	case rs.ContinuousEveryMinutes > 0:
+		if priceWindow == 0 {
+			priceWindow = 24 * time.Hour
+		}
+		return &schedule.Every{Period: time.Duration(rs.ContinuousEveryMinutes) * time.Minute}, priceWindow, nil
+	case rs.Cron != "":
+		c, err := schedule.NewCron(rs.Cron, rs.Timezone)
+		if err != nil {
+			return nil, 0, err
+		}
+		return c, priceWindow, nil
+	default:
+		return nil, 0, errors.New("either cron or continuous_every_minutes is a MUST filled field")
+	}
+}
+
 func (s *Service) resetPrices() {
+	// the rolling window drops the old prices by itself
+	if s.prices.window > 0 {
+		return
+	}
+
 	s.prices.mux.Lock()
 	defer s.prices.mux.Unlock()
 
+	// the highest or the lowest price restarts from the first one crawled
 	for tokenAddr, mate := range s.mapper {
 		switch mate.priceKind {
-		case config.Highest:
-			s.prices.values[tokenAddr] = big.NewFloat(math.SmallestNonzeroFloat64)
-		case config.Lowest:
-			s.prices.values[tokenAddr] = big.NewFloat(math.MaxFloat64)
+		case config.Highest, config.Lowest:
+			delete(s.prices.values, tokenAddr)
 		}
 	}
 }
 
+type priceSample struct {
+	at   time.Time
+	high *money.Decimal
+	low  *money.Decimal
+	kind config.PriceKind
+}
+
+// prices keeps the highest or lowest price since the last run, or in the rolling window if the window is set
 type prices struct {
-	mux    *sync.RWMutex
-	values map[common.Address]*big.Float
+	mux     *sync.RWMutex
+	values  map[common.Address]*money.Decimal
+	window  time.Duration
+	samples map[common.Address][]*priceSample
 }
 
-func (p *prices) get(k common.Address) *big.Float {
+func newPrices(window time.Duration) *prices {
+	return &prices{
+		mux:     new(sync.RWMutex),
+		values:  make(map[common.Address]*money.Decimal),
+		window:  window,
+		samples: make(map[common.Address][]*priceSample),
+	}
+}
+
+// get returns the price, a nil price means nothing crawled in the rolling window
+func (p *prices) get(k common.Address) *money.Decimal {
+	if p.window > 0 {
+		p.mux.Lock()
+		defer p.mux.Unlock()
+		return p.rolling(k, time.Now())
+	}
+
 	p.mux.RLock()
 	defer p.mux.RUnlock()
 	return p.values[k]
 }
 
-func (p *prices) set(k common.Address, v float64) {
+// rolling drops the samples out of the window and returns the highest or lowest price of the rest
+func (p *prices) rolling(k common.Address, now time.Time) *money.Decimal {
+	samples := p.samples[k]
+	since := now.Add(-p.window)
+	i := 0
+	for i < len(samples) && samples[i].at.Before(since) {
+		i++
+	}
+	samples = samples[i:]
+	p.samples[k] = samples
+
+	if len(samples) == 0 {
+		return nil
+	}
+
+	v := samples[0].high
+	if samples[0].kind == config.Lowest {
+		v = samples[0].low
+	}
+	for _, sample := range samples[1:] {
+		switch {
+		case sample.kind == config.Highest && sample.high.Cmp(v) > 0:
+			v = sample.high
+		case sample.kind == config.Lowest && sample.low.Cmp(v) < 0:
+			v = sample.low
+		}
+	}
+	return v
+}
+
+func (p *prices) set(k common.Address, v *money.Decimal) {
 	p.mux.Lock()
 	defer p.mux.Unlock()
-	p.values[k] = big.NewFloat(v)
+	p.values[k] = v
+	if p.window > 0 {
+		p.samples[k] = append(p.samples[k], &priceSample{at: time.Now(), high: v, low: v})
+	}
 }
 
-func (p *prices) cmpThenSet(cmpk common.Address, high, low float64, cond config.PriceKind) {
+func (p *prices) cmpThenSet(cmpk common.Address, high, low *money.Decimal, cond config.PriceKind) {
 	p.mux.Lock()
 	defer p.mux.Unlock()
 
-	curv := p.values[cmpk]
+	if p.window > 0 {
+		p.samples[cmpk] = append(p.samples[cmpk], &priceSample{at: time.Now(), high: high, low: low, kind: cond})
+		return
+	}
+
+	curv, ok := p.values[cmpk]
 	switch cond {
 	case config.Highest:
-		newv := big.NewFloat(high)
-		if newv.Cmp(curv) > 0 {
-			p.values[cmpk] = newv
+		if !ok || high.Cmp(curv) > 0 {
+			p.values[cmpk] = high
 		}
 	case config.Lowest:
-		newv := big.NewFloat(low)
-		if newv.Cmp(curv) < 0 {
-			p.values[cmpk] = newv
+		if !ok || low.Cmp(curv) < 0 {
+			p.values[cmpk] = low
 		}
 	}
 }
 
 type refundTicker struct {
-	timer  *time.Timer
-	period time.Duration
-	at     time.Time
+	timer    *time.Timer
+	schedule schedule.Schedule
+	mux      sync.Mutex
+	next     time.Time
 }
 
-// adjusting the refund ticker must to be tick at RefundEveryDayAt GMT time
-func (r *refundTicker) updateTimer() {
-	hh := r.at.Hour()
-	mm := r.at.Minute()
-	ss := r.at.Second()
-	now := time.Now().UTC()
+// nextRunAt returns the time of the next tick, zero if nothing scheduled
+func (r *refundTicker) nextRunAt() time.Time {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.next
+}
 
-	nextTick := time.Date(now.Year(), now.Month(), now.Day(), hh, mm, ss, 0, time.UTC)
-	if !nextTick.After(now) {
-		nextTick = nextTick.Add(r.period)
+// adjusting the refund ticker to tick at the next scheduled time
+func (r *refundTicker) updateTimer() {
+	now := time.Now()
+	next := r.schedule.Next(now)
+	r.mux.Lock()
+	r.next = next
+	r.mux.Unlock()
+
+	diff := next.Sub(now)
+	if next.IsZero() {
+		// nothing scheduled any more
+		diff = time.Duration(math.MaxInt64)
 	}
 
-	diff := nextTick.Sub(now)
 	if r.timer == nil {
 		r.timer = time.NewTimer(diff)
 	} else {
@@ -244,175 +456,564 @@ func (s *Service) Start() {
 				s.stdoutlogger.Println("crawler ticked")
 				if err := s.crawler(); err != nil {
 					s.stderrlogger.Println(err)
+					s.notifier.Notify(notifier.CrawlerFailed, s.name, err.Error(), nil)
 				}
 			}
 		}
 	}()
 
 	go func() {
+		lastRunAt, err := s.lastRun.Get()
+		if err != nil {
+			s.stderrlogger.Println(err)
+		}
+		if missed := schedule.Missed(s.refundTick.schedule, lastRunAt, time.Now()); !missed.IsZero() {
+			// the prices are crawled first, as nothing has been crawled since starting up
+			s.stdoutlogger.Printf("refunder missed the run at:%s since the last run at:%s, running now", missed, lastRunAt)
+			if err := s.crawler(); err != nil {
+				s.stderrlogger.Println(err)
+				s.notifier.Notify(notifier.CrawlerFailed, s.name, err.Error(), nil)
+			}
+			s.runRefunder()
+		}
+
 		for {
 			select {
 			case <-s.done:
 				return
 			case <-s.refundTick.timer.C:
 				s.stdoutlogger.Println("refunder ticked")
-				if err := s.refunder(); err != nil {
-					s.stderrlogger.Println(err)
-				}
+				s.runRefunder()
 				s.refundTick.updateTimer()
-				s.resetPrices()
 			}
 		}
 	}()
 }
 
+// runRefunder runs the refunder, then records the run time and resets the prices for the next run
+func (s *Service) runRefunder() {
+	startedAt := time.Now()
+	if err := s.refunder(); err != nil {
+		s.stderrlogger.Println(err)
+	}
+	if err := s.lastRun.Set(startedAt); err != nil {
+		s.stderrlogger.Println(err)
+	}
+	s.resetPrices()
+}
+
 // Close stops the fork out goroutines from Start method
 func (s *Service) Close() {
 	if s.crawlerTick != nil {
 		s.crawlerTick.Stop()
 	}
 
-	if s.refundTick != nil {
+	if s.refundTick != nil && s.refundTick.timer != nil {
 		s.refundTick.timer.Stop()
 	}
 
+	s.balance.Close()
 	close(s.done)
 }
 
 var (
 	ErrNotOverThreshold = errors.New("transaction value is not over the threshold")
 	ErrAlreadyRefunded  = errors.New("address has been refunded already")
+	ErrAlreadyHeld      = errors.New("address has been held for the manual approval already")
+	ErrOverLimits       = errors.New("refund value is over the limits")
+	ErrHeld             = errors.New("held for the manual approval")
+	ErrNoApprovalQueue  = errors.New("approval queue is not configured")
+	ErrOutsideWindow    = errors.New("transaction is outside the window")
+	ErrUnpayable        = errors.New("recipient cannot be paid")
+	ErrEnoughBalance    = errors.New("recipient holds enough gas already")
 )
 
-func (s *Service) refunder() error {
+// Status is the snapshot of the service for the admin api
+type Status struct {
+	FromAddress        common.Address    `json:"from_address"`
+	CurrentBlockNumber uint64            `json:"current_block_number"`
+	RefundedWei        *big.Int          `json:"refunded_wei"`
+	RefundMaxCapWei    *big.Int          `json:"refund_max_cap_wei"`
+	Campaigns          []*CampaignStatus `json:"campaigns,omitempty"`
+	Window             string            `json:"window"`
+	NextRunAt          time.Time         `json:"next_run_at"`
+	LastRunAt          time.Time         `json:"last_run_at"`
+	Limits             *budget.Status    `json:"limits,omitempty"`
+	PendingApprovals   int               `json:"pending_approvals"`
+	FailedRanges       []*FailedRange    `json:"failed_ranges"`
+	Balance            *balance.Status   `json:"balance,omitempty"`
+}
+
+// CampaignStatus is the snapshot of a named campaign
+type CampaignStatus struct {
+	Name            string   `json:"name"`
+	Window          string   `json:"window"`
+	RefundedWei     *big.Int `json:"refunded_wei"`
+	RefundMaxCapWei *big.Int `json:"refund_max_cap_wei"`
+}
+
+// Status returns the current refunded wei, the served block and the remaining budgets
+// the refunded wei is the sum of the campaigns, and the cap is the one of the single campaign only
+func (s *Service) Status() interface{} {
+	st := &Status{
+		FromAddress:      s.fromAddress,
+		Window:           s.window.String(),
+		NextRunAt:        s.refundTick.nextRunAt(),
+		RefundedWei:      big.NewInt(0),
+		Limits:           s.limits.Status(time.Now()),
+		PendingApprovals: s.queue.Pending(),
+		FailedRanges:     s.failedRanges.list(),
+		Balance:          s.balance.Status(),
+	}
+	for _, camp := range s.campaigns {
+		refundedWei, err := camp.refundedWei()
+		if err != nil {
+			s.stderrlogger.Printf("status campaign:%q %v", camp.name, err)
+			refundedWei = nil
+		} else {
+			st.RefundedWei.Add(st.RefundedWei, refundedWei)
+		}
+
+		if camp.name == "" {
+			st.RefundMaxCapWei = camp.maxCapWei
+			continue
+		}
+		st.Campaigns = append(st.Campaigns, &CampaignStatus{
+			Name:            camp.name,
+			Window:          camp.window.String(),
+			RefundedWei:     refundedWei,
+			RefundMaxCapWei: camp.maxCapWei,
+		})
+	}
+	if b, err := ioutil.ReadFile(s.curBlockNumberFilepath); err == nil {
+		st.CurrentBlockNumber, _ = binary.Uvarint(b)
+	}
+	if lastRunAt, err := s.lastRun.Get(); err == nil {
+		st.LastRunAt = lastRunAt
+	}
+	return st
+}
+
+// checkLimits returns ErrOverLimits if the refund is stopped by the limits
+func (s *Service) checkLimits(token, toAddr common.Address, refundValue *big.Int) error {
+	if err := s.limits.Allow(time.Now(), token, toAddr, refundValue); err != nil {
+		if budget.IsExceeded(err) {
+			s.stdoutlogger.Printf("to_address:%s not passing the limits, %v", toAddr, err)
+			return ErrOverLimits
+		}
+		return fmt.Errorf("checking limits failed:%w", err)
+	}
+	return nil
+}
+
+// hold puts the refund into the approval queue if it's flagged or over the thresholds
+func (s *Service) hold(camp *campaign, log *indexer.Transfer, toAddr common.Address, refundValue *big.Int, refundValueUSDT *money.Decimal, reasons []string) error {
+	if s.queue.Over(refundValue, refundValueUSDT) {
+		reasons = append(reasons, "over_threshold")
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+
+	item, err := s.queue.Hold(&approval.Item{
+		TxHash:    log.TxHash,
+		Token:     log.Token,
+		Recipient: toAddr,
+		Wei:       refundValue,
+		Usdt:      refundValueUSDT,
+		Reasons:   reasons,
+		Campaign:  camp.name,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.ledger.Append(&ledger.Record{
+		Service:      s.name,
+		Campaign:     camp.name,
+		SourceTxHash: log.TxHash,
+		LogIndex:     log.Index,
+		Token:        log.Token,
+		Recipient:    toAddr,
+		Wei:          refundValue,
+		Usdt:         item.UsdtFloat(),
+		ApprovalID:   item.ID,
+		Reasons:      item.Reasons,
+		Status:       ledger.Held,
+	}); err != nil {
+		s.stderrlogger.Printf("ledger appending failed:%v, tx_hash:%s", err, log.TxHash)
+	}
+
+	s.stdoutlogger.Printf("refunder held for approval, id:%d, campaign:%q, to_address:%s, refund_value:%s, refund_value_usdt:%v, tx_hash:%s", item.ID, camp.name, toAddr, refundValue, refundValueUSDT, log.TxHash)
+	return ErrHeld
+}
+
+// payoutShift is the decimal places moving the refund in the wei of the numerator into the smallest unit of the ERC20 token paid out,
+// the native refund is kept as it is
+func (s *Service) payoutShift() int {
+	if s.payer == nil {
+		return 0
+	}
+	return s.mapper[s.denominator].decimal - s.mapper[s.numerator].decimal
+}
+
+// settle updates the refunded wei of the campaign and the limits by the sent refund, and returns the refunded wei
+func (s *Service) settle(rec *ledger.Record) (*big.Int, error) {
+	camp := s.campaign(rec.Campaign)
+	if camp == nil {
+		return nil, fmt.Errorf("settle failed: campaign:%q is not configured", rec.Campaign)
+	}
+
+	refundedWei, err := camp.addRefundedWei(rec.Wei)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.limits.Record(time.Now(), rec.Token, rec.Recipient, rec.Wei); err != nil {
+		return nil, fmt.Errorf("recording limits failed:%w", err)
+	}
+	return refundedWei, nil
+}
+
+// List returns the approval items with the status, an empty status returns all
+func (s *Service) List(status approval.Status) []*approval.Item {
+	if s.queue == nil {
+		return []*approval.Item{}
+	}
+	return s.queue.List(status)
+}
+
+// Approve sends a pending refund through the normal sending path, the max cap and limits still apply
+func (s *Service) Approve(id uint64, by, note string) (*approval.Item, error) {
+	if s.queue == nil {
+		return nil, ErrNoApprovalQueue
+	}
+
+	item, err := s.queue.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if item.Status != approval.Pending {
+		return nil, fmt.Errorf("%w, id:%d, status:%s", approval.ErrNotPending, id, item.Status)
+	}
+
+	camp := s.campaign(item.Campaign)
+	if camp == nil {
+		return nil, fmt.Errorf("approve id:%d failed: campaign:%q is not configured", id, item.Campaign)
+	}
+
+	refundedWei, err := camp.refundedWei()
+	if err != nil {
+		return nil, fmt.Errorf("approve %w", err)
+	}
+	if camp.capReached(refundedWei) {
+		return nil, fmt.Errorf("approve id:%d failed: refunded_wei:%s reached refund_max_cap_wei:%s", id, refundedWei, camp.maxCapWei)
+	}
+
+	if err := s.checkLimits(item.Token, item.Recipient, item.Wei); err != nil {
+		return nil, fmt.Errorf("approve id:%d failed:%w", id, err)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), s.refunderTimeout)
 	defer cancel()
 
 	c, err := s.client.DialRPC()
 	if err != nil {
-		return fmt.Errorf("refunder client.DialRPC failed:%w", err)
+		return nil, fmt.Errorf("approve client.DialRPC failed:%w, id:%d", err, id)
+	}
+
+	if _, err := s.queue.Decide(id, approval.Approved, by, note); err != nil {
+		return nil, err
+	}
+
+	tx, refundedWei, err := s.sender.Send(ctx, c, &ledger.Record{
+		Service:      s.name,
+		Campaign:     camp.name,
+		SourceTxHash: item.TxHash,
+		Token:        item.Token,
+		Recipient:    item.Recipient,
+		Wei:          item.Wei,
+		Usdt:         item.UsdtFloat(),
+		ApprovalID:   id,
+		Reasons:      item.Reasons,
+	}, s.settle)
+	if err != nil {
+		if _, merr := s.queue.MarkFailed(id, err); merr != nil {
+			s.stderrlogger.Printf("approve mark failed:%v, id:%d", merr, id)
+		}
+		return nil, fmt.Errorf("approve id:%d failed:%w", id, err)
 	}
 
-	refundedListB, err := ioutil.ReadFile(s.refundedListFilepath)
+	s.stdoutlogger.Printf(`approve success, id:%d, by:%s, to_address:%s, refund_value:%s, refunded_wei:%s, refund_tx_hash:%s, tx_hash:%s`,
+		id, by, item.Recipient, item.Wei, refundedWei, tx.Hash(), item.TxHash,
+	)
+
+	if err := camp.addRefunded(item.Recipient); err != nil {
+		s.stderrlogger.Printf("approve marking refunded failed:%v, id:%d", err, id)
+	}
+
+	return s.queue.MarkSent(id, tx.Hash())
+}
+
+// campaign returns the campaign of the name, the empty name is the single campaign built from the service config
+func (s *Service) campaign(name string) *campaign {
+	for _, camp := range s.campaigns {
+		if camp.name == name {
+			return camp
+		}
+	}
+	return nil
+}
+
+// Reject drops a pending refund
+func (s *Service) Reject(id uint64, by, note string) (*approval.Item, error) {
+	if s.queue == nil {
+		return nil, ErrNoApprovalQueue
+	}
+
+	item, err := s.queue.Decide(id, approval.Rejected, by, note)
+	if err != nil {
+		return nil, err
+	}
+
+	// the rejected recipient is eligible again, the older versions marked it refunded once held
+	if camp := s.campaign(item.Campaign); camp != nil {
+		if err := camp.dropRefunded(item.Recipient); err != nil {
+			s.stderrlogger.Printf("reject unmarking refunded failed:%v, id:%d", err, id)
+		}
+	}
+
+	s.stdoutlogger.Printf("reject success, id:%d, by:%s, to_address:%s, tx_hash:%s", id, by, item.Recipient, item.TxHash)
+	return item, nil
+}
+
+func (s *Service) refunder() error {
+	// keeps the cursor, the skipped blocks are refunded in the next run after topping up
+	if s.balance.Paused() {
+		return fmt.Errorf("refunder skipped:%w", balance.ErrPaused)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.refunderTimeout)
+	defer cancel()
+
+	c, err := s.client.DialRPC()
 	if err != nil {
-		return fmt.Errorf("refunder read file:%q failed:%w", s.refundedListFilepath, err)
+		return fmt.Errorf("refunder client.DialRPC failed:%w", err)
 	}
 
-	var refundedList []string
-	if err := json.Unmarshal(refundedListB, &refundedList); err != nil {
-		return fmt.Errorf("refunder json unmarshal refunded list failed:%w", err)
+	startedAt := time.Now()
+	runs := make([]*campaignRun, 0, len(s.campaigns))
+	for _, camp := range s.campaigns {
+		run, err := camp.newRun(report.New(camp.reportName, startedAt))
+		if err != nil {
+			return fmt.Errorf("refunder campaign:%q %w", camp.name, err)
+		}
+		runs = append(runs, run)
 	}
 
-	refundedMap := map[string]struct{}{}
-	for _, addr := range refundedList {
-		refundedMap[addr] = struct{}{}
+	// the time bounds of the windows apply to the time of the block holding the transfer
+	needsTime := s.window.HasTime()
+	for _, camp := range s.campaigns {
+		needsTime = needsTime || camp.window.HasTime()
+	}
+	blockTimes := make(map[uint64]time.Time)
+	blockTime := func(n uint64) (time.Time, error) {
+		if !needsTime {
+			return time.Time{}, nil
+		}
+		if t, ok := blockTimes[n]; ok {
+			return t, nil
+		}
+		header, err := c.HeaderByNumber(ctx, big.NewInt(0).SetUint64(n))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("refunder c.HeaderByNumber:%d failed:%w", n, err)
+		}
+		t := time.Unix(int64(header.Time), 0).UTC()
+		blockTimes[n] = t
+		return t, nil
 	}
 
-	handing := func(log *types.Log, dynGasPrice *big.Float) error {
-		if len(log.Topics) != 3 {
-			return fmt.Errorf("refunder receive not expecting format on topics:%v, tx_hash:%s", log.Topics, log.TxHash)
+	// queue is the batch of the refunds in the current range
+	var queue []*pending
+
+	handing := func(run *campaignRun, log *indexer.Transfer, dynGasPrice *money.Decimal, entry *report.Entry) error {
+		toAddr := log.Recipient
+		entry.Recipient = toAddr
+
+		at, err := blockTime(log.BlockNumber)
+		if err != nil {
+			return err
+		}
+		for _, w := range []*window.Window{s.window, run.window} {
+			if pos := w.At(log.BlockNumber, at); pos != window.Within {
+				s.stdoutlogger.Printf("to_address:%s campaign:%q ignored, %s the window:%s, block_number:%d, tx_hash:%s", toAddr, run.name, pos, w, log.BlockNumber, log.TxHash)
+				entry.Reason = pos.String() + "_window"
+				return ErrOutsideWindow
+			}
 		}
 
-		value := big.NewFloat(0.0).SetInt(common.BytesToHash(log.Data).Big())
-		toAddr := common.BytesToAddress(common.TrimLeftZeroes(log.Topics[2].Bytes()))
-		if _, exists := refundedMap[toAddr.String()]; exists {
-			s.stdoutlogger.Printf("to_address:%s already refunded", toAddr)
+		if run.refunded(toAddr) {
+			s.stdoutlogger.Printf("to_address:%s already refunded, campaign:%q", toAddr, run.name)
 			return ErrAlreadyRefunded
 		}
+		if s.queue.Held(run.name, toAddr) {
+			s.stdoutlogger.Printf("to_address:%s already held for approval, campaign:%q", toAddr, run.name)
+			return ErrAlreadyHeld
+		}
 
-		mate, ok := s.mapper[log.Address]
+		mate, ok := s.mapper[log.Token]
 		if !ok {
-			return fmt.Errorf("refunder cannot find decimal from token_address:%s, tx_hash:%s", log.Address, log.TxHash)
+			return fmt.Errorf("refunder cannot find decimal from token_address:%s, tx_hash:%s", log.Token, log.TxHash)
 		}
 
-		refundedWeiB, err := ioutil.ReadFile(s.refundedWeiFilepath)
+		refundedWei, err := run.refundedWei()
 		if err != nil {
-			return fmt.Errorf("refunder read file:%q failed:%w", s.refundedWeiFilepath, err)
+			return fmt.Errorf("refunder %w", err)
 		}
-		refundedWei := big.NewInt(0).SetBytes(refundedWeiB)
+		refundedWei.Add(refundedWei, run.pendingWei)
 
 		denominator := s.prices.get(s.denominator)
 		numerator := s.prices.get(s.numerator)
-		toPrice := s.prices.get(log.Address)
+		toPrice := s.prices.get(log.Token)
+		if denominator == nil || numerator == nil || toPrice == nil {
+			return fmt.Errorf("refunder prices not crawled in the window, token_address:%s, tx_hash:%s", log.Token, log.TxHash)
+		}
+
+		transferedToken := money.FromUnits(log.Amount, mate.decimal)
+		transferedPrice := transferedToken.Mul(toPrice)
 
-		transferedToken := value.Quo(value, big.NewFloat(math.Pow10(mate.decimal)))
-		transferedPrice := transferedToken.Mul(transferedToken, toPrice)
+		entry.TransferredUsdt = transferedPrice.Float()
+		entry.TokenPrice, entry.NumeratorPrice, entry.DenominatorPrice = toPrice.Float(), numerator.Float(), denominator.Float()
 
-		s.stdoutlogger.Printf(`refunder handling, to_address:%s, value:%v, threshold:%v, tx_hash:%s, token_address:%s, decimal:%d, (numerator:%v / denominator:%v), target_price:%v, refunded_wei:%s, refund_max_cap_wei:%s, dynamic_gas_price:%v`,
-			toAddr, value, s.refundThreshold, log.TxHash, log.Address, mate.decimal, numerator, denominator, toPrice, refundedWei, s.refundMaxCapWei, dynGasPrice,
+		s.stdoutlogger.Printf(`refunder handling, campaign:%q, to_address:%s, value:%v, threshold:%v, tx_hash:%s, token_address:%s, decimal:%d, (numerator:%v / denominator:%v), target_price:%v, refunded_wei:%s, refund_max_cap_wei:%s, dynamic_gas_price:%v`,
+			run.name, toAddr, transferedToken, run.threshold, log.TxHash, log.Token, mate.decimal, numerator, denominator, toPrice, refundedWei, run.maxCapWei, dynGasPrice,
 		)
 
-		if transferedPrice.Cmp(s.refundThreshold) <= 0 || refundedWei.Cmp(s.refundMaxCapWei) >= 0 {
-			s.stdoutlogger.Printf("to_address:%s not passing the threshold", toAddr)
+		if run.campaign.capReached(refundedWei) && !run.capReached {
+			run.capReached = true
+			fields := map[string]interface{}{
+				"refund_max_cap_wei": run.maxCapWei.String(),
+				"refunded_wei":       refundedWei.String(),
+			}
+			if run.name != "" {
+				fields["campaign"] = run.name
+			}
+			s.notifier.Notify(notifier.CapReached, s.name, "refund max cap reached", fields)
+		}
+
+		if transferedPrice.Cmp(run.threshold) <= 0 || run.campaign.capReached(refundedWei) {
+			s.stdoutlogger.Printf("to_address:%s not passing the threshold, campaign:%q", toAddr, run.name)
+			if run.capReached {
+				entry.Reason = "max_cap"
+			}
 			return ErrNotOverThreshold
 		}
+		entry.Eligible = true
 
-		nonce, err := c.PendingNonceAt(ctx, s.fromAddress)
-		if err != nil {
-			return fmt.Errorf("refunder PendingNonceAt failed:%w, tx_hash:%s, addr:%s", err, log.TxHash, log.Address)
+		baseRate := run.baseRate
+		if dynGasPrice != nil {
+			baseRate = dynGasPrice.Mul(run.baseRate)
 		}
 
-		gasPrice, err := c.SuggestGasPrice(ctx)
+		refundValue, refundValueUSDT, err := Refund(baseRate, numerator, denominator, run.maxUsdt, s.payoutShift(), s.mapper[s.denominator].decimal)
 		if err != nil {
-			return fmt.Errorf("refunder SuggestGasPrice failed:%w, tx_hash:%s, addr:%s", err, log.TxHash, log.Address)
+			s.stdoutlogger.Printf("to_address:%s skipped, campaign:%q, %v, tx_hash:%s", toAddr, run.name, err, log.TxHash)
+			return err
 		}
 
-		chainID, err := c.NetworkID(ctx)
+		// the recipient already holding enough gas is skipped or topped up only
+		keptValue, state, err := s.balanceRule.apply(ctx, c, toAddr, refundValue)
 		if err != nil {
-			return fmt.Errorf("refunder NetworkID failed:%w, tx_hash:%s, addr:%s", err, log.TxHash, log.Address)
+			return fmt.Errorf("refunder %w, tx_hash:%s", err, log.TxHash)
+		}
+		if state != nil && state.Decision == decisionSkipped {
+			if err := s.ledger.Append(&ledger.Record{
+				Service:        s.name,
+				Campaign:       run.name,
+				SourceTxHash:   log.TxHash,
+				LogIndex:       log.Index,
+				Token:          log.Token,
+				Recipient:      toAddr,
+				Wei:            refundValue,
+				Usdt:           refundValueUSDT.Float(),
+				Reasons:        []string{"sufficient_balance"},
+				Status:         ledger.Skipped,
+				RecipientState: state,
+			}); err != nil {
+				s.stderrlogger.Printf("ledger appending failed:%v, tx_hash:%s", err, log.TxHash)
+			}
+			s.stdoutlogger.Printf("to_address:%s holding enough gas, campaign:%q, balance_wei:%s, nonce:%d", toAddr, run.name, state.BalanceWei, state.Nonce)
+			return ErrEnoughBalance
+		}
+		if keptValue.Cmp(refundValue) < 0 {
+			refundValue, refundValueUSDT = keptValue, toUsdt(keptValue, denominator, s.mapper[s.denominator].decimal)
 		}
 
-		fluctuation := big.NewFloat(0).Quo(numerator, denominator)
-		var baseRate *big.Float
-		if dynGasPrice != nil {
-			baseRate = big.NewFloat(0).Mul(dynGasPrice, s.baseRate)
-		} else {
-			baseRate = big.NewFloat(0).Add(big.NewFloat(0), s.baseRate)
-		}
-
-		refundValueF := big.NewFloat(0).Mul(baseRate, fluctuation)
-		refundValueUSDT := big.NewFloat(0).Mul(refundValueF.Quo(refundValueF, big.NewFloat(math.Pow10(int(s.mapper[s.denominator].decimal)))), denominator)
-		refundValue, _ := big.NewFloat(0).Mul(baseRate, fluctuation).Int(nil)
-		if refundValueUSDT.Cmp(s.refundMaxUsdt) > 1 {
-			maxFra := big.NewFloat(0).Quo(s.refundMaxUsdt, denominator)
-			refundValue, _ = maxFra.Mul(maxFra, big.NewFloat(math.Pow10(int(s.mapper[s.denominator].decimal)))).Int(nil)
-		}
-
-		tx, err := types.SignTx(
-			types.NewTx(&types.LegacyTx{
-				Nonce: nonce,
-				// recipient address
-				To: &toAddr,
-				// wei(10^18)
-				Value: refundValue,
-				// 21000 gas is the default value for transfering native token
-				Gas:      uint64(21000),
-				GasPrice: gasPrice,
-				// 0x data is the default value for transfering native token
-				Data: nil,
-			}),
-			types.NewEIP155Signer(chainID),
-			s.privateKey,
-		)
-		if err != nil {
-			return fmt.Errorf("refunder SignTx failed:%w, tx_hash:%s, addr:%s", err, tx.Hash(), log.Address)
+		entry.RefundWei, entry.RefundUsdt = refundValue, refundValueUSDT.Float()
+
+		if err := s.checkLimits(log.Token, toAddr, refundValue); err != nil {
+			if err == ErrOverLimits {
+				return err
+			}
+			return fmt.Errorf("refunder %w, tx_hash:%s", err, log.TxHash)
 		}
 
-		if err := c.SendTransaction(ctx, tx); err != nil {
-			return fmt.Errorf("refunder SendTransaction failed:%w, tx_hash:%s, addr:%s", err, tx.Hash(), log.Address)
+		rec := &ledger.Record{
+			Service:      s.name,
+			Campaign:     run.name,
+			SourceTxHash: log.TxHash,
+			LogIndex:     log.Index,
+			Token:        log.Token,
+			Recipient:    toAddr,
+			Wei:          refundValue,
+			Usdt:         refundValueUSDT.Float(),
+			Prices: map[string]*big.Float{
+				string(s.mapper[s.numerator].currencyPair):   numerator.Float(),
+				string(s.mapper[s.denominator].currencyPair): denominator.Float(),
+				string(mate.currencyPair):                    toPrice.Float(),
+			},
+			RecipientState: state,
 		}
 
-		refundedWei = refundedWei.Add(refundedWei, refundValue)
-		if err := ioutil.WriteFile(s.refundedWeiFilepath, refundedWei.Bytes(), os.ModeType); err != nil {
-			return fmt.Errorf("refunder write file:%q failed:%w", s.refundedWeiFilepath, err)
+		// the recipient whose gas estimate fails is held for approval or skipped, instead of broadcasting a refund going to revert
+		var reasons []string
+		if rec.Gas, err = s.payer.Estimate(ctx, c, s.gas, s.fromAddress, toAddr, refundValue, nil); err != nil {
+			if !errors.Is(err, payout.ErrGasEstimate) {
+				return fmt.Errorf("refunder %w, tx_hash:%s", err, log.TxHash)
+			}
+			if !s.gas.Holds() {
+				entry.Reason = s.sender.Failed(rec, err).Error()
+				s.stdoutlogger.Printf("to_address:%s cannot be paid, campaign:%q, %v", toAddr, run.name, err)
+				return ErrUnpayable
+			}
+			reasons = append(reasons, "gas_estimate_failed")
+		}
+
+		if err := s.hold(run.campaign, log, toAddr, refundValue, refundValueUSDT, reasons); err != nil {
+			if err != ErrHeld {
+				return fmt.Errorf("refunder holding for approval failed:%w, tx_hash:%s", err, log.TxHash)
+			}
+			// the held recipient is marked refunded once it's approved and sent, the queue keeps it from being held again
+			return err
+		}
+
+		if s.batcher != nil {
+			queue = append(queue, s.enqueue(run, rec, entry))
+			return ErrBatched
+		}
+
+		tx, refundedWei, err := s.sender.Send(ctx, c, rec, s.settle)
+		if err != nil {
+			return fmt.Errorf("refunder %w, tx_hash:%s, addr:%s", err, log.TxHash, log.Token)
 		}
 
-		s.stdoutlogger.Printf(`refunder success, to_address:%s, tx_hash:%s, token_address:%s, refund_tx_hash:%s, refund_value:%s, refunded_wei:%s`,
-			toAddr, log.TxHash, log.Address, tx.Hash(), refundValue, refundedWei,
+		s.stdoutlogger.Printf(`refunder success, campaign:%q, to_address:%s, tx_hash:%s, token_address:%s, refund_tx_hash:%s, refund_value:%s, refunded_wei:%s`,
+			run.name, toAddr, log.TxHash, log.Token, tx.Hash(), refundValue, refundedWei,
 		)
 
-		refundedList = append(refundedList, toAddr.String())
-		refundedMap[toAddr.String()] = struct{}{}
+		refundTxHash := tx.Hash()
+		entry.RefundTxHash = &refundTxHash
+		run.markRefunded(toAddr)
 		return nil
 	}
 
@@ -420,6 +1021,12 @@ func (s *Service) refunder() error {
 	if err != nil {
 		return fmt.Errorf("refunder c.BlockNumber failed:%w", err)
 	}
+	// only the confirmed blocks
+	if latestBlockNumber > s.confirmations {
+		latestBlockNumber -= s.confirmations
+	} else {
+		latestBlockNumber = 0
+	}
 
 	curBlockNumB, err := ioutil.ReadFile(s.curBlockNumberFilepath)
 	if err != nil {
@@ -427,72 +1034,285 @@ func (s *Service) refunder() error {
 	}
 	curBlockNum, _ := binary.Uvarint(curBlockNumB)
 
-	blockNumberDiff := latestBlockNumber - curBlockNum
-	curBlockNumber := curBlockNum
+	var blockNumberDiff uint64
+	if latestBlockNumber > curBlockNum {
+		blockNumberDiff = latestBlockNumber - curBlockNum
+	} else {
+		latestBlockNumber = curBlockNum
+	}
 	s.stdoutlogger.Printf("blockFrom:%v, blockNumberDiff:%v", curBlockNum, blockNumberDiff)
 
-	var dynGasprice *big.Float
+	var dynGasprice *money.Decimal
 	if s.isDynGasPrice {
 		p, err := s.client.DynamicGasPrice(ctx)
 		if err != nil {
 			return fmt.Errorf("refunder get DynamicGasPrice failed:%w", err)
 		}
-		dynGasprice = big.NewFloat(0).SetInt(p)
+		dynGasprice = money.NewFromInt(p)
+	}
+
+	for _, run := range runs {
+		run.rep.FromBlock, run.rep.ToBlock = curBlockNum, latestBlockNumber
 	}
 
 	var errs []string
-	for n := 0; n < int(blockNumberDiff); n += s.blockInterval {
-		s.filterQuery.FromBlock = big.NewInt(0).SetUint64(curBlockNumber)
-		curBlockNumber += uint64(s.blockInterval)
-		if curBlockNumber > latestBlockNumber {
-			curBlockNumber -= curBlockNumber - latestBlockNumber
-		}
-		s.filterQuery.ToBlock = big.NewInt(0).SetUint64(curBlockNumber)
-		// avoiding the next fromBlock repeat with the current toBlock
-		curBlockNumber++
-		n++
-
-		logs, err := c.FilterLogs(ctx, s.filterQuery)
-		if err != nil {
-			errs = append(errs, fmt.Sprintf("refunder c.FilterLogs failed:%v", err))
-			continue
-		}
+	flush := func() error {
+		items := queue
+		queue = nil
+		failed, err := s.sendBatch(ctx, c, items)
+		errs = append(errs, failed...)
+		return err
+	}
+
+	cursor := curBlockNum
+	if blockNumberDiff > 0 {
+		err := s.indexer.Backfill(ctx, curBlockNum, latestBlockNumber, func(r *indexer.Range) error {
+			if r.Err != nil {
+				// the cursor stops before the failed range, so it's retried in the next run
+				err := fmt.Errorf("refunder c.FilterLogs from:%d to:%d failed:%v", r.From, r.To, r.Err)
+				for _, run := range runs {
+					run.rep.AddError(err)
+				}
+				if ferr := s.failedRanges.fail(r.From, r.To, r.Err, time.Now()); ferr != nil {
+					return fmt.Errorf("%v, %w", err, ferr)
+				}
+				return err
+			}
+
+			for _, err := range r.Errs {
+				err = fmt.Errorf("refunder %w", err)
+				errs = append(errs, err.Error())
+				for _, run := range runs {
+					run.rep.AddError(err)
+				}
+			}
+
+			for _, log := range r.Transfers {
+				for _, run := range runs {
+					if !run.covers(log.Token) {
+						continue
+					}
+
+					entry := &report.Entry{TxHash: log.TxHash, Token: log.Token, Status: report.Sent}
+					err := handing(run, log, dynGasprice, entry)
+					if err == ErrBatched {
+						if len(queue) < s.batcher.MaxSize() {
+							break
+						}
+						if err := flush(); err != nil {
+							return err
+						}
+						break
+					}
+
+					switch err {
+					case nil:
+					case ErrHeld:
+						entry.Status, entry.Reason = report.Held, "approval"
+					case ErrAlreadyRefunded:
+						entry.Status, entry.Reason = report.Skipped, "already_refunded"
+					case ErrAlreadyHeld:
+						entry.Status, entry.Reason = report.Skipped, "already_held"
+					case ErrNotOverThreshold:
+						entry.Status = report.Skipped
+						if entry.Reason == "" {
+							entry.Reason = "not_over_threshold"
+						}
+					case ErrOverLimits:
+						entry.Status, entry.Reason = report.Skipped, "over_limits"
+					case ErrUnpayable:
+						entry.Status = report.Skipped
+					case ErrInvalidPrice:
+						entry.Status, entry.Reason = report.Skipped, "invalid_price"
+					case ErrEnoughBalance:
+						entry.Status, entry.Reason = report.Skipped, "sufficient_balance"
+					case ErrOutsideWindow:
+						entry.Status = report.Skipped
+					default:
+						entry.Status, entry.Reason = report.Failed, err.Error()
+						errs = append(errs, err.Error())
+					}
+					run.rep.Add(entry)
+
+					if errors.Is(err, balance.ErrPaused) {
+						// keeps the cursor of the range, the refunded ones are skipped by the refunded lists in the next run
+						return err
+					}
+
+					// the first campaign paying or holding the transfer claims it
+					if err == nil || err == ErrHeld {
+						break
+					}
+				}
+			}
+
+			// the batch is sent before the checkpoint, so the cursor never passes a refund not sent
+			if err := flush(); err != nil {
+				return err
+			}
+
+			if err := s.failedRanges.succeed(r.From, r.To); err != nil {
+				return err
+			}
 
-		for _, log := range logs {
-			if err := handing(&log, dynGasprice); err != nil {
-				switch err {
-				case ErrAlreadyRefunded, ErrNotOverThreshold:
-					// skip those two cases
-				default:
-					errs = append(errs, err.Error())
+			// the refunded lists are saved with the cursor, so the cursor never passes a refund missing in them,
+			// the refunded wei is saved on each refund already
+			for _, run := range runs {
+				if err := run.saveRefundedList(); err != nil {
+					return fmt.Errorf("refunder campaign:%q %w", run.name, err)
 				}
 			}
+
+			// checkpointing the contiguous scanned ranges, so a timed out run resumes from here
+			cursor = r.To
+			return s.saveCursor(cursor)
+		})
+		if errors.Is(err, balance.ErrPaused) {
+			return s.finishRuns(ctx, runs, err)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("refunder scanning stopped at block:%d, %v", cursor, err))
 		}
 	}
 
-	curBlockNum += blockNumberDiff
-	curBlockNumB = make([]byte, binary.MaxVarintLen64)
-	binary.PutUvarint(curBlockNumB, curBlockNum)
-	if err := ioutil.WriteFile(s.curBlockNumberFilepath, curBlockNumB, os.ModeType); err != nil {
+	if cursor > curBlockNum {
+		if err := s.endWindows(runs, blockTime, curBlockNum, cursor); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	var runErr error
+	if errs != nil {
+		runErr = fmt.Errorf(strings.Join(errs, "\n"))
+	}
+
+	return s.finishRuns(ctx, runs, runErr)
+}
+
+// saveCursor writes the block number the next run starts from
+func (s *Service) saveCursor(blockNumber uint64) error {
+	b := make([]byte, binary.MaxVarintLen64)
+	binary.PutUvarint(b, blockNumber)
+	if err := ioutil.WriteFile(s.curBlockNumberFilepath, b, 0o600); err != nil {
 		return fmt.Errorf("refunder write file:%q failed:%w", s.curBlockNumberFilepath, err)
 	}
+	return nil
+}
 
-	refundedListB, err = json.Marshal(refundedList)
+// endWindows notifies the final summaries of the windows ending in the scanned blocks
+// a window ends in a run if it's ended at the latest block but not at the first one, so it's notified exactly once
+func (s *Service) endWindows(runs []*campaignRun, blockTime func(uint64) (time.Time, error), fromBlock, toBlock uint64) error {
+	fromAt, err := blockTime(fromBlock)
 	if err != nil {
-		return fmt.Errorf("refunder json marshal refunded list failed:%w", err)
+		return err
+	}
+	toAt, err := blockTime(toBlock)
+	if err != nil {
+		return err
+	}
+	endsIn := func(w *window.Window) bool {
+		return w != nil && w.Ended(toBlock, toAt) && !w.Ended(fromBlock, fromAt)
+	}
+
+	if endsIn(s.window) {
+		total, recipients := big.NewInt(0), 0
+		for _, run := range runs {
+			refundedWei, err := run.refundedWei()
+			if err != nil {
+				return fmt.Errorf("refunder campaign:%q %w", run.name, err)
+			}
+			total.Add(total, refundedWei)
+			recipients += len(run.refundedList)
+		}
+
+		fields := map[string]interface{}{
+			"window":       s.window.String(),
+			"refunded_wei": total.String(),
+			"recipients":   recipients,
+		}
+		s.stdoutlogger.Printf("window ended, final summary:%v", fields)
+		s.notifier.Notify(notifier.CampaignEnded, s.name, "window ended", fields)
+	}
+
+	for _, run := range runs {
+		if !endsIn(run.window) {
+			continue
+		}
+
+		refundedWei, err := run.refundedWei()
+		if err != nil {
+			return fmt.Errorf("refunder campaign:%q %w", run.name, err)
+		}
+		fields := map[string]interface{}{
+			"campaign":     run.name,
+			"window":       run.window.String(),
+			"refunded_wei": refundedWei.String(),
+			"recipients":   len(run.refundedList),
+		}
+		if run.maxCapWei != nil {
+			fields["refund_max_cap_wei"] = run.maxCapWei.String()
+		}
+		s.stdoutlogger.Printf("campaign:%q window ended, final summary:%v", run.name, fields)
+		s.notifier.Notify(notifier.CampaignEnded, s.name, "campaign ended", fields)
 	}
 
-	if err := ioutil.WriteFile(s.refundedListFilepath, refundedListB, os.ModeType); err != nil {
-		return fmt.Errorf("refunder write file:%q failed:%w", s.refundedListFilepath, err)
+	return nil
+}
+
+// finishRuns reports the runs and saves the refunded lists, and returns the runErr if the saving succeeds
+func (s *Service) finishRuns(ctx context.Context, runs []*campaignRun, runErr error) error {
+	var errs []string
+	for _, run := range runs {
+		s.finishReport(ctx, run)
+		if err := run.saveRefundedList(); err != nil {
+			errs = append(errs, fmt.Sprintf("refunder campaign:%q %v", run.name, err))
+		}
 	}
 
 	if errs != nil {
 		return fmt.Errorf(strings.Join(errs, "\n"))
 	}
-	return nil
+	return runErr
 }
 
-// https://www.gate.io/docs/apiv4/en/#market-candlesticks
+// finishReport exports the report of a campaign run and notifies the summary
+func (s *Service) finishReport(ctx context.Context, run *campaignRun) {
+	rep := run.rep
+	refundedWei, err := run.refundedWei()
+	if err != nil {
+		s.stderrlogger.Printf("refunder campaign:%q %v", run.name, err)
+	}
+	rep.Finish(time.Now(), refundedWei, run.maxCapWei)
+
+	paths, err := run.report.Export(ctx, rep)
+	if err != nil {
+		s.stderrlogger.Printf("refunder exporting report failed:%v, campaign:%q", err, run.name)
+	}
+	if len(paths) > 0 {
+		s.stdoutlogger.Printf("refunder report exported:%v, campaign:%q", paths, run.name)
+	}
+
+	fields := map[string]interface{}{
+		"from_block": rep.FromBlock,
+		"to_block":   rep.ToBlock,
+		"logs_seen":  rep.LogsSeen,
+		"eligible":   rep.Eligible,
+		"sent":       rep.Sent,
+		"held":       rep.Held,
+		"failed":     rep.Failed,
+		"total_wei":  rep.TotalWei.String(),
+		"errors":     len(rep.Errors) + rep.Failed,
+	}
+	if rep.CapRemainingWei != nil {
+		fields["cap_remaining_wei"] = rep.CapRemainingWei.String()
+	}
+	if run.name != "" {
+		fields["campaign"] = run.name
+	}
+	s.notifier.Notify(notifier.DailySummary, s.name, "refunder finished", fields)
+}
+
+// crawler keeps the highest or lowest price of each currency pair since the last refunding
 func (s *Service) crawler() error {
 	ctx, cancel := context.WithTimeout(context.Background(), s.crawlerTimeout)
 	defer cancel()
@@ -505,52 +1325,21 @@ func (s *Service) crawler() error {
 		// they are all 1:1 so no need to crawle
 		switch mate.currencyPair {
 		case config.CurrencyPair("USDT_USDT"), config.CurrencyPair("USDC_USDT"), config.CurrencyPair("BUSD_USDT"):
-			s.prices.set(tokenAddr, 1.0)
+			s.prices.set(tokenAddr, money.New(1))
 			return nil
 		}
 
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.crawlingAddr, nil)
+		candle, err := s.priceSource.Fetch(ctx, mate.currencyPair)
 		if err != nil {
-			return fmt.Errorf("crawler http.NewRequestWithContext failed:%w", err)
+			return fmt.Errorf("crawler fetching price failed:%w, token_address:%s", err, tokenAddr)
 		}
 
-		q := req.URL.Query()
-		q.Add("currency_pair", string(mate.currencyPair))
-		q.Add("interval", "15m")
-		q.Add("limit", "1")
-
-		req.Header.Add("Accept", "application/json")
-		req.URL.RawQuery = q.Encode()
-
-		rep, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return fmt.Errorf("crawler http.DefaultClient.Do failed:%w, currency_pair:%s, token_address:%s", err, mate.currencyPair, tokenAddr)
-		}
-		defer rep.Body.Close()
-
-		// curl -H 'Accept: application/json' -X GET https://api.gateio.ws/api/v4/spot/candlesticks\?currency_pair\=FRA_USDT\&interval\=15m\&limit\=1
-		// [[unix_timestamp, trading_volume, close_price, highest_price, lowest_price, open_price]]
-		// [["1645749900","2839.79160470986265","0.01815","0.01897","0.01793","0.01889"]]
-		data := make([][]string, 0, 1)
-		if err := json.NewDecoder(rep.Body).Decode(&data); err != nil {
-			return fmt.Errorf("crawler json decode failed:%w, currency_pair:%s, token_address:%s", err, mate.currencyPair, tokenAddr)
-		}
-
-		if len(data) == 0 || len(data[0]) < 5 {
-			return fmt.Errorf("crawler http response not correct:%v, currency_pair:%s, token_address:%s", err, mate.currencyPair, tokenAddr)
-		}
-
-		high, err := strconv.ParseFloat(data[0][3], 64)
-		if err != nil {
-			return fmt.Errorf("crawler parse highest price failed:%w, currency_pair:%s, token_address:%s", err, mate.currencyPair, tokenAddr)
-		}
-
-		low, err := strconv.ParseFloat(data[0][4], 64)
-		if err != nil {
-			return fmt.Errorf("crawler parse lowest price failed:%w, currency_pair:%s, token_address:%s", err, mate.currencyPair, tokenAddr)
+		// a bad candle of 0 or less would stay as the lowest price for the whole window
+		if candle.High.Sign() <= 0 || candle.Low.Sign() <= 0 {
+			return fmt.Errorf("crawler price not correct, high:%s, low:%s, token_address:%s, currency_pair:%s", candle.High, candle.Low, tokenAddr, mate.currencyPair)
 		}
 
-		s.prices.cmpThenSet(tokenAddr, high, low, mate.priceKind)
+		s.prices.cmpThenSet(tokenAddr, candle.High, candle.Low, mate.priceKind)
 
 		return nil
 	}
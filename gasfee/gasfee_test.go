@@ -1,23 +1,31 @@
 package gasfee_test
 
 import (
+	"context"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"io/ioutil"
 	"math/big"
+	"path/filepath"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/FindoraNetwork/refunder/client"
 	"github.com/FindoraNetwork/refunder/config"
 	"github.com/FindoraNetwork/refunder/gasfee"
+	"github.com/FindoraNetwork/refunder/money"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 )
 
@@ -59,10 +67,10 @@ func Test_GasfeeService(t *testing.T) {
 		RefundEveryDayAt:           time.Now().UTC().Add(3 * time.Second),
 		RefunderTotalTimeoutSec:    3,
 		CrawlerTotalTimeoutSec:     3,
-		RefundThreshold:            big.NewFloat(3),
+		RefundThreshold:            money.New(3),
 		RefunderStartBlockNumber:   wantBlockNum,
 		CurrentBlockNumberFilepath: tmpCurBlock.Name(),
-	})
+	}, nil)
 	assert.NoError(t, err)
 	service.Close()
 
@@ -71,4 +79,381 @@ func Test_GasfeeService(t *testing.T) {
 
 	gotBlockNum, _ := binary.Uvarint(curBlockNumB)
 	assert.Equal(t, wantBlockNum, gotBlockNum)
+
+	_, err = gasfee.New(client, &config.GasfeeService{
+		PrivateKey:                 privateKey,
+		CrawleInEveryMinutes:       3,
+		RefundEveryDayAt:           time.Now().UTC().Add(time.Hour),
+		RefundThreshold:            money.New(3),
+		CurrentBlockNumberFilepath: tmpCurBlock.Name(),
+		Denominator:                "FRA_USDT",
+		CrawlingMapper: map[config.CurrencyPair]*config.CrawlingMate{
+			"FRA_USDT": {TokenAddress: "0x0000000000000000000000000000000000000001", Decimal: 18},
+		},
+		Payout: &config.Payout{TokenAddress: "0x0000000000000000000000000000000000000002"},
+	}, nil)
+	assert.Error(t, err, "the token paid out is not the denominator")
+
+	_, err = gasfee.New(client, &config.GasfeeService{
+		PrivateKey:                 privateKey,
+		CrawleInEveryMinutes:       3,
+		RefundEveryDayAt:           time.Now().UTC().Add(time.Hour),
+		RefundThreshold:            money.New(3),
+		CurrentBlockNumberFilepath: tmpCurBlock.Name(),
+		Batch:                      &config.Batch{ContractAddress: "disperse"},
+	}, nil)
+	assert.Error(t, err, "the batch contract is not an address")
+
+	_, err = gasfee.New(client, &config.GasfeeService{
+		PrivateKey:                 privateKey,
+		CrawleInEveryMinutes:       3,
+		RefundEveryDayAt:           time.Now().UTC().Add(time.Hour),
+		RefundThreshold:            money.New(3),
+		CurrentBlockNumberFilepath: tmpCurBlock.Name(),
+		Gas:                        &config.Gas{OnFailure: "hold"},
+	}, nil)
+	assert.Error(t, err, "holding the failed gas estimates needs the approval")
+
+	for _, rb := range []*config.RecipientBalance{
+		{},
+		{SufficientWei: big.NewInt(1e18), Mode: "top_up"},
+	} {
+		_, err = gasfee.New(client, &config.GasfeeService{
+			PrivateKey:                 privateKey,
+			CrawleInEveryMinutes:       3,
+			RefundEveryDayAt:           time.Now().UTC().Add(time.Hour),
+			RefundThreshold:            money.New(3),
+			CurrentBlockNumberFilepath: tmpCurBlock.Name(),
+			RecipientBalance:           rb,
+		}, nil)
+		assert.Error(t, err, "the recipient balance is invalid")
+	}
+}
+
+func Test_Campaigns(t *testing.T) {
+	dir := t.TempDir()
+	tmpCurBlock, err := ioutil.TempFile(dir, "current_block_file_*")
+	assert.NoError(t, err)
+
+	client, privateKey := setup(t)
+	conf := &config.GasfeeService{
+		PrivateKey:                 privateKey,
+		CrawleInEveryMinutes:       3,
+		RefundEveryDayAt:           time.Now().UTC().Add(time.Hour),
+		RefundThreshold:            money.New(3),
+		CurrentBlockNumberFilepath: tmpCurBlock.Name(),
+		CrawlingMapper: map[config.CurrencyPair]*config.CrawlingMate{
+			"USDT_USDT": {TokenAddress: "0x0000000000000000000000000000000000000001", Decimal: 6},
+		},
+		Campaigns: []*config.GasfeeCampaign{
+			{
+				Name:                 "summer",
+				TokenAddresses:       []string{"0x0000000000000000000000000000000000000001"},
+				RefundMaxCapWei:      big.NewInt(1000),
+				RefundedWeiFilepath:  filepath.Join(dir, "summer_wei"),
+				RefundedListFilepath: filepath.Join(dir, "summer_list.json"),
+				Window:               &config.Window{StartBlock: 100, EndBlock: 200},
+			},
+			{
+				Name:                 "autumn",
+				RefundedWeiFilepath:  filepath.Join(dir, "autumn_wei"),
+				RefundedListFilepath: filepath.Join(dir, "autumn_list.json"),
+			},
+		},
+	}
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "summer_wei"), big.NewInt(300).Bytes(), 0o644))
+
+	service, err := gasfee.New(client, conf, nil)
+	assert.NoError(t, err)
+	st := service.Status().(*gasfee.Status)
+	service.Close()
+
+	assert.Equal(t, "300", st.RefundedWei.String())
+	assert.Nil(t, st.RefundMaxCapWei)
+	assert.Equal(t, []*gasfee.CampaignStatus{
+		{Name: "summer", Window: "start_block:100, end_block:200", RefundedWei: big.NewInt(300), RefundMaxCapWei: big.NewInt(1000)},
+		{Name: "autumn", Window: "always", RefundedWei: big.NewInt(0)},
+	}, st.Campaigns)
+
+	conf.Campaigns[1].Name = "summer"
+	_, err = gasfee.New(client, conf, nil)
+	assert.Error(t, err)
+
+	conf.Campaigns[1].Name, conf.Campaigns[1].TokenAddresses = "autumn", []string{"0x0000000000000000000000000000000000000002"}
+	_, err = gasfee.New(client, conf, nil)
+	assert.Error(t, err)
+}
+
+func Test_RefundSchedule(t *testing.T) {
+	dir := t.TempDir()
+	tmpCurBlock, err := ioutil.TempFile(dir, "current_block_file_*")
+	assert.NoError(t, err)
+
+	lastRunAt := time.Now().UTC().Truncate(time.Second)
+	lastRunFilepath := filepath.Join(dir, "last_run")
+	assert.NoError(t, ioutil.WriteFile(lastRunFilepath, []byte(lastRunAt.Format(time.RFC3339)), 0o644))
+
+	client, privateKey := setup(t)
+	conf := &config.GasfeeService{
+		PrivateKey:                 privateKey,
+		CrawleInEveryMinutes:       3,
+		RefundThreshold:            money.New(3),
+		CurrentBlockNumberFilepath: tmpCurBlock.Name(),
+		RefundSchedule: &config.RefundSchedule{
+			Cron:            "0 9 * * 1-5",
+			Timezone:        "Asia/Taipei",
+			LastRunFilepath: lastRunFilepath,
+		},
+	}
+
+	service, err := gasfee.New(client, conf, nil)
+	assert.NoError(t, err)
+	st := service.Status().(*gasfee.Status)
+	service.Close()
+
+	loc, _ := time.LoadLocation("Asia/Taipei")
+	next := st.NextRunAt.In(loc)
+	assert.True(t, next.After(time.Now()))
+	assert.Equal(t, 9, next.Hour())
+	assert.NotEqual(t, time.Saturday, next.Weekday())
+	assert.NotEqual(t, time.Sunday, next.Weekday())
+	assert.True(t, lastRunAt.Equal(st.LastRunAt))
+
+	conf.RefundSchedule = &config.RefundSchedule{ContinuousEveryMinutes: 10}
+	service, err = gasfee.New(client, conf, nil)
+	assert.NoError(t, err)
+	st = service.Status().(*gasfee.Status)
+	service.Close()
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), st.NextRunAt, time.Minute)
+
+	conf.RefundSchedule = &config.RefundSchedule{Cron: "0 9 * * *", ContinuousEveryMinutes: 10}
+	_, err = gasfee.New(client, conf, nil)
+	assert.Error(t, err)
+
+	conf.RefundSchedule = &config.RefundSchedule{Cron: "0 25 * * *"}
+	_, err = gasfee.New(client, conf, nil)
+	assert.Error(t, err)
+}
+
+// rangeClient refuses the ranges larger than maxRange like a node limiting the results,
+// and fails the range holding the block failAt if it's set
+type rangeClient struct {
+	*client.MockClient
+	latest   uint64
+	maxRange uint64
+
+	mux    sync.Mutex
+	failAt uint64
+	ranges [][2]uint64
+}
+
+func (c *rangeClient) DialRPC() (client.Client, error) {
+	return c, nil
+}
+
+func (c *rangeClient) BlockNumber(context.Context) (uint64, error) {
+	return c.latest, nil
+}
+
+func (c *rangeClient) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	from, to := q.FromBlock.Uint64(), q.ToBlock.Uint64()
+	if to-from+1 > c.maxRange {
+		return nil, errors.New("query returned more than 10000 results")
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.failAt != 0 && from <= c.failAt && c.failAt <= to {
+		return nil, errors.New("connection reset by peer")
+	}
+	c.ranges = append(c.ranges, [2]uint64{from, to})
+	return nil, nil
+}
+
+// checkRanges asserts the queried ranges cover the blocks from the block from to the block to exactly
+func (c *rangeClient) checkRanges(t *testing.T, from, to uint64) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	sort.Slice(c.ranges, func(i, j int) bool { return c.ranges[i][0] < c.ranges[j][0] })
+	next := from
+	for _, r := range c.ranges {
+		assert.Equal(t, next, r[0])
+		assert.LessOrEqual(t, r[1]-r[0]+1, c.maxRange)
+		next = r[1] + 1
+	}
+	assert.Equal(t, to+1, next)
+	c.ranges = nil
+}
+
+func Test_Scanning(t *testing.T) {
+	dir := t.TempDir()
+	tmpCurBlock, err := ioutil.TempFile(dir, "current_block_file_*")
+	assert.NoError(t, err)
+
+	// the run missed during the downtime is run on startup
+	lastRunFilepath := filepath.Join(dir, "last_run")
+	missRun := func() {
+		assert.NoError(t, ioutil.WriteFile(lastRunFilepath, []byte("2022-07-01T00:00:00Z"), 0o644))
+	}
+
+	mc, privateKey := setup(t)
+	c := &rangeClient{MockClient: mc.(*client.MockClient), latest: 1000, maxRange: 100, failAt: 500}
+	conf := &config.GasfeeService{
+		PrivateKey:                 privateKey,
+		CrawleInEveryMinutes:       3,
+		RefunderTotalTimeoutSec:    10,
+		RefunderScrapBlockStep:     400,
+		RefunderScrapMaxBlockStep:  1000,
+		RefunderScanConcurrency:    4,
+		RefundThreshold:            money.New(3),
+		CurrentBlockNumberFilepath: tmpCurBlock.Name(),
+		FailedRangesFilepath:       filepath.Join(dir, "failed_ranges.json"),
+		RefundedWeiFilepath:        filepath.Join(dir, "refunded_wei"),
+		RefundedListFilepath:       filepath.Join(dir, "refunded_list.json"),
+		RefundSchedule:             &config.RefundSchedule{Cron: "0 0 * * *", LastRunFilepath: lastRunFilepath},
+	}
+
+	// the cursor stops right before the failed range
+	missRun()
+	service, err := gasfee.New(c, conf, nil)
+	assert.NoError(t, err)
+	var st *gasfee.Status
+	assert.Eventually(t, func() bool {
+		st = service.Status().(*gasfee.Status)
+		return len(st.FailedRanges) == 1
+	}, 10*time.Second, 10*time.Millisecond)
+	service.Close()
+
+	failed := st.FailedRanges[0]
+	assert.True(t, failed.From <= 500 && 500 <= failed.To)
+	assert.Equal(t, 1, failed.Attempts)
+	assert.Equal(t, "connection reset by peer", failed.Error)
+	assert.Equal(t, failed.From-1, st.CurrentBlockNumber)
+
+	// the failed range is retried in the next run
+	c.mux.Lock()
+	c.failAt, c.ranges = 0, nil
+	c.mux.Unlock()
+
+	missRun()
+	service, err = gasfee.New(c, conf, nil)
+	assert.NoError(t, err)
+	defer service.Close()
+
+	assert.Eventually(t, func() bool {
+		st = service.Status().(*gasfee.Status)
+		return st.CurrentBlockNumber == 1000
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.Empty(t, st.FailedRanges)
+	c.checkRanges(t, failed.From-1, 1000)
+}
+
+func Test_Refund(t *testing.T) {
+	parse := func(s string) *money.Decimal {
+		d, err := money.Parse(s)
+		assert.NoError(t, err)
+		return d
+	}
+
+	for _, tc := range []struct {
+		name                                      string
+		baseRate, numerator, denominator, maxUsdt string
+		shift, decimal                            int
+		wantWei, wantUsdt                         string
+	}{
+		{
+			name:     "266255000000000 * 361.3522 / 0.0198 is truncated into the wei",
+			baseRate: "266255000000000", numerator: "361.3522", denominator: "0.0198",
+			decimal: 18,
+			wantWei: "4859183333888888888", wantUsdt: "0.096211830011",
+		},
+		{
+			name:     "the refund over the max usdt is capped to it",
+			baseRate: "266255000000000", numerator: "361.3522", denominator: "0.0198", maxUsdt: "0.05",
+			decimal: 18,
+			wantWei: "2525252525252525252", wantUsdt: "0.05",
+		},
+		{
+			name:     "the refund under the max usdt is kept",
+			baseRate: "266255000000000", numerator: "361.3522", denominator: "0.0198", maxUsdt: "0.097",
+			decimal: 18,
+			wantWei: "4859183333888888888", wantUsdt: "0.096211830011",
+		},
+		{
+			name:     "the refund is moved into the 6 decimals paid out",
+			baseRate: "266255000000000", numerator: "361.3522", denominator: "0.0198",
+			shift: -12, decimal: 6,
+			wantWei: "4859183", wantUsdt: "0.0962118234",
+		},
+		{
+			name:     "0.3 / 0.1 is exact, the float64 gives 2999999999999999",
+			baseRate: "1e15", numerator: "0.3", denominator: "0.1",
+			decimal: 18,
+			wantWei: "3000000000000000", wantUsdt: "0.0003",
+		},
+		{
+			name:     "6.999999999999999997 / 7 is truncated, the quotient rounded at 18 places would be 1",
+			baseRate: "1", numerator: "6.999999999999999997", denominator: "7",
+			decimal: 18,
+			wantWei: "0", wantUsdt: "0",
+		},
+		{
+			name:     "the capped refund is truncated too, the quotient rounded at 18 places would pay 7 over the max usdt",
+			baseRate: "1e18", numerator: "7", denominator: "7", maxUsdt: "6.999999999999999997",
+			decimal: 0,
+			wantWei: "0", wantUsdt: "0",
+		},
+	} {
+		var maxUsdt *money.Decimal
+		if tc.maxUsdt != "" {
+			maxUsdt = parse(tc.maxUsdt)
+		}
+		gotWei, gotUsdt, err := gasfee.Refund(parse(tc.baseRate), parse(tc.numerator), parse(tc.denominator), maxUsdt, tc.shift, tc.decimal)
+		assert.NoError(t, err, tc.name)
+		assert.Equal(t, tc.wantWei, gotWei.String(), tc.name)
+		assert.Equal(t, tc.wantUsdt, gotUsdt.String(), tc.name)
+	}
+
+	// a denominator of 0 or less skips the refund instead of dividing by it
+	for _, denominator := range []string{"0", "-0.0198"} {
+		_, _, err := gasfee.Refund(parse("266255000000000"), parse("361.3522"), parse(denominator), nil, 0, 18)
+		assert.ErrorIs(t, err, gasfee.ErrInvalidPrice, denominator)
+	}
+}
+
+func Test_Reject(t *testing.T) {
+	dir := t.TempDir()
+	recipient := common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	queueFilepath := filepath.Join(dir, "queue.json")
+	listFilepath := filepath.Join(dir, "refunded_list.json")
+	tmpCurBlock, err := ioutil.TempFile(dir, "current_block_file_*")
+	assert.NoError(t, err)
+
+	// a held recipient marked refunded by an older version
+	assert.NoError(t, ioutil.WriteFile(queueFilepath, []byte(`{"next_id":2,"items":[{"id":1,"status":"pending","recipient":"`+recipient.Hex()+`","wei":10}]}`), 0o600))
+	assert.NoError(t, ioutil.WriteFile(listFilepath, []byte(`["`+recipient.Hex()+`"]`), 0o600))
+
+	client, privateKey := setup(t)
+	service, err := gasfee.New(client, &config.GasfeeService{
+		PrivateKey:                 privateKey,
+		CrawleInEveryMinutes:       3,
+		RefundEveryDayAt:           time.Now().UTC().Add(time.Hour),
+		RefundThreshold:            money.New(3),
+		CurrentBlockNumberFilepath: tmpCurBlock.Name(),
+		RefundedWeiFilepath:        filepath.Join(dir, "refunded_wei"),
+		RefundedListFilepath:       listFilepath,
+		Approval:                   &config.Approval{ThresholdWei: big.NewInt(1), QueueFilepath: queueFilepath},
+	}, nil)
+	assert.NoError(t, err)
+	defer service.Close()
+
+	item, err := service.Reject(1, "alice", "spam")
+	assert.NoError(t, err)
+	assert.Equal(t, recipient, item.Recipient)
+
+	b, err := ioutil.ReadFile(listFilepath)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[]`, string(b), "the rejected recipient is eligible again")
 }
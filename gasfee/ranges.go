@@ -0,0 +1,119 @@
+package gasfee
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// FailedRange is a block range failed to be queried, it's retried in the next run
+type FailedRange struct {
+	From     uint64    `json:"from"`
+	To       uint64    `json:"to"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// failedRanges keeps the outstanding failed ranges, they are persisted if the filepath is set
+type failedRanges struct {
+	mux      sync.Mutex
+	filepath string
+	ranges   []*FailedRange
+}
+
+func newFailedRanges(filepath string) (*failedRanges, error) {
+	f := &failedRanges{filepath: filepath, ranges: []*FailedRange{}}
+	if filepath == "" {
+		return f, nil
+	}
+
+	b, err := ioutil.ReadFile(filepath)
+	switch {
+	case os.IsNotExist(err):
+		// first time start up
+	case err != nil:
+		return nil, fmt.Errorf("failed ranges read file:%q failed:%w", filepath, err)
+	case len(b) > 0:
+		if err := json.Unmarshal(b, &f.ranges); err != nil {
+			return nil, fmt.Errorf("failed ranges json unmarshal failed:%w", err)
+		}
+	}
+	return f, nil
+}
+
+// fail records the range, replacing the overlapping ones and counting their attempts
+func (f *failedRanges) fail(from, to uint64, cause error, at time.Time) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	fr := &FailedRange{From: from, To: to, Attempts: 1, Error: cause.Error(), FailedAt: at}
+	rest := make([]*FailedRange, 0, len(f.ranges)+1)
+	for _, r := range f.ranges {
+		if r.From <= to && from <= r.To {
+			if r.Attempts+1 > fr.Attempts {
+				fr.Attempts = r.Attempts + 1
+			}
+			continue
+		}
+		rest = append(rest, r)
+	}
+	f.ranges = append(rest, fr)
+	return f.save()
+}
+
+// succeed drops the recorded ranges scanned successfully, a partly scanned one keeps the rest of it
+func (f *failedRanges) succeed(from, to uint64) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	changed := false
+	rest := make([]*FailedRange, 0, len(f.ranges))
+	for _, r := range f.ranges {
+		if r.From > to || from > r.To {
+			rest = append(rest, r)
+			continue
+		}
+		changed = true
+		if r.To > to {
+			r.From = to + 1
+			rest = append(rest, r)
+		}
+	}
+	if !changed {
+		return nil
+	}
+	f.ranges = rest
+	return f.save()
+}
+
+// list returns a copy of the outstanding failed ranges
+func (f *failedRanges) list() []*FailedRange {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	ranges := make([]*FailedRange, 0, len(f.ranges))
+	for _, r := range f.ranges {
+		cp := *r
+		ranges = append(ranges, &cp)
+	}
+	return ranges
+}
+
+func (f *failedRanges) save() error {
+	if f.filepath == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(f.ranges)
+	if err != nil {
+		return fmt.Errorf("failed ranges json marshal failed:%w", err)
+	}
+	if err := ioutil.WriteFile(f.filepath, b, 0o600); err != nil {
+		return fmt.Errorf("failed ranges write file:%q failed:%w", f.filepath, err)
+	}
+	return nil
+}
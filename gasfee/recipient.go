@@ -0,0 +1,80 @@
+package gasfee
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/FindoraNetwork/refunder/client"
+	"github.com/FindoraNetwork/refunder/config"
+	"github.com/FindoraNetwork/refunder/ledger"
+	"github.com/FindoraNetwork/refunder/payout"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// the decisions on the refund by the recipient balance
+const (
+	decisionKept    = "kept"
+	decisionReduced = "reduced"
+	decisionSkipped = "skipped"
+)
+
+// balanceRule skips or reduces the refund of a recipient already holding enough of the native token for the gas
+type balanceRule struct {
+	sufficientWei *big.Int
+	reduce        bool
+}
+
+// newBalanceRule returns the rule of the config, a nil config returns a nil rule keeping every refund
+func newBalanceRule(conf *config.RecipientBalance, payer *payout.Payer) (*balanceRule, error) {
+	if conf == nil {
+		return nil, nil
+	}
+	if conf.SufficientWei == nil || conf.SufficientWei.Sign() <= 0 {
+		return nil, errors.New("sufficient_wei is a MUST filled positive field")
+	}
+
+	r := &balanceRule{sufficientWei: conf.SufficientWei}
+	switch conf.Mode {
+	case "", "skip":
+	case "reduce":
+		// the top up is in the native token, so it cannot be taken from a refund in an ERC20 token
+		if payer != nil {
+			return nil, errors.New("mode reduce needs the native payout")
+		}
+		r.reduce = true
+	default:
+		return nil, fmt.Errorf("mode:%q is not skip or reduce", conf.Mode)
+	}
+	return r, nil
+}
+
+// apply reads the native balance and the nonce of the recipient, and returns the refund decided by them with the state for the ledger,
+// the recipient holding the sufficient wei or more is skipped, and the reduced refund tops the balance up to it
+func (r *balanceRule) apply(ctx context.Context, c client.Client, toAddr common.Address, refundValue *big.Int) (*big.Int, *ledger.RecipientState, error) {
+	if r == nil {
+		return refundValue, nil, nil
+	}
+
+	balanceWei, err := c.BalanceAt(ctx, toAddr, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("BalanceAt failed:%w, address:%s", err, toAddr)
+	}
+	nonce, err := c.NonceAt(ctx, toAddr, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("NonceAt failed:%w, address:%s", err, toAddr)
+	}
+
+	state := &ledger.RecipientState{BalanceWei: balanceWei, Nonce: nonce, Decision: decisionKept}
+	if balanceWei.Cmp(r.sufficientWei) >= 0 {
+		state.Decision = decisionSkipped
+		return big.NewInt(0), state, nil
+	}
+	if gap := big.NewInt(0).Sub(r.sufficientWei, balanceWei); r.reduce && refundValue.Cmp(gap) > 0 {
+		state.Decision = decisionReduced
+		return gap, state, nil
+	}
+	return refundValue, state, nil
+}
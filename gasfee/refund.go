@@ -0,0 +1,33 @@
+package gasfee
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/FindoraNetwork/refunder/money"
+)
+
+// ErrInvalidPrice skips the refund priced by a denominator of 0 or less
+var ErrInvalidPrice = errors.New("denominator price is not positive")
+
+// Refund returns the refund and its value in USDT, the refund is baseRate * numerator / denominator in the wei of the numerator,
+// moved by shift places into the smallest unit paid out of the decimal, a refund over the maxUsdt is capped to it, a nil maxUsdt caps nothing.
+// It's multiplied before divided, and the quotient is truncated into the unit without being rounded first, so a refund is never rounded up.
+func Refund(baseRate, numerator, denominator, maxUsdt *money.Decimal, shift, decimal int) (*big.Int, *money.Decimal, error) {
+	if denominator.Sign() <= 0 {
+		return nil, nil, ErrInvalidPrice
+	}
+
+	refund := baseRate.Mul(numerator).QuoUnits(denominator, shift)
+	usdt := toUsdt(refund, denominator, decimal)
+	if maxUsdt != nil && usdt.Cmp(maxUsdt) > 0 {
+		refund = maxUsdt.QuoUnits(denominator, decimal)
+		usdt = toUsdt(refund, denominator, decimal)
+	}
+	return refund, usdt, nil
+}
+
+// toUsdt prices the refund in the smallest unit of the decimal by the denominator
+func toUsdt(refund *big.Int, denominator *money.Decimal, decimal int) *money.Decimal {
+	return money.FromUnits(refund, decimal).Mul(denominator)
+}
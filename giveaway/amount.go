@@ -0,0 +1,152 @@
+package giveaway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/config"
+	"github.com/FindoraNetwork/refunder/money"
+	"github.com/FindoraNetwork/refunder/price"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type amounts struct {
+	byToken  map[common.Address]*config.GiveawayAmount
+	fallback *config.GiveawayAmount
+	// decimal is the decimal of the token paid out, its price is the native price
+	decimal int
+
+	priceSource *price.GateIO
+	pair        config.CurrencyPair
+	kind        config.PriceKind
+	ttl         time.Duration
+
+	mux       sync.Mutex
+	price     *money.Decimal
+	fetchedAt time.Time
+}
+
+func newAmounts(conf *config.GiveawayService, decimal int) (*amounts, error) {
+	a := &amounts{
+		byToken:     make(map[common.Address]*config.GiveawayAmount),
+		fallback:    &config.GiveawayAmount{Wei: conf.FixedGiveawayWei},
+		decimal:     decimal,
+		priceSource: price.NewGateIO(conf.CrawlingAddress),
+		pair:        conf.NativeCurrencyPair,
+		kind:        conf.NativePriceKind,
+		ttl:         time.Duration(conf.NativePriceTTLSec) * time.Second,
+	}
+
+	needPrice := false
+	for k, amount := range conf.GiveawayAmounts {
+		if amount.Wei == nil && amount.Usdt == nil {
+			return nil, fmt.Errorf("giveaway amount of %q has neither wei nor usdt", k)
+		}
+
+		tiers := make([]*config.GiveawayTier, len(amount.Tiers))
+		copy(tiers, amount.Tiers)
+		for _, tier := range tiers {
+			if tier.MinTransferAmount == nil || (tier.Wei == nil && tier.Usdt == nil) {
+				return nil, fmt.Errorf("giveaway amount of %q has an incomplete tier", k)
+			}
+			needPrice = needPrice || (tier.Wei == nil && tier.Usdt != nil)
+		}
+		// the highest tier comes first
+		sort.Slice(tiers, func(i, j int) bool {
+			return tiers[i].MinTransferAmount.Cmp(tiers[j].MinTransferAmount) > 0
+		})
+		needPrice = needPrice || (amount.Wei == nil && amount.Usdt != nil)
+
+		sorted := &config.GiveawayAmount{Wei: amount.Wei, Usdt: amount.Usdt, Tiers: tiers}
+		if strings.TrimSpace(k) == config.AnyToken {
+			a.fallback = sorted
+			continue
+		}
+		a.byToken[common.HexToAddress(k)] = sorted
+	}
+
+	if needPrice && !a.canPrice() {
+		return nil, errors.New("giveaway amounts in usdt need both crawling_address and native_currency_pair")
+	}
+
+	return a, nil
+}
+
+// get returns the giveaway amount in wei of the token and the bridged amount
+func (a *amounts) get(ctx context.Context, token common.Address, transferred *big.Int) (*big.Int, error) {
+	amount, ok := a.byToken[token]
+	if !ok {
+		amount = a.fallback
+	}
+
+	wei, usdt := amount.Wei, amount.Usdt
+	for _, tier := range amount.Tiers {
+		if transferred.Cmp(tier.MinTransferAmount) >= 0 {
+			wei, usdt = tier.Wei, tier.Usdt
+			break
+		}
+	}
+
+	if wei != nil {
+		return big.NewInt(0).Set(wei), nil
+	}
+	if usdt == nil {
+		return nil, fmt.Errorf("giveaway amount not configured, token_address:%s", token)
+	}
+
+	p, err := a.nativePrice(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	v := big.NewFloat(0).Quo(usdt, p.Float())
+	v.Mul(v, big.NewFloat(math.Pow10(a.decimal)))
+	result, _ := v.Int(nil)
+	return result, nil
+}
+
+// canPrice tells the native token price source has been configured
+func (a *amounts) canPrice() bool {
+	return a.priceSource.Address != "" && a.pair != ""
+}
+
+// toUsdt converts the wei into USDT with the native token price
+func (a *amounts) toUsdt(ctx context.Context, wei *big.Int) (*money.Decimal, error) {
+	p, err := a.nativePrice(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return money.FromUnits(wei, a.decimal).Mul(p), nil
+}
+
+// nativePrice returns the cached native token price in USDT, and crawls again once it is expired
+func (a *amounts) nativePrice(ctx context.Context) (*money.Decimal, error) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	if a.price != nil && time.Since(a.fetchedAt) < a.ttl {
+		return a.price, nil
+	}
+
+	candle, err := a.priceSource.Fetch(ctx, a.pair)
+	if err != nil {
+		return nil, fmt.Errorf("crawling native price failed:%w", err)
+	}
+
+	p := candle.Pick(a.kind)
+	if p.Sign() <= 0 {
+		return nil, fmt.Errorf("crawling native price not correct:%v, currency_pair:%s", p, a.pair)
+	}
+
+	a.price = p
+	a.fetchedAt = time.Now()
+	return a.price, nil
+}
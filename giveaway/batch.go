@@ -0,0 +1,141 @@
+package giveaway
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/ledger"
+	"github.com/FindoraNetwork/refunder/payout"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// pending is a giveaway waiting in the batch
+type pending struct {
+	rec     *ledger.Record
+	release func()
+}
+
+// batch collects the giveaways of a window, they're sent by a single multisend once it's full or the window ends,
+// the waiting ones are counted in the max cap until they're sent or failed
+type batch struct {
+	mux        sync.Mutex
+	items      []*pending
+	recipients map[common.Address]struct{}
+	wei        *big.Int
+	timer      *time.Timer
+}
+
+func newBatch() *batch {
+	return &batch{recipients: make(map[common.Address]struct{}), wei: big.NewInt(0)}
+}
+
+// pendingWei returns the sum of the giveaways waiting in the batch
+func (b *batch) pendingWei() *big.Int {
+	if b == nil {
+		return big.NewInt(0)
+	}
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return big.NewInt(0).Set(b.wei)
+}
+
+// take detaches the waiting giveaways to be sent, they're still counted until done
+func (b *batch) take() []*pending {
+	if b == nil {
+		return nil
+	}
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	items := b.items
+	b.items = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	return items
+}
+
+// done drops the sent or failed giveaway
+func (b *batch) done(item *pending) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	delete(b.recipients, item.rec.Recipient)
+	b.wei.Sub(b.wei, item.rec.Wei)
+}
+
+// enqueue puts the giveaway into the batch, a recipient already waiting in it is not eligible
+func (s *Service) enqueue(rec *ledger.Record) error {
+	b := s.batch
+	b.mux.Lock()
+	if _, ok := b.recipients[rec.Recipient]; ok {
+		b.mux.Unlock()
+		s.stdoutlogger.Printf("handler not eligible, already waiting in the batch, to_address:%s, tx_hash:%s", rec.Recipient, rec.SourceTxHash)
+		return ErrNotEligible
+	}
+
+	b.items = append(b.items, &pending{rec: rec, release: s.limits.Reserve(time.Now(), rec.Token, rec.Recipient, rec.Wei)})
+	b.recipients[rec.Recipient] = struct{}{}
+	b.wei.Add(b.wei, rec.Wei)
+	full := len(b.items) >= s.batcher.MaxSize()
+	if !full && b.timer == nil {
+		b.timer = time.AfterFunc(s.batcher.Window(), s.flush)
+	}
+	b.mux.Unlock()
+
+	if full {
+		s.flush()
+	}
+	return nil
+}
+
+// flush sends the giveaways waiting in the batch by a single multisend, a failed batch falls back to the giveaways one by one
+func (s *Service) flush() {
+	items := s.batch.take()
+	if len(items) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.handlerTotalTimeout)
+	defer cancel()
+
+	recs := make([]*ledger.Record, 0, len(items))
+	for _, item := range items {
+		recs = append(recs, item.rec)
+	}
+
+	results := make([]*payout.Result, len(items))
+	c, err := s.client.DialRPC()
+	if err != nil {
+		err = fmt.Errorf("batch client dialing failed:%w", err)
+		for i, rec := range recs {
+			results[i] = &payout.Result{Err: s.sender.Failed(rec, err)}
+		}
+	} else {
+		defer c.Close()
+		results = s.sender.SendBatch(ctx, c, recs, s.settle)
+	}
+
+	for i, item := range items {
+		item.release()
+		s.batch.done(item)
+
+		r := results[i]
+		if r.Err != nil {
+			s.stderrlogger.Printf("batch %v, to_address:%s, giveaway:%s, tx_hash:%s", r.Err, item.rec.Recipient, item.rec.Wei, item.rec.SourceTxHash)
+			continue
+		}
+		s.stdoutlogger.Printf(`handler success, to_address:%v, giveaway:%v, current_giveout:%v, current_nonce:%v, refund_tx_hash:%v, tx_hash:%v`,
+			item.rec.Recipient,
+			item.rec.Wei,
+			r.Total,
+			r.Tx.Nonce(),
+			r.Tx.Hash(),
+			item.rec.SourceTxHash,
+		)
+	}
+}
@@ -0,0 +1,38 @@
+package giveaway
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/FindoraNetwork/refunder/config"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Amount returns the giveaway amount of the config for the tests, like the handler does for a bridged transfer
+func Amount(ctx context.Context, conf *config.GiveawayService, decimal int, token common.Address, transferred *big.Int) (*big.Int, error) {
+	a, err := newAmounts(conf, decimal)
+	if err != nil {
+		return nil, err
+	}
+	return a.get(ctx, token, transferred)
+}
+
+// Paid adds the recipients into the gave list of the filepath, then reads it again and tells it has the one, like after a restart
+func Paid(filepath string, recipients []common.Address, toAddress common.Address) (bool, error) {
+	p, err := newPaid(filepath)
+	if err != nil {
+		return false, err
+	}
+	for _, recipient := range recipients {
+		if err := p.add(recipient); err != nil {
+			return false, err
+		}
+	}
+
+	p, err = newPaid(filepath)
+	if err != nil {
+		return false, err
+	}
+	return p.has(toAddress), nil
+}
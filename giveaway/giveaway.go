@@ -2,54 +2,123 @@ package giveaway
 
 import (
 	"context"
-	"crypto/ecdsa"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"math/big"
 	"os"
+	"sync"
 	"time"
 
+	"github.com/FindoraNetwork/refunder/approval"
+	"github.com/FindoraNetwork/refunder/balance"
+	"github.com/FindoraNetwork/refunder/budget"
 	"github.com/FindoraNetwork/refunder/client"
 	"github.com/FindoraNetwork/refunder/config"
-	"github.com/gorilla/websocket"
+	"github.com/FindoraNetwork/refunder/eligibility"
+	"github.com/FindoraNetwork/refunder/indexer"
+	"github.com/FindoraNetwork/refunder/ledger"
+	"github.com/FindoraNetwork/refunder/money"
+	"github.com/FindoraNetwork/refunder/notifier"
+	"github.com/FindoraNetwork/refunder/payout"
+	"github.com/FindoraNetwork/refunder/signer"
+	"github.com/FindoraNetwork/refunder/sybil"
+	"github.com/FindoraNetwork/refunder/window"
 
-	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 )
 
 type Service struct {
-	client           client.Client
-	eventLogPoolSize int
-	done             chan struct{}
+	// name is the service name qualified by the network name
+	name    string
+	client  client.Client
+	indexer *indexer.Indexer
 
 	stdoutlogger *log.Logger
 	stderrlogger *log.Logger
 
-	subscribeTimeout    time.Duration
 	handlerTotalTimeout time.Duration
 
-	filterQuery ethereum.FilterQuery
-
-	privateKey         *ecdsa.PrivateKey
+	sender             *payout.Sender
+	payer              *payout.Payer
+	batcher            *payout.Batcher
+	gas                *payout.Gas
+	batch              *batch
 	fromAddress        common.Address
 	maxCapWei          *big.Int
-	fixedGiveawayWei   *big.Int
+	amounts            *amounts
 	curGaveWeiFilepath string
+	paid               *paid
+	rules              *eligibility.ByToken
+	limits             *budget.Limiter
+	detector           *sybil.Detector
+	queue              *approval.Queue
+	balance            *balance.Monitor
+	notifier           *notifier.Notifier
+	ledger             *ledger.Ledger
+	window             *window.Window
+	endOnce            sync.Once
+	endTimer           *time.Timer
 }
 
-func New(c client.Client, conf *config.GiveawayService) (*Service, error) {
-	privateKey, err := crypto.HexToECDSA(conf.PrivateKey)
+func New(c client.Client, conf *config.GiveawayService, n *notifier.Notifier) (*Service, error) {
+	txSigner, err := signer.New(conf.Signer, conf.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("new on signer failed:%w", err)
+	}
+
+	payer, err := payout.New(conf.Payout)
+	if err != nil {
+		return nil, fmt.Errorf("new on payout failed:%w", err)
+	}
+
+	batcher, err := payout.NewBatcher(conf.Batch)
+	if err != nil {
+		return nil, fmt.Errorf("new on batch failed:%w", err)
+	}
+
+	// the eligibility by the native balance and the nonce passes again and again for a recipient paid in a token
+	if payer != nil && conf.GaveListFilepath == "" {
+		return nil, errors.New("new on payout failed: gave_list_filepath is a MUST filled field with the payout token")
+	}
+	paid, err := newPaid(conf.GaveListFilepath)
+	if err != nil {
+		return nil, fmt.Errorf("new on gave list failed:%w", err)
+	}
+
+	amounts, err := newAmounts(conf, payer.Decimal())
+	if err != nil {
+		return nil, fmt.Errorf("new on giveaway amounts failed:%w", err)
+	}
+
+	limits, err := budget.New(conf.Limits)
 	if err != nil {
-		return nil, fmt.Errorf("new on crypto.HexToECDSA private key failed:%w", err)
+		return nil, fmt.Errorf("new on limits failed:%w", err)
 	}
 
-	publicKey, ok := privateKey.Public().(*ecdsa.PublicKey)
-	if !ok {
-		return nil, fmt.Errorf("new on casting public key to ECDSA failed")
+	detector, err := sybil.New(conf.SybilDetection)
+	if err != nil {
+		return nil, fmt.Errorf("new on sybil detection failed:%w", err)
+	}
+
+	queue, err := approval.New(conf.Approval)
+	if err != nil {
+		return nil, fmt.Errorf("new on approval queue failed:%w", err)
+	}
+	if detector != nil && queue == nil {
+		return nil, errors.New("new on sybil detection failed: approval is a MUST filled field")
+	}
+	gas, err := payout.NewGas(conf.Gas)
+	if err != nil {
+		return nil, fmt.Errorf("new on gas failed:%w", err)
+	}
+	if gas.Holds() && queue == nil {
+		return nil, errors.New("new on gas failed: on_failure hold needs the approval")
+	}
+	if queue != nil && conf.Approval.ThresholdUsdt != nil && !amounts.canPrice() {
+		return nil, errors.New("new on approval failed: threshold_usdt needs both crawling_address and native_currency_pair")
 	}
 
 	addresses := make([]common.Address, 0, len(conf.TokenAddresses))
@@ -57,28 +126,76 @@ func New(c client.Client, conf *config.GiveawayService) (*Service, error) {
 		addresses = append(addresses, common.HexToAddress(address))
 	}
 
+	triggers, err := indexer.NewTriggers(conf.Triggers, addresses)
+	if err != nil {
+		return nil, fmt.Errorf("new on triggers failed:%w", err)
+	}
+	if conf.NativeTrigger != nil && len(conf.Triggers) > 0 {
+		return nil, errors.New("native_trigger and triggers are exclusive")
+	}
+	native, err := indexer.NewNativeTrigger(conf.NativeTrigger)
+	if err != nil {
+		return nil, fmt.Errorf("new on native trigger failed:%w", err)
+	}
+
+	name := config.Namespaced(conf.Network, "giveaway")
+	ix, err := indexer.New(c, &indexer.Options{
+		Name:             name,
+		Triggers:         triggers,
+		Native:           native,
+		CursorFilepath:   conf.CursorFilepath,
+		StartBlock:       conf.StartBlockNumber,
+		SubscribeTimeout: time.Duration(conf.SubscripTimeoutSec) * time.Second,
+		PoolSize:         conf.EventLogPoolSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("new on indexer failed:%w", err)
+	}
+
 	s := &Service{
+		name:                name,
 		client:              c,
-		stdoutlogger:        log.New(os.Stdout, "giveawayService:", log.Lmsgprefix),
-		stderrlogger:        log.New(os.Stderr, "giveawayService:", log.Lmsgprefix),
-		done:                make(chan struct{}),
-		subscribeTimeout:    time.Duration(conf.SubscripTimeoutSec) * time.Second,
+		stdoutlogger:        log.New(os.Stdout, name+"Service:", log.Lmsgprefix),
+		stderrlogger:        log.New(os.Stderr, name+"Service:", log.Lmsgprefix),
 		handlerTotalTimeout: time.Duration(conf.HandlerTotalTimeoutSec) * time.Second,
-		eventLogPoolSize:    conf.EventLogPoolSize,
-		filterQuery: ethereum.FilterQuery{
-			Addresses: addresses,
-			Topics: [][]common.Hash{
-				{crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))},
-				{common.BytesToHash([]byte(""))},
-			},
-		},
-		privateKey:         privateKey,
-		fromAddress:        crypto.PubkeyToAddress(*publicKey),
-		fixedGiveawayWei:   conf.FixedGiveawayWei,
-		maxCapWei:          conf.MaxCapWei,
-		curGaveWeiFilepath: conf.CurrentGaveWeiFilepath,
+		indexer:             ix,
+		payer:               payer,
+		batcher:             batcher,
+		gas:                 gas,
+		fromAddress:         txSigner.Address(),
+		amounts:             amounts,
+		maxCapWei:           conf.MaxCapWei,
+		curGaveWeiFilepath:  conf.CurrentGaveWeiFilepath,
+		paid:                paid,
+		rules:               eligibility.NewByToken(conf.EligibilityRules, native.Token()),
+		limits:              limits,
+		detector:            detector,
+		queue:               queue,
+		balance:             balance.New(name, c, txSigner.Address(), conf.BalanceMonitor),
+		notifier:            n,
+		ledger:              ledger.Open(conf.LedgerFilepath),
+		window:              window.New(conf.Window),
 	}
 
+	s.sender = payout.NewSender(&payout.SenderOptions{
+		Name:     name,
+		Signer:   txSigner,
+		Payer:    payer,
+		Batcher:  batcher,
+		Gas:      gas,
+		Balance:  s.balance,
+		Ledger:   s.ledger,
+		Notifier: n,
+	})
+	if batcher != nil {
+		s.batch = newBatch()
+	}
+
+	s.balance.OnAlert(func(a *balance.Alert) {
+		s.notifier.Notify(notifier.LowBalance, s.name, a.String(), nil)
+	})
+	s.balance.Start()
+	s.watchWindow()
 	if err := s.Start(); err != nil {
 		return nil, fmt.Errorf("new on starting service failed:%w", err)
 	}
@@ -88,194 +205,468 @@ func New(c client.Client, conf *config.GiveawayService) (*Service, error) {
 	return s, nil
 }
 
-// Start fork out a goroutine to listen to specific event log which is defined in filterQuery field then bypass into the handler
+// Start streams the Transfer events of the tokens from the indexer into the handler
 func (s *Service) Start() error {
-	subscribing := func() (ethereum.Subscription, chan types.Log, error) {
-		c, err := s.client.DialWS()
-		if err != nil {
-			return nil, nil, fmt.Errorf("start dialing to server failed:%w", err)
+	s.indexer.OnDead(func(err error) {
+		s.notifier.Notify(notifier.SubscriptionDead, s.name, err.Error(), nil)
+	})
+	return s.indexer.Start(func(vlog *indexer.Transfer) {
+		if err := s.handler(vlog); err != nil {
+			switch err {
+			case ErrNotEligible, ErrHeld, ErrOutsideWindow, balance.ErrPaused:
+			default:
+				s.stderrlogger.Println(err)
+			}
 		}
+	})
+}
 
-		logChan := make(chan types.Log, s.eventLogPoolSize)
-		ctx, cancel := context.WithTimeout(context.Background(), s.subscribeTimeout)
-		defer cancel()
+// watchWindow ends the window by a timer, so the time bound ends without waiting for an event
+// the block bound ends by the first event after it
+func (s *Service) watchWindow() {
+	endAt := s.window.EndAt()
+	if endAt.IsZero() {
+		return
+	}
 
-		sub, err := c.SubscribeFilterLogs(ctx, s.filterQuery, logChan)
-		if err != nil {
-			return nil, nil, fmt.Errorf("subscribe filter logs failed:%w", err)
-		}
-		return sub, logChan, nil
-	}
-
-	sub, logChan, suberr := subscribing()
-	if suberr != nil {
-		return suberr
-	}
-
-	go func() {
-		for {
-			select {
-			case <-s.done:
-				sub.Unsubscribe()
-				return
-			case err := <-sub.Err():
-				switch {
-				case websocket.IsCloseError(err, websocket.CloseAbnormalClosure):
-					s.stdoutlogger.Println("websocket.CloseAbnormalClosure try to reconnect")
-					sub, logChan, suberr = subscribing()
-					if suberr != nil {
-						s.stderrlogger.Printf("websocket.CloseAbnormalClosure reconnect failed:%v, service stop", suberr)
-						return
-					}
-				case os.IsTimeout(err):
-					s.stdoutlogger.Println("websocket.read i/o timeout try to reconnect")
-					sub, logChan, suberr = subscribing()
-					if suberr != nil {
-						s.stderrlogger.Printf("websocket.read i/o timeout reconnect failed:%v, service stop", suberr)
-						return
-					}
-				case err == nil:
-					// this is weird, but it's really happening...
-					s.stdoutlogger.Println("websocket received nil error try to reconnect")
-					sub, logChan, suberr = subscribing()
-					if suberr != nil {
-						s.stderrlogger.Printf("websocket received nil error reconnect failed:%v, service stop", suberr)
-						return
-					}
-				default:
-					s.stderrlogger.Printf("subscribe websocket receive error:%v", err)
-				}
-
-			case vlog := <-logChan:
-				if err := s.handler(vlog); err != nil {
-					switch err {
-					case ErrNotEligible:
-						continue
-					default:
-						s.stderrlogger.Println(err)
-					}
-				}
+	if wait := time.Until(endAt); wait > 0 {
+		s.endTimer = time.AfterFunc(wait, s.endWindow)
+		return
+	}
 
-			}
+	// the summary has been notified before restarting
+	s.endOnce.Do(func() {
+		s.stdoutlogger.Printf("window:%s already ended, the events are ignored", s.window)
+	})
+}
+
+// endWindow notifies the final summary once the window ends
+func (s *Service) endWindow() {
+	s.endOnce.Do(func() {
+		fields := map[string]interface{}{"window": s.window.String()}
+		if b, err := ioutil.ReadFile(s.curGaveWeiFilepath); err == nil {
+			fields["gave_wei"] = big.NewInt(0).SetBytes(b).String()
 		}
-	}()
-	return nil
+		if s.maxCapWei != nil {
+			fields["max_cap_wei"] = s.maxCapWei.String()
+		}
+
+		s.stdoutlogger.Printf("window ended, final summary:%v", fields)
+		s.notifier.Notify(notifier.CampaignEnded, s.name, "window ended", fields)
+	})
 }
 
 // Close stops the fork out goroutine from Start method
 func (s *Service) Close() {
-	close(s.done)
+	if s.endTimer != nil {
+		s.endTimer.Stop()
+	}
+	s.balance.Close()
+	s.indexer.Close()
+	s.flush()
 }
 
-var ErrNotEligible = errors.New("not eligible with the condition")
+// Status is the snapshot of the service for the admin api
+type Status struct {
+	FromAddress      common.Address  `json:"from_address"`
+	GaveWei          *big.Int        `json:"gave_wei"`
+	MaxCapWei        *big.Int        `json:"max_cap_wei"`
+	Limits           *budget.Status  `json:"limits,omitempty"`
+	PendingApprovals int             `json:"pending_approvals"`
+	Balance          *balance.Status `json:"balance,omitempty"`
+	Window           string          `json:"window"`
+}
 
-func (s *Service) handler(vlog types.Log) error {
-	ctx, cancel := context.WithTimeout(context.Background(), s.handlerTotalTimeout)
-	defer cancel()
+// Status returns the current gave out wei and the remaining budgets
+func (s *Service) Status() interface{} {
+	st := &Status{
+		FromAddress:      s.fromAddress,
+		Window:           s.window.String(),
+		MaxCapWei:        s.maxCapWei,
+		Limits:           s.limits.Status(time.Now()),
+		PendingApprovals: s.queue.Pending(),
+		Balance:          s.balance.Status(),
+	}
+	if b, err := ioutil.ReadFile(s.curGaveWeiFilepath); err == nil {
+		st.GaveWei = big.NewInt(0).SetBytes(b)
+	}
+	return st
+}
 
-	// for searching logs usage to know which group of logs are in the same request
-	txHash := vlog.TxHash.String()
+var (
+	ErrNotEligible     = errors.New("not eligible with the condition")
+	ErrHeld            = errors.New("held for the manual approval")
+	ErrNoApprovalQueue = errors.New("approval queue is not configured")
+	ErrOutsideWindow   = errors.New("event is outside the window")
+)
+
+// detect runs the sybil detection on the bridge transaction, and returns the reasons if it's suspicious
+func (s *Service) detect(ctx context.Context, c client.Client, vlog *indexer.Transfer, toAddress common.Address) ([]string, error) {
+	if s.detector == nil {
+		return nil, nil
+	}
+
+	o := &sybil.Observation{
+		At:        time.Now(),
+		TxHash:    vlog.TxHash,
+		Token:     vlog.Token,
+		Recipient: toAddress,
+	}
+
+	tx, _, err := c.TransactionByHash(ctx, vlog.TxHash)
+	if err != nil {
+		return nil, fmt.Errorf("TransactionByHash failed:%w", err)
+	}
+	if tx != nil {
+		if o.Source, err = types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx); err != nil {
+			return nil, fmt.Errorf("types.Sender failed:%w", err)
+		}
+		if tx.To() != nil {
+			o.Bridge = *tx.To()
+		}
+	}
+
+	reasons, err := s.detector.Observe(o)
+	if err != nil {
+		return nil, err
+	}
+	if len(reasons) > 0 {
+		s.stdoutlogger.Printf("handler sybil suspicious, reasons:%v, source:%s, to_address:%s, tx_hash:%s", reasons, o.Source, toAddress, vlog.TxHash)
+	}
+	return reasons, nil
+}
+
+// hold puts the payout into the approval queue if it's flagged or over the thresholds
+func (s *Service) hold(ctx context.Context, vlog *indexer.Transfer, toAddress common.Address, giveawayWei *big.Int, reasons []string) error {
+	if s.queue == nil {
+		return nil
+	}
+
+	var usdt *money.Decimal
+	if s.queue.UsdtThreshold() != nil {
+		var err error
+		if usdt, err = s.amounts.toUsdt(ctx, giveawayWei); err != nil {
+			return err
+		}
+	}
+
+	if s.queue.Over(giveawayWei, usdt) {
+		reasons = append(reasons, "over_threshold")
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
 
-	if len(vlog.Topics) != 3 {
-		return fmt.Errorf("handler receive not expecting format on topics:%v, tx_hash:%s", vlog.Topics, txHash)
+	item, err := s.queue.Hold(&approval.Item{
+		TxHash:    vlog.TxHash,
+		Token:     vlog.Token,
+		Recipient: toAddress,
+		Wei:       giveawayWei,
+		Usdt:      usdt,
+		Reasons:   reasons,
+	})
+	if err != nil {
+		return err
 	}
 
+	if err := s.ledger.Append(&ledger.Record{
+		Service:      s.name,
+		SourceTxHash: vlog.TxHash,
+		LogIndex:     vlog.Index,
+		Token:        vlog.Token,
+		Recipient:    toAddress,
+		Wei:          giveawayWei,
+		Usdt:         item.UsdtFloat(),
+		ApprovalID:   item.ID,
+		Reasons:      reasons,
+		Status:       ledger.Held,
+	}); err != nil {
+		s.stderrlogger.Printf("ledger appending failed:%v, tx_hash:%s", err, vlog.TxHash)
+	}
+
+	s.stdoutlogger.Printf("handler held for approval, id:%d, reasons:%v, to_address:%s, giveaway:%s, tx_hash:%s", item.ID, reasons, toAddress, giveawayWei, vlog.TxHash)
+	return ErrHeld
+}
+
+// checkCaps returns ErrNotEligible if the payout is stopped by the max cap or the limits
+func (s *Service) checkCaps(token, toAddress common.Address, giveawayWei *big.Int) error {
 	curGivedWeiB, err := ioutil.ReadFile(s.curGaveWeiFilepath)
 	if err != nil {
-		return fmt.Errorf("handler open file:%q failed:%w", s.curGaveWeiFilepath, err)
+		return fmt.Errorf("open file:%q failed:%w", s.curGaveWeiFilepath, err)
 	}
 	curGivedWei := big.NewInt(0).SetBytes(curGivedWeiB)
+	// the giveaways waiting in the batch are counted as given out
+	curGivedWei.Add(curGivedWei, s.batch.pendingWei())
+
+	if s.maxCapWei != nil && curGivedWei.Cmp(s.maxCapWei) >= 0 {
+		s.stdoutlogger.Printf("not eligible, rule:max_cap, to_address:%s, current_giveout:%s", toAddress, curGivedWei)
+		s.notifier.Notify(notifier.CapReached, s.name, "max cap reached", map[string]interface{}{
+			"max_cap_wei":     s.maxCapWei.String(),
+			"current_giveout": curGivedWei.String(),
+		})
+		return ErrNotEligible
+	}
 
-	toAddress := common.BytesToAddress(common.TrimLeftZeroes(vlog.Topics[2].Bytes()))
-	blockNumber := big.NewInt(0).SetUint64(vlog.BlockNumber)
+	if err := s.limits.Allow(time.Now(), token, toAddress, giveawayWei); err != nil {
+		if budget.IsExceeded(err) {
+			s.stdoutlogger.Printf("not eligible, %v, to_address:%s", err, toAddress)
+			var exceeded *budget.Exceeded
+			if errors.As(err, &exceeded) && exceeded.Limit != "recipient_payouts" && exceeded.Limit != "recipient_wei" {
+				s.notifier.Notify(notifier.CapReached, s.name, err.Error(), nil)
+			}
+			return ErrNotEligible
+		}
+		return fmt.Errorf("checking limits failed:%w", err)
+	}
 
-	c, err := s.client.DialRPC()
+	return nil
+}
+
+// settle updates the gave out wei, the paid recipients and the limits by the sent giveaway, and returns the gave out wei
+func (s *Service) settle(rec *ledger.Record) (*big.Int, error) {
+	curGivedWeiB, err := ioutil.ReadFile(s.curGaveWeiFilepath)
 	if err != nil {
-		return fmt.Errorf("handler client dialing failed:%w, tx_hash:%s", err, txHash)
+		return nil, fmt.Errorf("open file:%q failed:%w", s.curGaveWeiFilepath, err)
 	}
-	defer c.Close()
+	curGivedWei := big.NewInt(0).SetBytes(curGivedWeiB)
 
-	// there has an issue if specific the blockNumber
-	// BalanceAt failed: block number: 200408 exceeds version range: 1..200407
-	// so use latest blockNumber for
-	// - BalanceAt and
-	// - NonceAt
-	toBalance, err := c.BalanceAt(ctx, toAddress, nil)
-	if err != nil {
-		return fmt.Errorf("handler toAddress BalanceAt failed:%w, tx_hash:%s, to_address:%s", err, txHash, toAddress)
+	curGivedWei = curGivedWei.Add(curGivedWei, rec.Wei)
+	if err := ioutil.WriteFile(s.curGaveWeiFilepath, curGivedWei.Bytes(), os.ModeType); err != nil {
+		return nil, fmt.Errorf("write file:%q failed:%w", s.curGaveWeiFilepath, err)
+	}
+
+	if err := s.paid.add(rec.Recipient); err != nil {
+		return nil, err
+	}
+
+	if err := s.limits.Record(time.Now(), rec.Token, rec.Recipient, rec.Wei); err != nil {
+		return nil, fmt.Errorf("recording limits failed:%w", err)
 	}
+	return curGivedWei, nil
+}
+
+func (s *Service) handler(vlog *indexer.Transfer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.handlerTotalTimeout)
+	defer cancel()
+
+	// for searching logs usage to know which group of logs are in the same request
+	txHash := vlog.TxHash.String()
+
+	toAddress := vlog.Recipient
+	blockNumber := big.NewInt(0).SetUint64(vlog.BlockNumber)
+	amount := vlog.Amount
 
-	toNonce, err := c.NonceAt(ctx, toAddress, nil)
+	if pos := s.window.At(vlog.BlockNumber, time.Now()); pos != window.Within {
+		s.stdoutlogger.Printf("handler ignored, %s the window:%s, to_address:%s, block_number:%s, tx_hash:%s", pos, s.window, toAddress, blockNumber, txHash)
+		if pos == window.After {
+			s.endWindow()
+		}
+		return ErrOutsideWindow
+	}
+
+	c, err := s.client.DialRPC()
 	if err != nil {
-		return fmt.Errorf("handler toAddress NonceAt failed:%w, tx_hash:%s, to_address:%s", err, txHash, toAddress)
+		return fmt.Errorf("handler client dialing failed:%w, tx_hash:%s", err, txHash)
 	}
+	defer c.Close()
 
-	s.stdoutlogger.Printf(`handler receiving, to_address:%s, to_balance:%s, to_nonce:%d, block_number:%s, fix_giveaway:%s, max_cap:%s, current_giveout:%s, tx_hash:%s`,
+	s.stdoutlogger.Printf(`handler receiving, to_address:%s, token_address:%s, amount:%s, block_number:%s, max_cap:%s, tx_hash:%s`,
 		toAddress,
-		toBalance,
-		toNonce,
+		vlog.Token,
+		amount,
 		blockNumber,
-		s.fixedGiveawayWei,
 		s.maxCapWei,
-		curGivedWei,
 		txHash,
 	)
 
-	if toBalance.Cmp(big.NewInt(0)) != 0 || toNonce != 0 || curGivedWei.Cmp(s.maxCapWei) >= 0 {
+	if s.paid.has(toAddress) {
+		s.stdoutlogger.Printf("handler not eligible, rule:already_paid, to_address:%s, tx_hash:%s", toAddress, txHash)
+		return ErrNotEligible
+	}
+	// a held recipient still passes the rules, so each further transfer would hold it again
+	if s.queue.Held("", toAddress) {
+		s.stdoutlogger.Printf("handler not eligible, rule:already_held, to_address:%s, tx_hash:%s", toAddress, txHash)
 		return ErrNotEligible
 	}
 
-	nonce, err := c.PendingNonceAt(ctx, s.fromAddress)
+	rejection, err := s.rules.Get(vlog.Token).Check(ctx, c, &eligibility.Candidate{
+		Token:       vlog.Token,
+		Recipient:   toAddress,
+		Amount:      amount,
+		BlockNumber: vlog.BlockNumber,
+	})
 	if err != nil {
-		return fmt.Errorf("handler PendingNonceAt failed:%w, tx_hash:%s", err, txHash)
+		return fmt.Errorf("handler checking eligibility failed:%w, tx_hash:%s, to_address:%s", err, txHash, toAddress)
+	}
+	if rejection != nil {
+		s.stdoutlogger.Printf("handler not eligible, %s, to_address:%s, tx_hash:%s", rejection, toAddress, txHash)
+		return ErrNotEligible
 	}
 
-	gasPrice, err := c.SuggestGasPrice(ctx)
+	giveawayWei, err := s.amounts.get(ctx, vlog.Token, amount)
 	if err != nil {
-		return fmt.Errorf("handler SuggestGasPrice failed:%w, tx_hash:%s", err, txHash)
+		return fmt.Errorf("handler getting giveaway amount failed:%w, tx_hash:%s", err, txHash)
 	}
 
-	chainID, err := c.NetworkID(ctx)
-	if err != nil {
-		return fmt.Errorf("handler NetworkID failed:%w, tx_hash:%s", err, txHash)
-	}
-
-	tx, err := types.SignTx(
-		types.NewTx(&types.LegacyTx{
-			Nonce: nonce,
-			// recipient address
-			To: &toAddress,
-			// wei(10^18)
-			Value: s.fixedGiveawayWei,
-			// 21000 gas is the default value for transfering native token
-			Gas:      uint64(21000),
-			GasPrice: gasPrice,
-			// 0x data is the default value for transfering native token
-			Data: nil,
-		}),
-		types.NewEIP155Signer(chainID),
-		s.privateKey,
-	)
+	if err := s.checkCaps(vlog.Token, toAddress, giveawayWei); err != nil {
+		if err == ErrNotEligible {
+			return err
+		}
+		return fmt.Errorf("handler %w, tx_hash:%s", err, txHash)
+	}
+
+	reasons, err := s.detect(ctx, c, vlog, toAddress)
 	if err != nil {
-		return fmt.Errorf("handler SignTx failed:%w, tx_hash:%s", err, txHash)
+		return fmt.Errorf("handler sybil detection failed:%w, tx_hash:%s", err, txHash)
 	}
 
-	if err := c.SendTransaction(ctx, tx); err != nil {
-		return fmt.Errorf("handler SendTransaction failed:%w, tx_hash:%s", err, txHash)
+	rec := &ledger.Record{
+		Service:      s.name,
+		SourceTxHash: vlog.TxHash,
+		LogIndex:     vlog.Index,
+		Token:        vlog.Token,
+		Recipient:    toAddress,
+		Wei:          giveawayWei,
 	}
 
-	curGivedWei = curGivedWei.Add(curGivedWei, s.fixedGiveawayWei)
-	if err := ioutil.WriteFile(s.curGaveWeiFilepath, curGivedWei.Bytes(), os.ModeType); err != nil {
-		return fmt.Errorf("handler write file:%q failed:%w", s.curGaveWeiFilepath, err)
+	// the recipient whose gas estimate fails is held for approval or skipped, instead of broadcasting a payout going to revert
+	if rec.Gas, err = s.payer.Estimate(ctx, c, s.gas, s.fromAddress, toAddress, giveawayWei, nil); err != nil {
+		if !errors.Is(err, payout.ErrGasEstimate) {
+			return fmt.Errorf("handler %w, tx_hash:%s", err, txHash)
+		}
+		if !s.gas.Holds() {
+			s.stdoutlogger.Printf("handler not eligible, %v, to_address:%s, tx_hash:%s", s.sender.Failed(rec, err), toAddress, txHash)
+			return ErrNotEligible
+		}
+		reasons = append(reasons, "gas_estimate_failed")
 	}
 
-	s.stdoutlogger.Printf(`handler success, to_address:%v, block_number:%v, current_giveout:%v, current_nonce:%v, tx_hash:%v`,
+	if err := s.hold(ctx, vlog, toAddress, giveawayWei, reasons); err != nil {
+		if err == ErrHeld {
+			return err
+		}
+		return fmt.Errorf("handler holding for approval failed:%w, tx_hash:%s", err, txHash)
+	}
+	if s.batcher != nil {
+		if err := s.enqueue(rec); err != nil {
+			return err
+		}
+		s.stdoutlogger.Printf("handler batched, to_address:%s, block_number:%v, giveaway:%s, tx_hash:%s", toAddress, blockNumber, giveawayWei, txHash)
+		return nil
+	}
+
+	tx, curGivedWei, err := s.sender.Send(ctx, c, rec, s.settle)
+	if err == balance.ErrPaused {
+		s.stdoutlogger.Printf("handler %v, to_address:%s, giveaway:%s, tx_hash:%s", err, toAddress, giveawayWei, txHash)
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("handler %w, tx_hash:%s", err, txHash)
+	}
+
+	s.stdoutlogger.Printf(`handler success, to_address:%v, block_number:%v, giveaway:%v, current_giveout:%v, current_nonce:%v, tx_hash:%v`,
 		toAddress,
 		blockNumber,
+		giveawayWei,
 		curGivedWei,
-		nonce,
+		tx.Nonce(),
 		txHash,
 	)
 
 	return nil
 }
+
+// List returns the approval items with the status, an empty status returns all
+func (s *Service) List(status approval.Status) []*approval.Item {
+	if s.queue == nil {
+		return []*approval.Item{}
+	}
+	return s.queue.List(status)
+}
+
+// Approve sends a pending payout through the normal sending path, the max cap and limits still apply
+func (s *Service) Approve(id uint64, by, note string) (*approval.Item, error) {
+	if s.queue == nil {
+		return nil, ErrNoApprovalQueue
+	}
+
+	item, err := s.queue.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if item.Status != approval.Pending {
+		return nil, fmt.Errorf("%w, id:%d, status:%s", approval.ErrNotPending, id, item.Status)
+	}
+
+	if s.alreadyPaid(item.Recipient) {
+		return nil, fmt.Errorf("approve id:%d failed: to_address:%s has been given away already", id, item.Recipient)
+	}
+
+	if err := s.checkCaps(item.Token, item.Recipient, item.Wei); err != nil {
+		return nil, fmt.Errorf("approve id:%d failed:%w", id, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.handlerTotalTimeout)
+	defer cancel()
+
+	c, err := s.client.DialRPC()
+	if err != nil {
+		return nil, fmt.Errorf("approve client dialing failed:%w, id:%d", err, id)
+	}
+	defer c.Close()
+
+	if _, err := s.queue.Decide(id, approval.Approved, by, note); err != nil {
+		return nil, err
+	}
+
+	tx, curGivedWei, err := s.sender.Send(ctx, c, &ledger.Record{
+		Service:      s.name,
+		SourceTxHash: item.TxHash,
+		Token:        item.Token,
+		Recipient:    item.Recipient,
+		Wei:          item.Wei,
+		Usdt:         item.UsdtFloat(),
+		ApprovalID:   id,
+		Reasons:      item.Reasons,
+	}, s.settle)
+	if err != nil {
+		if _, merr := s.queue.MarkFailed(id, err); merr != nil {
+			s.stderrlogger.Printf("approve mark failed:%v, id:%d", merr, id)
+		}
+		return nil, fmt.Errorf("approve id:%d failed:%w", id, err)
+	}
+
+	s.stdoutlogger.Printf(`approve success, id:%d, by:%s, to_address:%s, giveaway:%s, current_giveout:%s, refund_tx_hash:%s, tx_hash:%s`,
+		id, by, item.Recipient, item.Wei, curGivedWei, tx.Hash(), item.TxHash,
+	)
+
+	return s.queue.MarkSent(id, tx.Hash())
+}
+
+// alreadyPaid tells the recipient has been given away, by the gave list or by another approved item
+func (s *Service) alreadyPaid(toAddress common.Address) bool {
+	if s.paid.has(toAddress) {
+		return true
+	}
+	for _, it := range s.queue.List(approval.Sent) {
+		if it.Recipient == toAddress {
+			return true
+		}
+	}
+	return false
+}
+
+// Reject drops a pending payout
+func (s *Service) Reject(id uint64, by, note string) (*approval.Item, error) {
+	if s.queue == nil {
+		return nil, ErrNoApprovalQueue
+	}
+
+	item, err := s.queue.Decide(id, approval.Rejected, by, note)
+	if err != nil {
+		return nil, err
+	}
+
+	s.stdoutlogger.Printf("reject success, id:%d, by:%s, to_address:%s, tx_hash:%s", id, by, item.Recipient, item.TxHash)
+	return item, nil
+}
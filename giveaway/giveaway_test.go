@@ -1,13 +1,24 @@
 package giveaway_test
 
 import (
+	"context"
 	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
 	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/FindoraNetwork/refunder/approval"
 	"github.com/FindoraNetwork/refunder/client"
 	"github.com/FindoraNetwork/refunder/config"
 	"github.com/FindoraNetwork/refunder/giveaway"
+	"github.com/FindoraNetwork/refunder/indexer"
+	"github.com/FindoraNetwork/refunder/notifier"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
@@ -51,7 +62,243 @@ func Test_GiveawayService(t *testing.T) {
 		SubscripTimeoutSec:     3,
 		EventLogPoolSize:       3,
 		TokenAddresses:         []string{"0x49C86Ee3Aca6ADE64127FA170445cd0B97CBBd4c"},
-	})
+	}, nil)
 	assert.NoError(t, err)
 	service.Close()
+
+	_, err = giveaway.New(client, &config.GiveawayService{
+		PrivateKey:             privateKey,
+		HandlerTotalTimeoutSec: 3,
+		SubscripTimeoutSec:     3,
+		EventLogPoolSize:       3,
+		TokenAddresses:         []string{"0x49C86Ee3Aca6ADE64127FA170445cd0B97CBBd4c"},
+		Triggers:               []*config.Trigger{{Event: "Released(address indexed to, uint256 amount)", RecipientField: "recipient", AmountField: "amount"}},
+	}, nil)
+	assert.Error(t, err, "unknown recipient field")
+
+	_, err = giveaway.New(client, &config.GiveawayService{
+		PrivateKey:             privateKey,
+		HandlerTotalTimeoutSec: 3,
+		SubscripTimeoutSec:     3,
+		EventLogPoolSize:       3,
+		TokenAddresses:         []string{"0x49C86Ee3Aca6ADE64127FA170445cd0B97CBBd4c"},
+		Triggers:               []*config.Trigger{{Event: indexer.MintEvent, RecipientField: "to", AmountField: "value"}},
+		NativeTrigger:          &config.NativeTrigger{FromAddresses: []string{"0x49C86Ee3Aca6ADE64127FA170445cd0B97CBBd4c"}},
+	}, nil)
+	assert.Error(t, err, "native trigger with the triggers")
+
+	_, err = giveaway.New(client, &config.GiveawayService{
+		PrivateKey:             privateKey,
+		HandlerTotalTimeoutSec: 3,
+		SubscripTimeoutSec:     3,
+		EventLogPoolSize:       3,
+		TokenAddresses:         []string{"0x49C86Ee3Aca6ADE64127FA170445cd0B97CBBd4c"},
+		Payout:                 &config.Payout{TokenAddress: "0x0000000000000000000000000000000000000002"},
+	}, nil)
+	assert.Error(t, err, "the payout token without the gave list")
+
+	service, err = giveaway.New(client, &config.GiveawayService{
+		PrivateKey:             privateKey,
+		HandlerTotalTimeoutSec: 3,
+		SubscripTimeoutSec:     3,
+		EventLogPoolSize:       3,
+		TokenAddresses:         []string{"0x49C86Ee3Aca6ADE64127FA170445cd0B97CBBd4c"},
+		Payout:                 &config.Payout{TokenAddress: "0x0000000000000000000000000000000000000002"},
+		GaveListFilepath:       filepath.Join(t.TempDir(), "gave_list.json"),
+	}, nil)
+	assert.NoError(t, err)
+	service.Close()
+}
+
+func Test_GiveawayServiceAmounts(t *testing.T) {
+	client, privateKey := setup(t)
+	_, err := giveaway.New(client, &config.GiveawayService{
+		PrivateKey:             privateKey,
+		HandlerTotalTimeoutSec: 3,
+		SubscripTimeoutSec:     3,
+		EventLogPoolSize:       3,
+		TokenAddresses:         []string{"0x49C86Ee3Aca6ADE64127FA170445cd0B97CBBd4c"},
+		GiveawayAmounts: map[string]*config.GiveawayAmount{
+			config.AnyToken: {Usdt: big.NewFloat(0.01)},
+		},
+	}, nil)
+	assert.Error(t, err, "usdt amount without a price source")
+
+	service, err := giveaway.New(client, &config.GiveawayService{
+		PrivateKey:             privateKey,
+		HandlerTotalTimeoutSec: 3,
+		SubscripTimeoutSec:     3,
+		EventLogPoolSize:       3,
+		TokenAddresses:         []string{"0x49C86Ee3Aca6ADE64127FA170445cd0B97CBBd4c"},
+		GiveawayAmounts: map[string]*config.GiveawayAmount{
+			"0x49C86Ee3Aca6ADE64127FA170445cd0B97CBBd4c": {
+				Wei: big.NewInt(30000000000000000),
+				Tiers: []*config.GiveawayTier{
+					{MinTransferAmount: big.NewInt(1000000), Wei: big.NewInt(60000000000000000)},
+				},
+			},
+		},
+	}, nil)
+	assert.NoError(t, err)
+	service.Close()
+}
+
+func Test_Amounts(t *testing.T) {
+	// the native token is priced at the highest 0.5 and the lowest 0.25 USDT
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([][]string{{"1645749900", "2839.79160470986265", "0.4", "0.5", "0.25", "0.3"}})
+	}))
+	defer srv.Close()
+
+	wusdt := common.HexToAddress("0x49C86Ee3Aca6ADE64127FA170445cd0B97CBBd4c")
+	other := common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	conf := func(amounts map[string]*config.GiveawayAmount) *config.GiveawayService {
+		return &config.GiveawayService{
+			FixedGiveawayWei:   big.NewInt(1000),
+			GiveawayAmounts:    amounts,
+			CrawlingAddress:    srv.URL,
+			NativeCurrencyPair: "FRA_USDT",
+		}
+	}
+	tiered := map[string]*config.GiveawayAmount{
+		wusdt.Hex(): {
+			Wei: big.NewInt(30000000000000000),
+			// the tiers are sorted, the highest matched one wins
+			Tiers: []*config.GiveawayTier{
+				{MinTransferAmount: big.NewInt(1000000), Wei: big.NewInt(60000000000000000)},
+				{MinTransferAmount: big.NewInt(5000000), Wei: big.NewInt(90000000000000000)},
+			},
+		},
+		config.AnyToken: {Wei: big.NewInt(10000000000000000)},
+	}
+
+	for _, tc := range []struct {
+		name        string
+		conf        *config.GiveawayService
+		token       common.Address
+		transferred int64
+		// decimal is the decimal of the token paid out, 0 for the native 18
+		decimal int
+		want    string
+	}{
+		{name: "below the tiers", conf: conf(tiered), token: wusdt, transferred: 999999, want: "30000000000000000"},
+		{name: "the lower tier", conf: conf(tiered), token: wusdt, transferred: 1000000, want: "60000000000000000"},
+		{name: "the highest tier wins", conf: conf(tiered), token: wusdt, transferred: 7000000, want: "90000000000000000"},
+		{name: "any token fallback", conf: conf(tiered), token: other, transferred: 7000000, want: "10000000000000000"},
+		{name: "fixed giveaway wei", conf: conf(nil), token: other, transferred: 1, want: "1000"},
+		{
+			// 1.5 USDT / 0.5 = 3 native
+			name:        "usdt by the highest price",
+			conf:        conf(map[string]*config.GiveawayAmount{config.AnyToken: {Usdt: big.NewFloat(1.5)}}),
+			token:       other,
+			transferred: 1,
+			want:        "3000000000000000000",
+		},
+		{
+			// 1.5 USDT / 0.25 = 6 native of a 6 decimal payout token
+			name: "usdt tier by the lowest price",
+			conf: func() *config.GiveawayService {
+				c := conf(map[string]*config.GiveawayAmount{
+					wusdt.Hex(): {Wei: big.NewInt(1), Tiers: []*config.GiveawayTier{{MinTransferAmount: big.NewInt(100), Usdt: big.NewFloat(1.5)}}},
+				})
+				c.NativePriceKind = config.Lowest
+				return c
+			}(),
+			token:       wusdt,
+			transferred: 100,
+			decimal:     6,
+			want:        "6000000",
+		},
+	} {
+		decimal := tc.decimal
+		if decimal == 0 {
+			decimal = 18
+		}
+		got, err := giveaway.Amount(context.Background(), tc.conf, decimal, tc.token, big.NewInt(tc.transferred))
+		assert.NoError(t, err, tc.name)
+		assert.Equal(t, tc.want, got.String(), tc.name)
+	}
+}
+
+func Test_Paid(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "gave_list.json")
+	alice, bob := common.HexToAddress("0xa11ce"), common.HexToAddress("0xb0b")
+
+	ok, err := giveaway.Paid(fp, []common.Address{alice, alice}, alice)
+	assert.NoError(t, err)
+	assert.True(t, ok, "the paid recipient is kept across the restarts")
+
+	ok, err = giveaway.Paid(fp, nil, bob)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func Test_ApproveAlreadyPaid(t *testing.T) {
+	dir := t.TempDir()
+	alice, bob := common.HexToAddress("0xa11ce"), common.HexToAddress("0xb0b")
+	queueFilepath := filepath.Join(dir, "queue.json")
+	gaveListFilepath := filepath.Join(dir, "gave_list.json")
+
+	// alice is paid by an approved item, and bob is in the gave list
+	assert.NoError(t, ioutil.WriteFile(queueFilepath, []byte(`{"next_id":4,"items":[
+		{"id":1,"status":"sent","recipient":"`+alice.Hex()+`","wei":10},
+		{"id":2,"status":"pending","recipient":"`+alice.Hex()+`","wei":10},
+		{"id":3,"status":"pending","recipient":"`+bob.Hex()+`","wei":10}
+	]}`), 0o600))
+	assert.NoError(t, ioutil.WriteFile(gaveListFilepath, []byte(`["`+bob.Hex()+`"]`), 0o600))
+
+	client, privateKey := setup(t)
+	service, err := giveaway.New(client, &config.GiveawayService{
+		PrivateKey:             privateKey,
+		HandlerTotalTimeoutSec: 3,
+		SubscripTimeoutSec:     3,
+		EventLogPoolSize:       3,
+		TokenAddresses:         []string{"0x49C86Ee3Aca6ADE64127FA170445cd0B97CBBd4c"},
+		GaveListFilepath:       gaveListFilepath,
+		Approval:               &config.Approval{ThresholdWei: big.NewInt(1), QueueFilepath: queueFilepath},
+	}, nil)
+	assert.NoError(t, err)
+	defer service.Close()
+
+	for _, id := range []uint64{2, 3} {
+		_, err = service.Approve(id, "carol", "")
+		assert.Error(t, err, "the recipient has been given away already")
+	}
+	assert.Len(t, service.List(approval.Pending), 2)
+}
+
+func Test_GiveawayServiceWindow(t *testing.T) {
+	var mux sync.Mutex
+	var events []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := map[string]interface{}{}
+		_ = json.NewDecoder(r.Body).Decode(&e)
+		mux.Lock()
+		defer mux.Unlock()
+		events = append(events, e)
+	}))
+	defer srv.Close()
+
+	n, err := notifier.New(&config.Notifier{Sinks: []*config.NotifierSink{{URL: srv.URL}}})
+	assert.NoError(t, err)
+
+	client, privateKey := setup(t)
+	service, err := giveaway.New(client, &config.GiveawayService{
+		PrivateKey:             privateKey,
+		HandlerTotalTimeoutSec: 3,
+		SubscripTimeoutSec:     3,
+		EventLogPoolSize:       3,
+		TokenAddresses:         []string{"0x49C86Ee3Aca6ADE64127FA170445cd0B97CBBd4c"},
+		MaxCapWei:              big.NewInt(1000),
+		Window:                 &config.Window{EndAt: time.Now().Add(100 * time.Millisecond)},
+	}, n)
+	assert.NoError(t, err)
+
+	time.Sleep(300 * time.Millisecond)
+	service.Close()
+	n.Close()
+
+	assert.Len(t, events, 1)
+	assert.Equal(t, "campaign_ended", events[0]["kind"])
+	assert.Equal(t, "1000", events[0]["fields"].(map[string]interface{})["max_cap_wei"])
 }
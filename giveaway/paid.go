@@ -0,0 +1,82 @@
+package giveaway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// paid is the persisted set of the recipients given away, a nil paid remembers nobody
+type paid struct {
+	mux        sync.Mutex
+	filepath   string
+	recipients map[common.Address]struct{}
+}
+
+// newPaid reads the list of the recipients, an empty filepath returns a nil paid
+func newPaid(filepath string) (*paid, error) {
+	if filepath == "" {
+		return nil, nil
+	}
+
+	p := &paid{filepath: filepath, recipients: make(map[common.Address]struct{})}
+	b, err := ioutil.ReadFile(filepath)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read file:%q failed:%w", filepath, err)
+	}
+
+	var list []common.Address
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, fmt.Errorf("json unmarshal gave list:%q failed:%w", filepath, err)
+	}
+	for _, addr := range list {
+		p.recipients[addr] = struct{}{}
+	}
+	return p, nil
+}
+
+// has tells the recipient has been given away already
+func (p *paid) has(toAddress common.Address) bool {
+	if p == nil {
+		return false
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	_, ok := p.recipients[toAddress]
+	return ok
+}
+
+// add remembers the recipient and writes the list
+func (p *paid) add(toAddress common.Address) error {
+	if p == nil {
+		return nil
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if _, ok := p.recipients[toAddress]; ok {
+		return nil
+	}
+	p.recipients[toAddress] = struct{}{}
+
+	list := make([]common.Address, 0, len(p.recipients))
+	for addr := range p.recipients {
+		list = append(list, addr)
+	}
+	b, err := json.Marshal(list)
+	if err != nil {
+		return fmt.Errorf("json marshal gave list failed:%w", err)
+	}
+	if err := ioutil.WriteFile(p.filepath, b, 0o600); err != nil {
+		return fmt.Errorf("write file:%q failed:%w", p.filepath, err)
+	}
+	return nil
+}
@@ -0,0 +1,432 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/client"
+	"github.com/gorilla/websocket"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// reorgDepth is how many blocks the removed transactions are remembered
+const reorgDepth = 1024
+
+// Handler handles a transfer of the stream
+type Handler func(*Transfer)
+
+// Options configures an Indexer
+type Options struct {
+	// Name is the service name prefixing the logs
+	Name     string
+	Triggers []*Trigger
+	// Native replaces the Triggers with the native transfers scanned from the blocks, following the new heads
+	Native *NativeTrigger
+	// BlockStep, MaxBlockStep and Concurrency are passed to the Scanner
+	BlockStep    int
+	MaxBlockStep int
+	Concurrency  int
+	// CursorFilepath persists the position of the stream, the stream starts with the live events only if it's empty
+	CursorFilepath string
+	// StartBlock is where the stream backfills from on the first time start up
+	StartBlock       uint64
+	SubscribeTimeout time.Duration
+	PoolSize         int
+}
+
+// Indexer turns the backfilled and the subscribed events of the triggers into one stream of transfers,
+// ordered by the blocks, deduplicated and skipping the transactions handled before a reorg
+type Indexer struct {
+	client           client.Client
+	query            ethereum.FilterQuery
+	triggers         []*Trigger
+	native           *NativeTrigger
+	scanner          *Scanner
+	scanMux          sync.Mutex
+	cursor           *Cursor
+	backfill         bool
+	startBlock       uint64
+	subscribeTimeout time.Duration
+	poolSize         int
+	stdoutlogger     *log.Logger
+	stderrlogger     *log.Logger
+	ctx              context.Context
+	cancel           context.CancelFunc
+	onDead           func(error)
+	// reorged are the handled transactions removed by a reorg, keyed by the tx hash to the block number
+	reorged map[common.Hash]uint64
+}
+
+// New returns an Indexer, the persisted cursor is loaded if the CursorFilepath exists
+func New(c client.Client, opts *Options) (*Indexer, error) {
+	cursor, err := OpenCursor(opts.CursorFilepath)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	query := Query(opts.Triggers)
+	return &Indexer{
+		client:           c,
+		query:            query,
+		triggers:         opts.Triggers,
+		native:           opts.Native,
+		scanner:          NewScanner(query, opts.BlockStep, opts.MaxBlockStep, opts.Concurrency),
+		cursor:           cursor,
+		backfill:         opts.CursorFilepath != "",
+		startBlock:       opts.StartBlock,
+		subscribeTimeout: opts.SubscribeTimeout,
+		poolSize:         opts.PoolSize,
+		stdoutlogger:     log.New(os.Stdout, opts.Name+"Indexer:", log.Lmsgprefix),
+		stderrlogger:     log.New(os.Stderr, opts.Name+"Indexer:", log.Lmsgprefix),
+		ctx:              ctx,
+		cancel:           cancel,
+		reorged:          make(map[common.Hash]uint64),
+	}, nil
+}
+
+// OnDead sets the callback called once the subscription cannot be recovered and the stream stops
+func (ix *Indexer) OnDead(f func(error)) {
+	ix.onDead = f
+}
+
+// Backfill scans the blocks from the block from to the block to, both inclusive, and hands over the ranges in order
+// with the Transfers decoded, it's independent of the cursor of the stream, the caller keeps its own
+func (ix *Indexer) Backfill(ctx context.Context, from, to uint64, handle func(*Range) error) error {
+	c, err := ix.client.DialRPC()
+	if err != nil {
+		return fmt.Errorf("indexer client.DialRPC failed:%w", err)
+	}
+
+	ix.scanMux.Lock()
+	defer ix.scanMux.Unlock()
+	return ix.scanner.scan(ctx, ix.fetcher(c), from, to, func(r *Range) error {
+		for _, vlog := range r.Logs {
+			transfer, err := match(ix.triggers, vlog)
+			if err != nil {
+				r.Errs = append(r.Errs, err)
+				continue
+			}
+			if transfer != nil {
+				r.Transfers = append(r.Transfers, transfer)
+			}
+		}
+		return handle(r)
+	})
+}
+
+// fetcher returns the fetching of a range, the logs of the triggers or the native transfers in the blocks
+func (ix *Indexer) fetcher(c client.Client) func(context.Context, *Range) error {
+	if ix.native != nil {
+		return ix.native.fetcher(c)
+	}
+	return ix.scanner.logFetcher(c)
+}
+
+// subscribe subscribes to the logs of the triggers, or to the new heads for the native transfers
+func (ix *Indexer) subscribe() (ethereum.Subscription, chan types.Log, chan *types.Header, error) {
+	c, err := ix.client.DialWS()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("start dialing to server failed:%w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ix.ctx, ix.subscribeTimeout)
+	defer cancel()
+
+	if ix.native != nil {
+		headChan := make(chan *types.Header, ix.poolSize)
+		sub, err := c.SubscribeNewHead(ctx, headChan)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("subscribe new head failed:%w", err)
+		}
+		return sub, nil, headChan, nil
+	}
+
+	logChan := make(chan types.Log, ix.poolSize)
+	sub, err := c.SubscribeFilterLogs(ctx, ix.query, logChan)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("subscribe filter logs failed:%w", err)
+	}
+	return sub, logChan, nil, nil
+}
+
+// Start subscribes to the live events, then backfills the blocks since the cursor in a goroutine before following them,
+// the subscription is recovered with the missed blocks backfilled
+func (ix *Indexer) Start(handle Handler) error {
+	sub, logChan, headChan, suberr := ix.subscribe()
+	if suberr != nil {
+		return suberr
+	}
+
+	resubscribe := func(reason string) bool {
+		ix.stdoutlogger.Printf("%s try to reconnect", reason)
+		sub, logChan, headChan, suberr = ix.subscribe()
+		if suberr != nil {
+			ix.stderrlogger.Printf("%s reconnect failed:%v, service stop", reason, suberr)
+			if ix.onDead != nil {
+				ix.onDead(suberr)
+			}
+			return false
+		}
+		ix.catchUp(handle)
+		return true
+	}
+
+	go func() {
+		ix.catchUp(handle)
+		for {
+			select {
+			case <-ix.ctx.Done():
+				sub.Unsubscribe()
+				return
+			case err := <-sub.Err():
+				switch {
+				case websocket.IsCloseError(err, websocket.CloseAbnormalClosure):
+					if !resubscribe("websocket.CloseAbnormalClosure") {
+						return
+					}
+				case os.IsTimeout(err):
+					if !resubscribe("websocket.read i/o timeout") {
+						return
+					}
+				case err == nil:
+					// this is weird, but it's really happening...
+					if !resubscribe("websocket received nil error") {
+						return
+					}
+				default:
+					ix.stderrlogger.Printf("subscribe websocket receive error:%v", err)
+				}
+			case vlog := <-logChan:
+				ix.deliver(vlog, handle)
+			case head := <-headChan:
+				ix.followHead(head.Number.Uint64(), handle)
+			}
+		}
+	}()
+	return nil
+}
+
+// catchUp backfills the blocks since the cursor to the latest block into the stream,
+// a failed range stops it and it's backfilled again in the next catch up
+func (ix *Indexer) catchUp(handle Handler) {
+	if !ix.backfill {
+		return
+	}
+
+	from := ix.cursor.BlockNumber
+	if from == 0 {
+		from = ix.startBlock
+	}
+	if from == 0 {
+		// nothing to backfill on the first time start up
+		return
+	}
+
+	c, err := ix.client.DialRPC()
+	if err != nil {
+		ix.stderrlogger.Printf("backfill client.DialRPC failed:%v", err)
+		return
+	}
+	latest, err := c.BlockNumber(ix.ctx)
+	if err != nil {
+		ix.stderrlogger.Printf("backfill c.BlockNumber failed:%v", err)
+		return
+	}
+	if ix.native != nil {
+		if latest < ix.native.confirmations {
+			return
+		}
+		latest -= ix.native.confirmations
+	}
+
+	ix.stdoutlogger.Printf("backfilling from:%d to:%d", from, latest)
+	if err := ix.scanInto(c, from, latest, handle); err != nil {
+		ix.stderrlogger.Printf("backfill stopped:%v", err)
+	}
+}
+
+// followHead scans the confirmed blocks up to the new head for the native transfers
+func (ix *Indexer) followHead(head uint64, handle Handler) {
+	if head < ix.native.confirmations {
+		return
+	}
+	to := head - ix.native.confirmations
+	from := ix.cursor.BlockNumber
+	if from == 0 {
+		// starting with the live blocks
+		from = to
+	}
+
+	c, err := ix.client.DialRPC()
+	if err != nil {
+		ix.stderrlogger.Printf("scanning client.DialRPC failed:%v", err)
+		return
+	}
+	if err := ix.scanInto(c, from, to, handle); err != nil {
+		ix.stderrlogger.Printf("scanning stopped:%v", err)
+	}
+}
+
+// scanInto scans the blocks into the stream, the cursor is moved past the blocks scanned for the native transfers
+func (ix *Indexer) scanInto(c client.Client, from, to uint64, handle Handler) error {
+	ix.scanMux.Lock()
+	defer ix.scanMux.Unlock()
+	return ix.scanner.scan(ix.ctx, ix.fetcher(c), from, to, func(r *Range) error {
+		if r.Err != nil {
+			return fmt.Errorf("fetching from:%d to:%d failed:%w", r.From, r.To, r.Err)
+		}
+		for _, vlog := range r.Logs {
+			ix.deliver(vlog, handle)
+		}
+		for _, transfer := range r.Transfers {
+			ix.emit(transfer.Log, transfer, nil, handle)
+		}
+		if ix.native != nil {
+			return ix.cursor.scanned(r.To)
+		}
+		return nil
+	})
+}
+
+// deliver hands over the log unless it's been handled, the removed logs rewind the cursor
+func (ix *Indexer) deliver(vlog types.Log, handle Handler) {
+	if vlog.Removed {
+		if vlog.BlockNumber <= ix.cursor.BlockNumber {
+			// the transaction might be re-included in another block, it's not handled twice
+			ix.reorged[vlog.TxHash] = vlog.BlockNumber
+			ix.stderrlogger.Printf("log removed by a reorg, tx_hash:%s, block_number:%d, index:%d", vlog.TxHash, vlog.BlockNumber, vlog.Index)
+			if err := ix.cursor.rewind(vlog.BlockNumber); err != nil {
+				ix.stderrlogger.Println(err)
+			}
+		}
+		return
+	}
+
+	transfer, err := match(ix.triggers, vlog)
+	ix.emit(vlog, transfer, err, handle)
+}
+
+// emit hands over the transfer decoded from the log unless the log has been handled, then moves the cursor past it
+func (ix *Indexer) emit(vlog types.Log, transfer *Transfer, err error, handle Handler) {
+	if ix.cursor.handled(vlog.BlockNumber, vlog.Index) {
+		return
+	}
+	if _, ok := ix.reorged[vlog.TxHash]; ok {
+		ix.stdoutlogger.Printf("log re-included after a reorg skipped, tx_hash:%s, block_number:%d", vlog.TxHash, vlog.BlockNumber)
+		return
+	}
+
+	switch {
+	case err != nil:
+		ix.stderrlogger.Println(err)
+	case transfer != nil:
+		handle(transfer)
+	}
+
+	if err := ix.cursor.advance(vlog.BlockNumber, vlog.Index); err != nil {
+		ix.stderrlogger.Println(err)
+	}
+	for txHash, n := range ix.reorged {
+		if n+reorgDepth < vlog.BlockNumber {
+			delete(ix.reorged, txHash)
+		}
+	}
+}
+
+// Close stops the stream
+func (ix *Indexer) Close() {
+	ix.cancel()
+}
+
+// Cursor is the position of the handled logs, persisted so a restart resumes without handling a log twice
+type Cursor struct {
+	filepath    string
+	BlockNumber uint64 `json:"block_number"`
+	// LogIndexes are the handled logs in the block BlockNumber
+	LogIndexes []uint `json:"log_indexes"`
+}
+
+// OpenCursor loads the cursor, an empty filepath keeps the cursor in memory only
+func OpenCursor(filepath string) (*Cursor, error) {
+	c := &Cursor{filepath: filepath}
+	if filepath == "" {
+		return c, nil
+	}
+
+	b, err := ioutil.ReadFile(filepath)
+	switch {
+	case os.IsNotExist(err):
+		// first time start up
+	case err != nil:
+		return nil, fmt.Errorf("indexer read file:%q failed:%w", filepath, err)
+	case len(b) > 0:
+		if err := json.Unmarshal(b, c); err != nil {
+			return nil, fmt.Errorf("indexer json unmarshal cursor failed:%w", err)
+		}
+	}
+	return c, nil
+}
+
+// handled tells the log is at or before the cursor
+func (c *Cursor) handled(blockNumber uint64, index uint) bool {
+	if blockNumber != c.BlockNumber {
+		return blockNumber < c.BlockNumber
+	}
+	for _, i := range c.LogIndexes {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Cursor) advance(blockNumber uint64, index uint) error {
+	if blockNumber > c.BlockNumber {
+		c.BlockNumber, c.LogIndexes = blockNumber, nil
+	}
+	c.LogIndexes = append(c.LogIndexes, index)
+	return c.save()
+}
+
+// scanned moves the cursor past the block, nothing after it is handled yet
+func (c *Cursor) scanned(blockNumber uint64) error {
+	if blockNumber < c.BlockNumber {
+		return nil
+	}
+	c.BlockNumber, c.LogIndexes = blockNumber+1, nil
+	return c.save()
+}
+
+// rewind moves the cursor back before the block, all the logs since it are removed by the reorg
+func (c *Cursor) rewind(blockNumber uint64) error {
+	if blockNumber > c.BlockNumber {
+		return nil
+	}
+	c.BlockNumber, c.LogIndexes = blockNumber, nil
+	return c.save()
+}
+
+func (c *Cursor) save() error {
+	if c.filepath == "" {
+		return nil
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("indexer json marshal cursor failed:%w", err)
+	}
+	if err := ioutil.WriteFile(c.filepath, b, 0o600); err != nil {
+		return fmt.Errorf("indexer write file:%q failed:%w", c.filepath, err)
+	}
+	return nil
+}
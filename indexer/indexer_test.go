@@ -0,0 +1,338 @@
+package indexer_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/client"
+	"github.com/FindoraNetwork/refunder/config"
+	"github.com/FindoraNetwork/refunder/indexer"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+type subscription struct {
+	errc chan error
+}
+
+func (s *subscription) Err() <-chan error {
+	return s.errc
+}
+
+func (s *subscription) Unsubscribe() {}
+
+// chain serves the history by FilterLogs and the live logs by the subscribed channel
+type chain struct {
+	client.Client
+	latest  uint64
+	history []types.Log
+	live    chan<- types.Log
+	// blocks and receipts serve the native transfers, and the heads are the subscribed new heads
+	blocks   map[uint64]*types.Block
+	receipts map[common.Hash]*types.Receipt
+	heads    chan<- *types.Header
+}
+
+func (c *chain) DialRPC() (client.Client, error) {
+	return c, nil
+}
+
+func (c *chain) DialWS() (client.Client, error) {
+	return c, nil
+}
+
+func (c *chain) BlockNumber(context.Context) (uint64, error) {
+	return c.latest, nil
+}
+
+func (c *chain) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	var logs []types.Log
+	for _, l := range c.history {
+		if l.BlockNumber >= q.FromBlock.Uint64() && l.BlockNumber <= q.ToBlock.Uint64() {
+			logs = append(logs, l)
+		}
+	}
+	return logs, nil
+}
+
+func (c *chain) SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	c.live = ch
+	return &subscription{errc: make(chan error)}, nil
+}
+
+func (c *chain) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	c.heads = ch
+	return &subscription{errc: make(chan error)}, nil
+}
+
+func (c *chain) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	if b, ok := c.blocks[number.Uint64()]; ok {
+		return b, nil
+	}
+	return types.NewBlockWithHeader(&types.Header{Number: number}), nil
+}
+
+func (c *chain) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	return c.receipts[txHash], nil
+}
+
+var transferID = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+// mint returns a Transfer log minted from the zero address
+func mint(blockNumber uint64, index uint, txHash string) types.Log {
+	return types.Log{
+		BlockNumber: blockNumber,
+		Index:       index,
+		TxHash:      common.HexToHash(txHash),
+		Topics:      []common.Hash{transferID, {}, common.BytesToHash(common.HexToAddress("0xb0b").Bytes())},
+		Data:        common.BigToHash(big.NewInt(100)).Bytes(),
+	}
+}
+
+func Test_Indexer(t *testing.T) {
+	cursorFilepath := filepath.Join(t.TempDir(), "cursor.json")
+	assert.NoError(t, ioutil.WriteFile(cursorFilepath, []byte(`{"block_number":10,"log_indexes":[0]}`), 0o644))
+
+	tx := func(s string) common.Hash { return common.HexToHash(s) }
+	c := &chain{
+		latest:  12,
+		history: []types.Log{mint(10, 0, "0xa"), mint(10, 1, "0xb"), mint(12, 0, "0xc")},
+	}
+
+	triggers, err := indexer.NewTriggers(nil, nil)
+	assert.NoError(t, err)
+	ix, err := indexer.New(c, &indexer.Options{
+		Name:             "giveaway",
+		Triggers:         triggers,
+		CursorFilepath:   cursorFilepath,
+		SubscribeTimeout: time.Second,
+		PoolSize:         10,
+	})
+	assert.NoError(t, err)
+	defer ix.Close()
+
+	var mux sync.Mutex
+	var handled []common.Hash
+	got := func() []common.Hash {
+		mux.Lock()
+		defer mux.Unlock()
+		return append([]common.Hash{}, handled...)
+	}
+	assert.NoError(t, ix.Start(func(transfer *indexer.Transfer) {
+		mux.Lock()
+		defer mux.Unlock()
+		handled = append(handled, transfer.TxHash)
+	}))
+
+	// the logs since the cursor are backfilled, the handled one is skipped
+	assert.Eventually(t, func() bool { return len(got()) == 2 }, 3*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []common.Hash{tx("0xb"), tx("0xc")}, got())
+
+	removed := mint(13, 0, "0xd")
+	removed.Removed = true
+	c.live <- mint(12, 0, "0xc")
+	c.live <- mint(13, 0, "0xd")
+	// a reorg replaces the block 13, and the handled transaction is re-included in the block 14
+	c.live <- removed
+	c.live <- mint(13, 0, "0xe")
+	c.live <- mint(14, 0, "0xd")
+	c.live <- mint(14, 1, "0xf")
+
+	assert.Eventually(t, func() bool { return len(got()) == 5 }, 3*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []common.Hash{tx("0xb"), tx("0xc"), tx("0xd"), tx("0xe"), tx("0xf")}, got())
+
+	cursor, err := indexer.OpenCursor(cursorFilepath)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(14), cursor.BlockNumber)
+	assert.Equal(t, []uint{1}, cursor.LogIndexes)
+}
+
+func Test_Scanner(t *testing.T) {
+	c := &chain{}
+	for n := uint64(0); n < 1000; n += 100 {
+		c.history = append(c.history, types.Log{BlockNumber: n})
+	}
+
+	sc := indexer.NewScanner(ethereum.FilterQuery{}, 50, 400, 3)
+	var ranges []*indexer.Range
+	err := sc.Scan(context.Background(), c, 0, 999, func(r *indexer.Range) error {
+		ranges = append(ranges, r)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// the ranges are handed over in order and the empty ones grow the step
+	next, logs := uint64(0), 0
+	for _, r := range ranges {
+		assert.Equal(t, next, r.From)
+		next, logs = r.To+1, logs+len(r.Logs)
+	}
+	assert.Equal(t, uint64(1000), next)
+	assert.Equal(t, 10, logs)
+	assert.Less(t, len(ranges), 20)
+}
+
+func Test_Triggers(t *testing.T) {
+	bridge := common.HexToAddress("0xb41d9e")
+	vault := common.HexToAddress("0xfa017")
+	token := common.HexToAddress("0x70ce")
+	recipient := common.HexToAddress("0xb0b")
+
+	_, err := indexer.NewTriggers([]*config.Trigger{{Event: "Deposit(address indexed to, uint256 amount)", RecipientField: "to"}}, nil)
+	assert.Error(t, err, "without the amount field")
+	_, err = indexer.NewTriggers([]*config.Trigger{{Event: "Deposit(address indexed to, uint256 amount)", RecipientField: "amount", AmountField: "amount"}}, nil)
+	assert.Error(t, err, "the recipient field is not an address")
+	_, err = indexer.NewTriggers([]*config.Trigger{{Event: "Deposit(address indexed to, uint256 amount)", RecipientField: "to", AmountField: "amount", Filters: map[string]string{"amount": "1"}}}, nil)
+	assert.Error(t, err, "filtering on a non-indexed field")
+
+	triggers, err := indexer.NewTriggers([]*config.Trigger{
+		{
+			Event:          "event Released(address indexed token, address indexed from, address indexed to, uint256 amount)",
+			Addresses:      []string{bridge.String()},
+			Filters:        map[string]string{"from": vault.String()},
+			RecipientField: "to",
+			AmountField:    "amount",
+			TokenField:     "token",
+		},
+		{
+			Event:          indexer.MintEvent,
+			Filters:        map[string]string{"from": common.Address{}.String()},
+			RecipientField: "to",
+			AmountField:    "value",
+		},
+	}, []common.Address{token})
+	assert.NoError(t, err)
+
+	q := indexer.Query(triggers)
+	assert.Equal(t, []common.Address{bridge, token}, q.Addresses)
+	assert.Len(t, q.Topics, 1)
+	assert.Len(t, q.Topics[0], 2)
+
+	releasedID := crypto.Keccak256Hash([]byte("Released(address,address,address,uint256)"))
+	topic := func(a common.Address) common.Hash { return common.BytesToHash(a.Bytes()) }
+	released := types.Log{
+		Address: bridge,
+		Topics:  []common.Hash{releasedID, topic(token), topic(vault), topic(recipient)},
+		Data:    common.BigToHash(big.NewInt(42)).Bytes(),
+	}
+
+	c := &chain{latest: 0, history: []types.Log{released, mint(0, 1, "0x1")}}
+	c.history[1].Address = token
+	notVault := released
+	notVault.Topics = []common.Hash{releasedID, topic(token), topic(recipient), topic(recipient)}
+	c.history = append(c.history, notVault)
+
+	ix, err := indexer.New(c, &indexer.Options{Triggers: triggers})
+	assert.NoError(t, err)
+	var transfers []*indexer.Transfer
+	assert.NoError(t, ix.Backfill(context.Background(), 0, 0, func(r *indexer.Range) error {
+		transfers = append(transfers, r.Transfers...)
+		return nil
+	}))
+
+	assert.Len(t, transfers, 2)
+	assert.Equal(t, token, transfers[0].Token)
+	assert.Equal(t, recipient, transfers[0].Recipient)
+	assert.Equal(t, "42", transfers[0].Amount.String())
+	assert.Equal(t, bridge, transfers[0].Address)
+	assert.Equal(t, token, transfers[1].Token)
+	assert.Equal(t, "100", transfers[1].Amount.String())
+}
+
+func Test_NativeTrigger(t *testing.T) {
+	_, err := indexer.NewNativeTrigger(&config.NativeTrigger{})
+	assert.Error(t, err, "without the from addresses")
+	_, err = indexer.NewNativeTrigger(&config.NativeTrigger{FromAddresses: []string{"bridge"}})
+	assert.Error(t, err, "the from address is not an address")
+	native, err := indexer.NewNativeTrigger(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, native)
+
+	bridgeKey, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	otherKey, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	bridge := crypto.PubkeyToAddress(bridgeKey.PublicKey)
+	recipient := common.HexToAddress("0xb0b")
+
+	signer := types.LatestSignerForChainID(big.NewInt(1337))
+	c := &chain{blocks: make(map[uint64]*types.Block), receipts: make(map[common.Hash]*types.Receipt)}
+	nonce := uint64(0)
+	send := func(key *ecdsa.PrivateKey, value int64, status uint64) *types.Transaction {
+		tx := types.MustSignNewTx(key, signer, &types.LegacyTx{Nonce: nonce, To: &recipient, Value: big.NewInt(value), Gas: 21000, GasPrice: big.NewInt(1)})
+		nonce++
+		c.receipts[tx.Hash()] = &types.Receipt{Status: status}
+		return tx
+	}
+	block := func(number int64, txs ...*types.Transaction) {
+		c.blocks[uint64(number)] = types.NewBlockWithHeader(&types.Header{Number: big.NewInt(number)}).WithBody(txs, nil)
+	}
+
+	paid := send(bridgeKey, 100, types.ReceiptStatusSuccessful)
+	block(1,
+		send(otherKey, 100, types.ReceiptStatusSuccessful),
+		send(bridgeKey, 0, types.ReceiptStatusSuccessful),
+		send(bridgeKey, 100, types.ReceiptStatusFailed),
+		paid,
+	)
+	live := send(bridgeKey, 200, types.ReceiptStatusSuccessful)
+	block(3, live)
+
+	native, err = indexer.NewNativeTrigger(&config.NativeTrigger{FromAddresses: []string{bridge.String()}, Confirmations: 1})
+	assert.NoError(t, err)
+	cursorFilepath := filepath.Join(t.TempDir(), "cursor.json")
+	ix, err := indexer.New(c, &indexer.Options{
+		Native:           native,
+		CursorFilepath:   cursorFilepath,
+		SubscribeTimeout: time.Second,
+		PoolSize:         10,
+	})
+	assert.NoError(t, err)
+	defer ix.Close()
+
+	// only the successful value transfers from the bridge are matched
+	var transfers []*indexer.Transfer
+	assert.NoError(t, ix.Backfill(context.Background(), 0, 2, func(r *indexer.Range) error {
+		transfers = append(transfers, r.Transfers...)
+		return nil
+	}))
+	assert.Len(t, transfers, 1)
+	assert.Equal(t, paid.Hash(), transfers[0].TxHash)
+	assert.Equal(t, bridge, transfers[0].Address)
+	assert.Equal(t, recipient, transfers[0].Recipient)
+	assert.Equal(t, common.Address{}, transfers[0].Token)
+	assert.Equal(t, "100", transfers[0].Amount.String())
+
+	var mux sync.Mutex
+	var handled []common.Hash
+	got := func() []common.Hash {
+		mux.Lock()
+		defer mux.Unlock()
+		return append([]common.Hash{}, handled...)
+	}
+	assert.NoError(t, ix.Start(func(transfer *indexer.Transfer) {
+		mux.Lock()
+		defer mux.Unlock()
+		handled = append(handled, transfer.TxHash)
+	}))
+
+	// the new heads are scanned behind the confirmations
+	c.heads <- &types.Header{Number: big.NewInt(3)}
+	c.heads <- &types.Header{Number: big.NewInt(4)}
+	c.heads <- &types.Header{Number: big.NewInt(4)}
+	assert.Eventually(t, func() bool {
+		cursor, err := indexer.OpenCursor(cursorFilepath)
+		return err == nil && cursor.BlockNumber == 4
+	}, 3*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []common.Hash{live.Hash()}, got())
+}
@@ -0,0 +1,103 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/FindoraNetwork/refunder/client"
+	"github.com/FindoraNetwork/refunder/config"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// NativeTrigger matches the plain value transfers from the bridge or relayer addresses,
+// the value moved by the internal calls is not seen
+type NativeTrigger struct {
+	from          map[common.Address]struct{}
+	token         common.Address
+	confirmations uint64
+}
+
+// NewNativeTrigger compiles the native trigger, a nil conf returns a nil NativeTrigger
+func NewNativeTrigger(conf *config.NativeTrigger) (*NativeTrigger, error) {
+	if conf == nil {
+		return nil, nil
+	}
+	if len(conf.FromAddresses) == 0 {
+		return nil, errors.New("native trigger from_addresses is a MUST filled field")
+	}
+
+	n := &NativeTrigger{
+		from:          make(map[common.Address]struct{}, len(conf.FromAddresses)),
+		token:         common.HexToAddress(conf.TokenAddress),
+		confirmations: conf.Confirmations,
+	}
+	for _, address := range conf.FromAddresses {
+		if !common.IsHexAddress(address) {
+			return nil, fmt.Errorf("native trigger from_address:%q is not an address", address)
+		}
+		n.from[common.HexToAddress(address)] = struct{}{}
+	}
+	return n, nil
+}
+
+// Token returns the key of the native token in the per token settings, nil for a nil NativeTrigger
+func (n *NativeTrigger) Token() *common.Address {
+	if n == nil {
+		return nil
+	}
+	token := n.token
+	return &token
+}
+
+// fetcher returns the fetching of the native transfers in the blocks of a range, the failed transactions are skipped
+func (n *NativeTrigger) fetcher(c client.Client) func(context.Context, *Range) error {
+	return func(ctx context.Context, r *Range) error {
+		for number := r.From; number <= r.To; number++ {
+			block, err := c.BlockByNumber(ctx, big.NewInt(0).SetUint64(number))
+			if err != nil {
+				return fmt.Errorf("c.BlockByNumber:%d failed:%w", number, err)
+			}
+
+			for i, tx := range block.Transactions() {
+				if tx.To() == nil || tx.Value().Sign() <= 0 {
+					continue
+				}
+				sender, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+				if err != nil {
+					return fmt.Errorf("types.Sender failed:%w, tx_hash:%s", err, tx.Hash())
+				}
+				if _, ok := n.from[sender]; !ok {
+					continue
+				}
+
+				receipt, err := c.TransactionReceipt(ctx, tx.Hash())
+				if err != nil {
+					return fmt.Errorf("c.TransactionReceipt failed:%w, tx_hash:%s", err, tx.Hash())
+				}
+				if receipt == nil || receipt.Status != types.ReceiptStatusSuccessful {
+					continue
+				}
+
+				r.Transfers = append(r.Transfers, &Transfer{
+					// the transaction index stands for the log index, a block has no more than one native transfer per transaction
+					Log: types.Log{
+						Address:     sender,
+						BlockNumber: number,
+						BlockHash:   block.Hash(),
+						TxHash:      tx.Hash(),
+						TxIndex:     uint(i),
+						Index:       uint(i),
+					},
+					Token:     n.token,
+					Recipient: *tx.To(),
+					Amount:    tx.Value(),
+				})
+			}
+		}
+		return nil
+	}
+}
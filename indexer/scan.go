@@ -0,0 +1,174 @@
+package indexer
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const defaultBlockStep = 100
+
+// Range is an inclusive block range and the logs fetched in it
+type Range struct {
+	From uint64
+	To   uint64
+	Logs []types.Log
+	Err  error
+	// Transfers are the logs decoded by the triggers, and Errs are the logs failed to be decoded, filled by the Indexer
+	Transfers []*Transfer
+	Errs      []error
+}
+
+// Scanner fetches the logs of the block ranges concurrently,
+// the step is halved once the node refuses a range for too many results and doubled once a range is empty
+type Scanner struct {
+	query       ethereum.FilterQuery
+	concurrency int
+	maxStep     uint64
+	// step is kept between the scans, so the learned step is reused
+	step uint64
+}
+
+// NewScanner returns a Scanner starting with the step, a zero step defaults to 100 blocks and a zero concurrency to 1
+func NewScanner(query ethereum.FilterQuery, step, maxStep, concurrency int) *Scanner {
+	if step <= 0 {
+		step = defaultBlockStep
+	}
+	if maxStep < step {
+		maxStep = step
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &Scanner{query: query, concurrency: concurrency, maxStep: uint64(maxStep), step: uint64(step)}
+}
+
+// tooManyResults tells the node refused the range for its size, the messages vary among the node implementations
+func tooManyResults(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"too many results", "query returned more than", "block range", "limit exceeded", "response size"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Scan fetches the logs from the block from to the block to, both inclusive,
+// and calls handle with the ranges in the order of the blocks, so the cursor can be checkpointed after each of them.
+// A range failed with other errors is handed over with the Err, and Scan stops once handle returns an error.
+// Scan is not safe for concurrent use.
+func (sc *Scanner) Scan(ctx context.Context, filterer ethereum.LogFilterer, from, to uint64, handle func(*Range) error) error {
+	return sc.scan(ctx, sc.logFetcher(filterer), from, to, handle)
+}
+
+// logFetcher returns the fetching of the logs of the query in a range
+func (sc *Scanner) logFetcher(filterer ethereum.LogFilterer) func(context.Context, *Range) error {
+	return func(ctx context.Context, r *Range) error {
+		q := sc.query
+		q.FromBlock = big.NewInt(0).SetUint64(r.From)
+		q.ToBlock = big.NewInt(0).SetUint64(r.To)
+		logs, err := filterer.FilterLogs(ctx, q)
+		r.Logs = logs
+		return err
+	}
+}
+
+// scan is Scan with the fetching of a range replaced, like the blocks for the native transfers
+func (sc *Scanner) scan(ctx context.Context, fetcher func(context.Context, *Range) error, from, to uint64, handle func(*Range) error) error {
+	if from > to {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan *Range, sc.concurrency)
+	fetch := func(r *Range) {
+		r.Err = fetcher(ctx, r)
+		results <- r
+	}
+
+	var (
+		// retries are the split ranges to be fetched again, ordered by the blocks
+		retries  []*Range
+		next     = from
+		inflight int
+		fetched  = make(map[uint64]*Range)
+		expected = from
+		stopErr  error
+	)
+
+	dispatch := func() {
+		for stopErr == nil && inflight < sc.concurrency {
+			var r *Range
+			switch {
+			case len(retries) > 0:
+				r, retries = retries[0], retries[1:]
+			case next <= to:
+				end := next + sc.step - 1
+				if end > to || end < next {
+					end = to
+				}
+				r = &Range{From: next, To: end}
+				next = end + 1
+			default:
+				return
+			}
+			inflight++
+			go fetch(r)
+		}
+	}
+
+	dispatch()
+	for inflight > 0 {
+		r := <-results
+		inflight--
+
+		switch {
+		case r.Err != nil && ctx.Err() != nil:
+			// stopped or timed out, the rest are fetched in the next scan
+			if stopErr == nil {
+				stopErr = ctx.Err()
+			}
+			continue
+		case r.Err != nil && tooManyResults(r.Err) && r.To > r.From:
+			mid := r.From + (r.To-r.From)/2
+			if size := mid - r.From + 1; size < sc.step {
+				sc.step = size
+			}
+			retries = append(retries, &Range{From: r.From, To: mid}, &Range{From: mid + 1, To: r.To})
+			sort.Slice(retries, func(i, j int) bool { return retries[i].From < retries[j].From })
+		default:
+			if r.Err == nil && len(r.Logs) == 0 && len(r.Transfers) == 0 && sc.step < sc.maxStep {
+				sc.step *= 2
+				if sc.step > sc.maxStep {
+					sc.step = sc.maxStep
+				}
+			}
+			fetched[r.From] = r
+		}
+
+		for stopErr == nil {
+			r, ok := fetched[expected]
+			if !ok {
+				break
+			}
+			delete(fetched, expected)
+			if err := handle(r); err != nil {
+				stopErr = err
+				cancel()
+				break
+			}
+			expected = r.To + 1
+		}
+
+		dispatch()
+	}
+
+	return stopErr
+}
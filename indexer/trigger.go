@@ -0,0 +1,296 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/FindoraNetwork/refunder/config"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// MintEvent is the Transfer event, the default trigger matches the ones minted from the zero address
+const MintEvent = "Transfer(address indexed from, address indexed to, uint256 value)"
+
+// Transfer is a bridged transfer decoded from a trigger
+type Transfer struct {
+	types.Log
+	Token     common.Address
+	Recipient common.Address
+	Amount    *big.Int
+}
+
+// Trigger matches the logs of an event and decodes them into the transfers
+type Trigger struct {
+	event     abi.Event
+	indexed   abi.Arguments
+	addresses []common.Address
+	// filters are the topics keyed by the position in the log topics
+	filters        map[int]common.Hash
+	recipientField string
+	amountField    string
+	tokenField     string
+}
+
+// NewTriggers compiles the triggers, the empty confs are the Transfer events minted to the token addresses
+func NewTriggers(confs []*config.Trigger, tokenAddresses []common.Address) ([]*Trigger, error) {
+	if len(confs) == 0 {
+		confs = []*config.Trigger{{
+			Event:          MintEvent,
+			Filters:        map[string]string{"from": common.Address{}.String()},
+			RecipientField: "to",
+			AmountField:    "value",
+		}}
+	}
+
+	triggers := make([]*Trigger, 0, len(confs))
+	for i, conf := range confs {
+		t, err := newTrigger(conf, tokenAddresses)
+		if err != nil {
+			return nil, fmt.Errorf("trigger:%d %w", i, err)
+		}
+		triggers = append(triggers, t)
+	}
+	return triggers, nil
+}
+
+// parseEvent parses the signature like "Transfer(address indexed from, address indexed to, uint256 value)"
+func parseEvent(sig string) (abi.Event, error) {
+	sig = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(sig), "event "))
+	open, end := strings.Index(sig, "("), strings.LastIndex(sig, ")")
+	if open <= 0 || end != len(sig)-1 {
+		return abi.Event{}, fmt.Errorf("event:%q is not like Name(type [indexed] name, ...)", sig)
+	}
+
+	name := strings.TrimSpace(sig[:open])
+	var args abi.Arguments
+	if params := strings.TrimSpace(sig[open+1 : end]); params != "" {
+		for _, param := range strings.Split(params, ",") {
+			fields := strings.Fields(param)
+			arg := abi.Argument{}
+			switch {
+			case len(fields) == 2:
+				arg.Name = fields[1]
+			case len(fields) == 3 && fields[1] == "indexed":
+				arg.Name, arg.Indexed = fields[2], true
+			default:
+				return abi.Event{}, fmt.Errorf("event:%q parameter:%q is not like type [indexed] name", sig, param)
+			}
+
+			typ, err := abi.NewType(fields[0], "", nil)
+			if err != nil {
+				return abi.Event{}, fmt.Errorf("event:%q parameter:%q %w", sig, param, err)
+			}
+			arg.Type = typ
+			args = append(args, arg)
+		}
+	}
+	return abi.NewEvent(name, name, false, args), nil
+}
+
+// topicOf encodes the value of an indexed field as its topic
+func topicOf(typ abi.Type, value string) (common.Hash, error) {
+	switch typ.T {
+	case abi.AddressTy:
+		if !common.IsHexAddress(value) {
+			return common.Hash{}, fmt.Errorf("value:%q is not an address", value)
+		}
+		return common.BytesToHash(common.HexToAddress(value).Bytes()), nil
+	case abi.UintTy, abi.IntTy:
+		v, ok := big.NewInt(0).SetString(value, 0)
+		if !ok || v.Sign() < 0 {
+			return common.Hash{}, fmt.Errorf("value:%q is not a non-negative integer", value)
+		}
+		return common.BigToHash(v), nil
+	case abi.BoolTy:
+		switch value {
+		case "true":
+			return common.BigToHash(big.NewInt(1)), nil
+		case "false":
+			return common.Hash{}, nil
+		}
+		return common.Hash{}, fmt.Errorf("value:%q is not a bool", value)
+	case abi.FixedBytesTy:
+		return common.HexToHash(value), nil
+	default:
+		return common.Hash{}, fmt.Errorf("filtering on type:%s is not supported", typ)
+	}
+}
+
+func newTrigger(conf *config.Trigger, tokenAddresses []common.Address) (*Trigger, error) {
+	if conf == nil {
+		return nil, errors.New("is empty")
+	}
+
+	event, err := parseEvent(conf.Event)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Trigger{
+		event:          event,
+		filters:        make(map[int]common.Hash),
+		recipientField: conf.RecipientField,
+		amountField:    conf.AmountField,
+		tokenField:     conf.TokenField,
+	}
+
+	t.addresses = tokenAddresses
+	if len(conf.Addresses) > 0 {
+		t.addresses = make([]common.Address, 0, len(conf.Addresses))
+		for _, address := range conf.Addresses {
+			t.addresses = append(t.addresses, common.HexToAddress(address))
+		}
+	}
+
+	fields := make(map[string]abi.Argument, len(event.Inputs))
+	positions := make(map[string]int)
+	for _, arg := range event.Inputs {
+		fields[arg.Name] = arg
+	}
+	for _, arg := range event.Inputs {
+		if arg.Indexed {
+			t.indexed = append(t.indexed, arg)
+			positions[arg.Name] = len(t.indexed)
+		}
+	}
+
+	for name, value := range conf.Filters {
+		pos, ok := positions[name]
+		if !ok {
+			return nil, fmt.Errorf("filter:%q is not an indexed field of event:%s", name, event.Sig)
+		}
+		topic, err := topicOf(fields[name].Type, value)
+		if err != nil {
+			return nil, fmt.Errorf("filter:%q %w", name, err)
+		}
+		t.filters[pos] = topic
+	}
+
+	check := func(kind, name string, want byte, required bool) error {
+		if name == "" {
+			if required {
+				return fmt.Errorf("%s_field is a MUST filled field", kind)
+			}
+			return nil
+		}
+		arg, ok := fields[name]
+		if !ok {
+			return fmt.Errorf("%s_field:%q is not a field of event:%s", kind, name, event.Sig)
+		}
+		if arg.Type.T != want {
+			return fmt.Errorf("%s_field:%q is not of type:%s", kind, name, map[byte]string{abi.AddressTy: "address", abi.UintTy: "uint"}[want])
+		}
+		return nil
+	}
+	if err := check("recipient", conf.RecipientField, abi.AddressTy, true); err != nil {
+		return nil, err
+	}
+	if err := check("amount", conf.AmountField, abi.UintTy, true); err != nil {
+		return nil, err
+	}
+	if err := check("token", conf.TokenField, abi.AddressTy, false); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (t *Trigger) emittedBy(address common.Address) bool {
+	if len(t.addresses) == 0 {
+		return true
+	}
+	for _, a := range t.addresses {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
+
+// Match decodes the log into a transfer, a nil transfer means the log is not of the trigger
+func (t *Trigger) Match(vlog types.Log) (*Transfer, error) {
+	if len(vlog.Topics) == 0 || vlog.Topics[0] != t.event.ID {
+		return nil, nil
+	}
+	if !t.emittedBy(vlog.Address) {
+		return nil, nil
+	}
+	if len(vlog.Topics) != len(t.indexed)+1 {
+		return nil, fmt.Errorf("receive not expecting format on topics:%v of event:%s, tx_hash:%s", vlog.Topics, t.event.Sig, vlog.TxHash)
+	}
+	for pos, topic := range t.filters {
+		if vlog.Topics[pos] != topic {
+			return nil, nil
+		}
+	}
+
+	values := make(map[string]interface{}, len(t.event.Inputs))
+	if err := abi.ParseTopicsIntoMap(values, t.indexed, vlog.Topics[1:]); err != nil {
+		return nil, fmt.Errorf("parsing topics of event:%s failed:%w, tx_hash:%s", t.event.Sig, err, vlog.TxHash)
+	}
+	if err := t.event.Inputs.UnpackIntoMap(values, vlog.Data); err != nil {
+		return nil, fmt.Errorf("unpacking data of event:%s failed:%w, tx_hash:%s", t.event.Sig, err, vlog.TxHash)
+	}
+
+	transfer := &Transfer{Log: vlog, Token: vlog.Address}
+	transfer.Recipient, _ = values[t.recipientField].(common.Address)
+	transfer.Amount, _ = values[t.amountField].(*big.Int)
+	if t.tokenField != "" {
+		transfer.Token, _ = values[t.tokenField].(common.Address)
+	}
+	if transfer.Amount == nil {
+		// the uint types shorter than 64 bits are decoded into the go integers
+		transfer.Amount, _ = big.NewInt(0).SetString(fmt.Sprint(values[t.amountField]), 10)
+	}
+	return transfer, nil
+}
+
+// Query returns the query of the logs of all the triggers,
+// the indexed filters are in the query only with a single trigger and they are checked again in Match
+func Query(triggers []*Trigger) ethereum.FilterQuery {
+	q := ethereum.FilterQuery{Topics: [][]common.Hash{{}}}
+	seen := make(map[common.Address]struct{})
+	anyAddress := false
+	for _, t := range triggers {
+		q.Topics[0] = append(q.Topics[0], t.event.ID)
+		if len(t.addresses) == 0 {
+			anyAddress = true
+		}
+		for _, address := range t.addresses {
+			if _, ok := seen[address]; !ok {
+				seen[address] = struct{}{}
+				q.Addresses = append(q.Addresses, address)
+			}
+		}
+	}
+	if anyAddress {
+		q.Addresses = nil
+	}
+
+	if len(triggers) == 1 {
+		for pos, topic := range triggers[0].filters {
+			for len(q.Topics) <= pos {
+				q.Topics = append(q.Topics, nil)
+			}
+			q.Topics[pos] = []common.Hash{topic}
+		}
+	}
+	return q
+}
+
+// match decodes the log with the first trigger matching it
+func match(triggers []*Trigger, vlog types.Log) (*Transfer, error) {
+	for _, t := range triggers {
+		transfer, err := t.Match(vlog)
+		if err != nil || transfer != nil {
+			return transfer, err
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,257 @@
+package ledger
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+type Status string
+
+const (
+	Sent    = Status("sent")
+	Failed  = Status("failed")
+	Held    = Status("held")
+	Skipped = Status("skipped")
+)
+
+// Receipt is the on-chain result of a sent payout, filled by Reconcile
+type Receipt struct {
+	// Status is "confirmed", "reverted", "missing" or "error"
+	Status      string `json:"status"`
+	BlockNumber uint64 `json:"block_number,omitempty"`
+	GasUsed     uint64 `json:"gas_used,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Record is an entry of the ledger, never changed once appended
+type Record struct {
+	Service      string                `json:"service"`
+	Campaign     string                `json:"campaign,omitempty"`
+	At           time.Time             `json:"at"`
+	SourceTxHash common.Hash           `json:"source_tx_hash"`
+	LogIndex     uint                  `json:"log_index"`
+	Token        common.Address        `json:"token_address"`
+	Recipient    common.Address        `json:"to_address"`
+	Wei          *big.Int              `json:"wei"`
+	Usdt         *big.Float            `json:"usdt,omitempty"`
+	Prices       map[string]*big.Float `json:"prices,omitempty"`
+	GasPrice     *big.Int              `json:"gas_price,omitempty"`
+	Gas          uint64                `json:"gas,omitempty"`
+	Nonce        *uint64               `json:"nonce,omitempty"`
+	RefundTxHash *common.Hash          `json:"refund_tx_hash,omitempty"`
+	ApprovalID   uint64                `json:"approval_id,omitempty"`
+	Reasons      []string              `json:"reasons,omitempty"`
+	Status       Status                `json:"status"`
+	Error        string                `json:"error,omitempty"`
+	Receipt      *Receipt              `json:"receipt,omitempty"`
+	// PayoutToken is the ERC20 token paid out, the Wei is in its smallest unit, empty for the native token
+	PayoutToken *common.Address `json:"payout_token,omitempty"`
+	// RecipientState is the native balance and the nonce of the recipient deciding the refund
+	RecipientState *RecipientState `json:"recipient_state,omitempty"`
+}
+
+// RecipientState is the recipient read at the refunding and the decision on the refund by it
+type RecipientState struct {
+	BalanceWei *big.Int `json:"balance_wei"`
+	Nonce      uint64   `json:"nonce"`
+	// Decision is "kept", "reduced" or "skipped"
+	Decision string `json:"decision"`
+}
+
+// Ledger is an append-only json lines file of the payouts
+type Ledger struct {
+	mux      sync.Mutex
+	filepath string
+}
+
+// Open returns the Ledger of the file, an empty filepath returns a nil Ledger which records nothing
+func Open(filepath string) *Ledger {
+	if filepath == "" {
+		return nil
+	}
+	return &Ledger{filepath: filepath}
+}
+
+// Append writes the record at the end of the file and syncs it to the disk
+func (l *Ledger) Append(r *Record) error {
+	if l == nil {
+		return nil
+	}
+
+	if r.At.IsZero() {
+		r.At = time.Now().UTC()
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("ledger json marshal record failed:%w", err)
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	f, err := os.OpenFile(l.filepath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("ledger open file:%q failed:%w", l.filepath, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("ledger write file:%q failed:%w", l.filepath, err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("ledger sync file:%q failed:%w", l.filepath, err)
+	}
+	return nil
+}
+
+// Query returns the records in [since, until), a zero time means no bound
+func (l *Ledger) Query(since, until time.Time) ([]*Record, error) {
+	if l == nil {
+		return []*Record{}, nil
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	f, err := os.Open(l.filepath)
+	if os.IsNotExist(err) {
+		return []*Record{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ledger open file:%q failed:%w", l.filepath, err)
+	}
+	defer f.Close()
+
+	records := []*Record{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		r := &Record{}
+		if err := json.Unmarshal(scanner.Bytes(), r); err != nil {
+			return nil, fmt.Errorf("ledger json unmarshal line:%d failed:%w", line, err)
+		}
+		if (!since.IsZero() && r.At.Before(since)) || (!until.IsZero() && !r.At.Before(until)) {
+			continue
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("ledger read file:%q failed:%w", l.filepath, err)
+	}
+
+	return records, nil
+}
+
+// Reconcile fills the on-chain receipts of the sent records
+func Reconcile(ctx context.Context, c ethereum.TransactionReader, records []*Record) {
+	for _, r := range records {
+		if r.Status != Sent || r.RefundTxHash == nil {
+			continue
+		}
+
+		receipt, err := c.TransactionReceipt(ctx, *r.RefundTxHash)
+		switch {
+		case errors.Is(err, ethereum.NotFound), err == nil && receipt == nil:
+			r.Receipt = &Receipt{Status: "missing"}
+		case err != nil:
+			r.Receipt = &Receipt{Status: "error", Error: err.Error()}
+		case receipt.Status == types.ReceiptStatusSuccessful:
+			r.Receipt = &Receipt{Status: "confirmed", BlockNumber: receipt.BlockNumber.Uint64(), GasUsed: receipt.GasUsed}
+		default:
+			r.Receipt = &Receipt{Status: "reverted", BlockNumber: receipt.BlockNumber.Uint64(), GasUsed: receipt.GasUsed}
+		}
+	}
+}
+
+// WriteJSON writes the records as a json array
+func WriteJSON(w io.Writer, records []*Record) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(records)
+}
+
+// WriteCSV writes the records one row each, the prices are written as "name=price" and the lists are joined by ";"
+func WriteCSV(w io.Writer, records []*Record) error {
+	rows := [][]string{{
+		"service", "campaign", "at", "source_tx_hash", "log_index", "token_address", "to_address", "wei", "usdt", "prices",
+		"gas_price", "nonce", "refund_tx_hash", "approval_id", "reasons", "status", "error",
+		"receipt_status", "receipt_block_number", "receipt_gas_used",
+	}}
+
+	for _, r := range records {
+		row := []string{
+			r.Service,
+			r.Campaign,
+			r.At.Format(time.RFC3339),
+			r.SourceTxHash.String(),
+			strconv.FormatUint(uint64(r.LogIndex), 10),
+			r.Token.String(),
+			r.Recipient.String(),
+			"", "", "", "", "", "", "",
+			strings.Join(r.Reasons, ";"),
+			string(r.Status),
+			r.Error,
+			"", "", "",
+		}
+		if r.Wei != nil {
+			row[7] = r.Wei.String()
+		}
+		if r.Usdt != nil {
+			row[8] = r.Usdt.String()
+		}
+		names := make([]string, 0, len(r.Prices))
+		for name := range r.Prices {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for i, name := range names {
+			if i > 0 {
+				row[9] += ";"
+			}
+			row[9] += name + "=" + r.Prices[name].String()
+		}
+		if r.GasPrice != nil {
+			row[10] = r.GasPrice.String()
+		}
+		if r.Nonce != nil {
+			row[11] = strconv.FormatUint(*r.Nonce, 10)
+		}
+		if r.RefundTxHash != nil {
+			row[12] = r.RefundTxHash.String()
+		}
+		if r.ApprovalID > 0 {
+			row[13] = strconv.FormatUint(r.ApprovalID, 10)
+		}
+		if r.Receipt != nil {
+			row[17] = r.Receipt.Status
+			if r.Receipt.BlockNumber > 0 {
+				row[18] = strconv.FormatUint(r.Receipt.BlockNumber, 10)
+				row[19] = strconv.FormatUint(r.Receipt.GasUsed, 10)
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return csv.NewWriter(w).WriteAll(rows)
+}
@@ -0,0 +1,103 @@
+package ledger_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/ledger"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type receipts map[common.Hash]*types.Receipt
+
+func (r receipts) TransactionByHash(ctx context.Context, txHash common.Hash) (*types.Transaction, bool, error) {
+	return nil, false, ethereum.NotFound
+}
+
+func (r receipts) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	if txHash == common.HexToHash("0xdead") {
+		return nil, errors.New("connection refused")
+	}
+	receipt, ok := r[txHash]
+	if !ok {
+		return nil, ethereum.NotFound
+	}
+	return receipt, nil
+}
+
+func Test_Ledger(t *testing.T) {
+	l := ledger.Open("")
+	assert.Nil(t, l)
+	assert.NoError(t, l.Append(&ledger.Record{}))
+
+	l = ledger.Open(filepath.Join(t.TempDir(), "ledger.jsonl"))
+	records, err := l.Query(time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+
+	day := func(d int) time.Time { return time.Date(2022, 7, d, 0, 0, 0, 0, time.UTC) }
+	hash := func(s string) *common.Hash { h := common.HexToHash(s); return &h }
+	nonce := uint64(7)
+
+	assert.NoError(t, l.Append(&ledger.Record{
+		Service:      "gasfee",
+		At:           day(1),
+		SourceTxHash: common.HexToHash("0x1"),
+		LogIndex:     2,
+		Token:        common.HexToAddress("0xa"),
+		Recipient:    common.HexToAddress("0xb"),
+		Wei:          big.NewInt(300),
+		Usdt:         big.NewFloat(0.5),
+		Prices:       map[string]*big.Float{"FRA_USDT": big.NewFloat(0.01), "BNB_USDT": big.NewFloat(250)},
+		GasPrice:     big.NewInt(10),
+		Nonce:        &nonce,
+		RefundTxHash: hash("0xbeef"),
+		Status:       ledger.Sent,
+	}))
+	assert.NoError(t, l.Append(&ledger.Record{Service: "gasfee", At: day(2), Status: ledger.Sent, RefundTxHash: hash("0xcafe")}))
+	assert.NoError(t, l.Append(&ledger.Record{Service: "gasfee", At: day(3), Status: ledger.Sent, RefundTxHash: hash("0xdead")}))
+	assert.NoError(t, l.Append(&ledger.Record{Service: "giveaway", At: day(4), Status: ledger.Held, ApprovalID: 1, Reasons: []string{"over_amount", "new_address"}}))
+	assert.NoError(t, l.Append(&ledger.Record{Service: "giveaway", At: day(5), Status: ledger.Failed, Error: "nonce too low"}))
+
+	records, err = l.Query(time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, records, 5)
+	assert.Equal(t, uint64(7), *records[0].Nonce)
+	assert.Equal(t, "250", records[0].Prices["BNB_USDT"].String())
+
+	// since is inclusive, until is exclusive
+	records, err = l.Query(day(2), day(4))
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, day(2), records[0].At)
+
+	records, err = l.Query(time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	ledger.Reconcile(context.Background(), receipts{
+		common.HexToHash("0xbeef"): {Status: types.ReceiptStatusSuccessful, BlockNumber: big.NewInt(100), GasUsed: 21000},
+	}, records)
+	assert.Equal(t, &ledger.Receipt{Status: "confirmed", BlockNumber: 100, GasUsed: 21000}, records[0].Receipt)
+	assert.Equal(t, &ledger.Receipt{Status: "missing"}, records[1].Receipt)
+	assert.Equal(t, &ledger.Receipt{Status: "error", Error: "connection refused"}, records[2].Receipt)
+	assert.Nil(t, records[3].Receipt)
+	assert.Nil(t, records[4].Receipt)
+
+	var b bytes.Buffer
+	assert.NoError(t, ledger.WriteCSV(&b, records))
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	assert.Len(t, lines, 6)
+	assert.Equal(t, "gasfee,,2022-07-01T00:00:00Z,0x0000000000000000000000000000000000000000000000000000000000000001,2,"+
+		"0x000000000000000000000000000000000000000A,0x000000000000000000000000000000000000000b,300,0.5,BNB_USDT=250;FRA_USDT=0.01,"+
+		"10,7,0x000000000000000000000000000000000000000000000000000000000000beef,,,sent,,confirmed,100,21000", lines[1])
+	assert.True(t, strings.HasSuffix(lines[4], ",1,over_amount;new_address,held,,,,"))
+}
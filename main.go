@@ -6,10 +6,13 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/FindoraNetwork/refunder/admin"
+	"github.com/FindoraNetwork/refunder/cli"
 	"github.com/FindoraNetwork/refunder/client"
 	"github.com/FindoraNetwork/refunder/config"
 	"github.com/FindoraNetwork/refunder/gasfee"
 	"github.com/FindoraNetwork/refunder/giveaway"
+	"github.com/FindoraNetwork/refunder/notifier"
 )
 
 const help = `
@@ -18,6 +21,11 @@ Must need a Config File specified by --config option
 
 Mandatory arguments to long options.
 --config    specific the config file path"
+
+Subcommands:
+approvals   list, approve or reject the held payouts through the admin api
+keys        generate, import or show the address of the funding keys in keystore files
+export      export the payout ledger as csv or json, reconciled with the on-chain receipts
 `
 
 func main() {
@@ -25,25 +33,82 @@ func main() {
 		log.Fatal(help)
 	}
 
-	config, err := config.Load(os.Args[1], os.Args[2])
+	if os.Args[1] == "approvals" {
+		if err := cli.Approvals(os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("approvals failed: %v", err)
+		}
+		return
+	}
+
+	if os.Args[1] == "keys" {
+		if err := cli.Keys(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+			log.Fatalf("keys failed: %v", err)
+		}
+		return
+	}
+
+	if os.Args[1] == "export" {
+		if err := cli.Export(os.Args[2:], os.Stdout); err != nil {
+			log.Fatalf("export failed: %v", err)
+		}
+		return
+	}
+
+	if len(os.Args) <= 2 {
+		log.Fatal(help)
+	}
+
+	conf, err := config.Load(os.Args[1], os.Args[2])
 	if err != nil {
 		log.Fatalf("readConfig failed: %v", err)
 	}
 
-	if config.GiveawayService.IsEnable {
-		giveawaySvc, err := giveaway.New(client.New(config.Server), config.GiveawayService)
-		if err != nil {
-			log.Fatalf("giveaway new service failed :%v, config :%v", err, config.GiveawayService)
+	notify, err := notifier.New(conf.Notifier)
+	if err != nil {
+		log.Fatalf("notifier new failed :%v, config :%v", err, conf.Notifier)
+	}
+	defer notify.Close()
+
+	var adminSrv *admin.Server
+	if conf.Admin != nil && conf.Admin.ListenAddress != "" {
+		adminSrv = admin.New(conf.Admin)
+	}
+
+	for _, network := range conf.AllNetworks() {
+		if network.GiveawayService != nil && network.GiveawayService.IsEnable {
+			name := config.Namespaced(network.Name, "giveaway")
+			giveawaySvc, err := giveaway.New(client.New(network.Server), network.GiveawayService, notify)
+			if err != nil {
+				log.Fatalf("%s new service failed :%v, config :%v", name, err, network.GiveawayService)
+			}
+			defer giveawaySvc.Close()
+
+			if adminSrv != nil {
+				adminSrv.RegisterStatus(name, giveawaySvc.Status)
+				adminSrv.RegisterApprover(name, giveawaySvc)
+			}
+		}
+
+		if network.GasfeeService != nil && network.GasfeeService.IsEnable {
+			name := config.Namespaced(network.Name, "gasfee")
+			gasfeeSvc, err := gasfee.New(client.New(network.Server), network.GasfeeService, notify)
+			if err != nil {
+				log.Fatalf("%s new service failed :%v, config :%v", name, err, network.GasfeeService)
+			}
+			defer gasfeeSvc.Close()
+
+			if adminSrv != nil {
+				adminSrv.RegisterStatus(name, gasfeeSvc.Status)
+				adminSrv.RegisterApprover(name, gasfeeSvc)
+			}
 		}
-		defer giveawaySvc.Close()
 	}
 
-	if config.GasfeeService.IsEnable {
-		gasfeeSvc, err := gasfee.New(client.New(config.Server), config.GasfeeService)
-		if err != nil {
-			log.Fatalf("gasfee new service failed :%v, config :%v", err, config.GasfeeService)
+	if adminSrv != nil {
+		if err := adminSrv.Start(); err != nil {
+			log.Fatalf("admin start failed :%v, listen_address :%s", err, conf.Admin.ListenAddress)
 		}
-		defer gasfeeSvc.Close()
+		defer adminSrv.Close()
 	}
 
 	c := make(chan os.Signal, 1)
@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Gauge is a value which can go up and down, keyed by the label values
+type Gauge struct {
+	mux    sync.RWMutex
+	name   string
+	help   string
+	labels []string
+	values map[string]float64
+}
+
+// Set sets the value of the label values, which are in the same order as the labels
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	g.values[g.key(labelValues)] = value
+}
+
+// Get returns the value of the label values
+func (g *Gauge) Get(labelValues ...string) float64 {
+	g.mux.RLock()
+	defer g.mux.RUnlock()
+	return g.values[g.key(labelValues)]
+}
+
+func (g *Gauge) key(labelValues []string) string {
+	if len(labelValues) != len(g.labels) {
+		panic(fmt.Sprintf("metrics gauge:%s expecting %d label values, got %d", g.name, len(g.labels), len(labelValues)))
+	}
+
+	pairs := make([]string, 0, len(g.labels))
+	for i, label := range g.labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", label, labelValues[i]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.mux.RLock()
+	defer g.mux.RUnlock()
+
+	keys := make([]string, 0, len(g.values))
+	for key := range g.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+	for _, key := range keys {
+		value := strconv.FormatFloat(g.values[key], 'g', -1, 64)
+		if key == "" {
+			fmt.Fprintf(w, "%s %s\n", g.name, value)
+			continue
+		}
+		fmt.Fprintf(w, "%s{%s} %s\n", g.name, key, value)
+	}
+}
+
+// Registry holds the metrics exported in the Prometheus text format
+type Registry struct {
+	mux    sync.Mutex
+	gauges map[string]*Gauge
+}
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{gauges: make(map[string]*Gauge)}
+}
+
+// Default is the registry exported by the admin api
+var Default = NewRegistry()
+
+// Gauge returns the registered gauge of the name, or registers a new one
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if g, ok := r.gauges[name]; ok {
+		return g
+	}
+
+	g := &Gauge{name: name, help: help, labels: labels, values: make(map[string]float64)}
+	r.gauges[name] = g
+	return g
+}
+
+// Write writes all the metrics in the Prometheus text format
+func (r *Registry) Write(w io.Writer) {
+	r.mux.Lock()
+	gauges := make([]*Gauge, 0, len(r.gauges))
+	for _, g := range r.gauges {
+		gauges = append(gauges, g)
+	}
+	r.mux.Unlock()
+
+	sort.Slice(gauges, func(i, j int) bool { return gauges[i].name < gauges[j].name })
+	for _, g := range gauges {
+		g.write(w)
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		r.Write(w)
+	})
+}
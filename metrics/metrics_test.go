@@ -0,0 +1,34 @@
+package metrics_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/FindoraNetwork/refunder/metrics"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Registry(t *testing.T) {
+	r := metrics.NewRegistry()
+	g := r.Gauge("refunder_funding_balance_wei", "the balance", "service")
+	assert.Same(t, g, r.Gauge("refunder_funding_balance_wei", "the balance", "service"))
+
+	g.Set(3e18, "giveaway")
+	g.Set(1, "gasfee")
+	assert.Equal(t, float64(1), g.Get("gasfee"))
+	r.Gauge("refunder_up", "the daemon is up").Set(1)
+
+	out := &bytes.Buffer{}
+	r.Write(out)
+	assert.Equal(t, `# HELP refunder_funding_balance_wei the balance
+# TYPE refunder_funding_balance_wei gauge
+refunder_funding_balance_wei{service="gasfee"} 1
+refunder_funding_balance_wei{service="giveaway"} 3e+18
+# HELP refunder_up the daemon is up
+# TYPE refunder_up gauge
+refunder_up 1
+`, out.String())
+
+	assert.Panics(t, func() { g.Set(1) })
+}
@@ -0,0 +1,184 @@
+package money
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Scale is the decimal places kept by a Decimal
+const Scale = 18
+
+var unit = pow10(Scale)
+
+// Decimal is an exact fixed-point decimal of Scale places, never changed once built, a nil Decimal is 0.
+// The rounding rules are deterministic:
+//   - the inputs of more places, the products and the quotients are rounded half away from zero to Scale places
+//   - the conversions into the integer units like wei are truncated toward zero, so an amount is never rounded up into a payout
+type Decimal struct {
+	// v is the number times 10^Scale
+	v *big.Int
+}
+
+// New returns the Decimal of the integer
+func New(i int64) *Decimal {
+	return NewFromInt(big.NewInt(i))
+}
+
+// NewFromInt returns the Decimal of the big integer
+func NewFromInt(i *big.Int) *Decimal {
+	return &Decimal{v: new(big.Int).Mul(i, unit)}
+}
+
+// FromUnits returns the Decimal of the amount in the smallest units of a token of the decimal, like the wei of 18
+func FromUnits(units *big.Int, decimal int) *Decimal {
+	return &Decimal{v: shift(units, Scale-decimal)}
+}
+
+// Parse returns the Decimal of a decimal string, like "0.01815", "-2" or "1.2e15"
+func Parse(s string) (*Decimal, error) {
+	s = strings.TrimSpace(s)
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || strings.Trim(s, "0123456789+-.eE") != "" {
+		return nil, fmt.Errorf("money parsing %q failed: not a decimal", s)
+	}
+	return &Decimal{v: quoRound(new(big.Int).Mul(r.Num(), unit), r.Denom())}, nil
+}
+
+func (d *Decimal) int() *big.Int {
+	if d == nil || d.v == nil {
+		return new(big.Int)
+	}
+	return d.v
+}
+
+// Add returns d + x
+func (d *Decimal) Add(x *Decimal) *Decimal {
+	return &Decimal{v: new(big.Int).Add(d.int(), x.int())}
+}
+
+// Sub returns d - x
+func (d *Decimal) Sub(x *Decimal) *Decimal {
+	return &Decimal{v: new(big.Int).Sub(d.int(), x.int())}
+}
+
+// Mul returns d * x rounded half away from zero
+func (d *Decimal) Mul(x *Decimal) *Decimal {
+	return &Decimal{v: quoRound(new(big.Int).Mul(d.int(), x.int()), unit)}
+}
+
+// Quo returns d / x rounded half away from zero, it panics if x is 0 like the big.Int
+func (d *Decimal) Quo(x *Decimal) *Decimal {
+	return &Decimal{v: quoRound(new(big.Int).Mul(d.int(), unit), x.int())}
+}
+
+// Shift returns d * 10^n, rounded half away from zero for a negative n
+func (d *Decimal) Shift(n int) *Decimal {
+	return &Decimal{v: shift(d.int(), n)}
+}
+
+// Cmp compares d and x like the big.Int
+func (d *Decimal) Cmp(x *Decimal) int {
+	return d.int().Cmp(x.int())
+}
+
+// Sign returns -1, 0 or +1 like the big.Int
+func (d *Decimal) Sign() int {
+	return d.int().Sign()
+}
+
+// Units returns d in the smallest units of a token of the decimal, truncated toward zero
+func (d *Decimal) Units(decimal int) *big.Int {
+	return new(big.Int).Quo(new(big.Int).Mul(d.int(), pow10(decimal)), unit)
+}
+
+// QuoUnits returns d / x in the smallest units of a token of the decimal, truncated toward zero without rounding the quotient first,
+// the decimal can be negative, it panics if x is 0 like the big.Int
+func (d *Decimal) QuoUnits(x *Decimal, decimal int) *big.Int {
+	if decimal >= 0 {
+		return new(big.Int).Quo(new(big.Int).Mul(d.int(), pow10(decimal)), x.int())
+	}
+	return new(big.Int).Quo(d.int(), new(big.Int).Mul(x.int(), pow10(-decimal)))
+}
+
+// Int returns the integer part of d, truncated toward zero
+func (d *Decimal) Int() *big.Int {
+	return d.Units(0)
+}
+
+// Float returns d as a big.Float of 256 bits for the reports, it's never used in the arithmetic
+func (d *Decimal) Float() *big.Float {
+	return new(big.Float).SetPrec(256).SetRat(new(big.Rat).SetFrac(d.int(), unit))
+}
+
+// String returns the exact decimal without the trailing zeros
+func (d *Decimal) String() string {
+	v := d.int()
+	abs := new(big.Int).Abs(v).String()
+	if len(abs) <= Scale {
+		abs = strings.Repeat("0", Scale-len(abs)+1) + abs
+	}
+
+	s := abs[:len(abs)-Scale]
+	if frac := strings.TrimRight(abs[len(abs)-Scale:], "0"); frac != "" {
+		s += "." + frac
+	}
+	if v.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// MarshalText encodes d as the exact decimal string
+func (d *Decimal) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText decodes a decimal string
+func (d *Decimal) UnmarshalText(b []byte) error {
+	p, err := Parse(string(b))
+	if err != nil {
+		return err
+	}
+	*d = *p
+	return nil
+}
+
+// UnmarshalJSON decodes a json number or a json string of a decimal, the number is taken exactly as it's written
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	return d.UnmarshalText([]byte(s))
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// shift returns v * 10^n, rounded half away from zero for a negative n
+func shift(v *big.Int, n int) *big.Int {
+	if n >= 0 {
+		return new(big.Int).Mul(v, pow10(n))
+	}
+	return quoRound(v, pow10(-n))
+}
+
+// quoRound returns n / d rounded half away from zero
+func quoRound(n, d *big.Int) *big.Int {
+	if d.Sign() == 0 {
+		panic("money: division by zero")
+	}
+
+	q, m := new(big.Int).QuoRem(n, d, new(big.Int))
+	if new(big.Int).Lsh(new(big.Int).Abs(m), 1).Cmp(new(big.Int).Abs(d)) >= 0 {
+		if n.Sign()*d.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
@@ -0,0 +1,103 @@
+package money_test
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/FindoraNetwork/refunder/money"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parse(t *testing.T, s string) *money.Decimal {
+	d, err := money.Parse(s)
+	assert.NoError(t, err)
+	return d
+}
+
+func Test_Parse(t *testing.T) {
+	for s, want := range map[string]string{
+		"0.01815":  "0.01815",
+		"-2":       "-2",
+		"1.2e15":   "1200000000000000",
+		"3.000":    "3",
+		"1e-18":    "0.000000000000000001",
+		"0.1":      "0.1",
+		" 999.99 ": "999.99",
+		// more places than the Scale are rounded half away from zero
+		"0.0000000000000000015":  "0.000000000000000002",
+		"-0.0000000000000000015": "-0.000000000000000002",
+		"0.0000000000000000014":  "0.000000000000000001",
+	} {
+		assert.Equal(t, want, parse(t, s).String(), s)
+	}
+
+	for _, s := range []string{"", "abc", "1/3", "0x10"} {
+		_, err := money.Parse(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func Test_Arithmetic(t *testing.T) {
+	// 0.1 + 0.2 is exact
+	assert.Equal(t, "0.3", parse(t, "0.1").Add(parse(t, "0.2")).String())
+	assert.Equal(t, 0, parse(t, "0.1").Add(parse(t, "0.2")).Cmp(parse(t, "0.3")))
+	assert.Equal(t, "-0.1", parse(t, "0.1").Sub(parse(t, "0.2")).String())
+	assert.Equal(t, "0.0003294588", parse(t, "0.01815").Mul(parse(t, "0.018152")).String())
+
+	// the quotients are rounded half away from zero to 18 places
+	assert.Equal(t, "0.333333333333333333", money.New(1).Quo(money.New(3)).String())
+	assert.Equal(t, "0.666666666666666667", money.New(2).Quo(money.New(3)).String())
+	assert.Equal(t, "-0.666666666666666667", money.New(-2).Quo(money.New(3)).String())
+	assert.Panics(t, func() { money.New(1).Quo(money.New(0)) })
+
+	assert.Equal(t, "1500", parse(t, "1.5").Shift(3).String())
+	assert.Equal(t, "0.000000000000000002", parse(t, "1.5").Shift(-18).String())
+
+	// a nil Decimal is 0
+	var zero *money.Decimal
+	assert.Equal(t, 0, zero.Sign())
+	assert.Equal(t, "0", zero.String())
+	assert.Equal(t, "1", zero.Add(money.New(1)).String())
+}
+
+func Test_Units(t *testing.T) {
+	wei, _ := new(big.Int).SetString("1234567890123456789", 10)
+	d := money.FromUnits(wei, 18)
+	assert.Equal(t, "1.234567890123456789", d.String())
+	assert.Equal(t, wei, d.Units(18))
+	assert.Equal(t, "1234567", d.Units(6).String(), "the units are truncated")
+	assert.Equal(t, "1", d.Int().String())
+	assert.Equal(t, "-1", parse(t, "-1.9").Int().String(), "the units are truncated toward zero")
+
+	assert.Equal(t, "1.234567", money.FromUnits(big.NewInt(1234567), 6).String())
+	assert.Equal(t, "0.000000000000000001", money.FromUnits(big.NewInt(5), 19).String())
+
+	assert.Equal(t, "0.1", money.New(1).Quo(money.New(10)).Float().Text('g', -1))
+
+	// 6.999999999999999997 / 7 is 0.99999999999999999957..., the Quo rounds it up to 1 at 18 places
+	almost := parse(t, "6.999999999999999997")
+	assert.Equal(t, "1", almost.Quo(money.New(7)).Int().String())
+	assert.Equal(t, "0", almost.QuoUnits(money.New(7), 0).String(), "the quotient is truncated")
+	assert.Equal(t, "999999999999999999", almost.QuoUnits(money.New(7), 18).String())
+	assert.Equal(t, "10", parse(t, "109").QuoUnits(money.New(1), -1).String(), "the quotient is truncated")
+}
+
+func Test_JSON(t *testing.T) {
+	var v struct {
+		Number *money.Decimal `json:"number"`
+		String *money.Decimal `json:"string"`
+		Null   *money.Decimal `json:"null"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(`{"number":0.000000000000000001,"string":"1.2e15","null":null}`), &v))
+	assert.Equal(t, "0.000000000000000001", v.Number.String())
+	assert.Equal(t, "1200000000000000", v.String.String())
+	assert.Nil(t, v.Null)
+
+	b, err := json.Marshal(v)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"number":"0.000000000000000001","string":"1200000000000000","null":null}`, string(b))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"number":"abc"}`), &v))
+}
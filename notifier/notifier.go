@@ -0,0 +1,273 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/config"
+)
+
+// Kind is the kind of an event, the sinks route the events by it
+type Kind string
+
+const (
+	PayoutSent       = Kind("payout_sent")
+	PayoutFailed     = Kind("payout_failed")
+	CapReached       = Kind("cap_reached")
+	SubscriptionDead = Kind("subscription_dead")
+	CrawlerFailed    = Kind("crawler_failed")
+	LowBalance       = Kind("low_balance")
+	DailySummary     = Kind("daily_summary")
+	CampaignEnded    = Kind("campaign_ended")
+)
+
+// Event is emitted by the services
+type Event struct {
+	Kind    Kind                   `json:"kind"`
+	Service string                 `json:"service"`
+	At      time.Time              `json:"at"`
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// Text renders the event as a chat message
+func (e *Event) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s] %s: %s", e.Service, e.Kind, e.Message)
+
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "\n%s: %v", k, e.Fields[k])
+	}
+	return b.String()
+}
+
+type sink struct {
+	name    string
+	format  config.NotifierFormat
+	url     string
+	chatID  string
+	events  map[Kind]struct{}
+	max     int
+	client  *http.Client
+	sentAts []time.Time
+}
+
+func (s *sink) routes(kind Kind) bool {
+	if len(s.events) == 0 {
+		return true
+	}
+	_, ok := s.events[kind]
+	return ok
+}
+
+// allow tells the event can be sent in the rolling minute, and records it if so
+func (s *sink) allow(now time.Time) bool {
+	if s.max <= 0 {
+		return true
+	}
+
+	since := now.Add(-time.Minute)
+	i := 0
+	for i < len(s.sentAts) && !s.sentAts[i].After(since) {
+		i++
+	}
+	s.sentAts = s.sentAts[i:]
+
+	if len(s.sentAts) >= s.max {
+		return false
+	}
+	s.sentAts = append(s.sentAts, now)
+	return true
+}
+
+func (s *sink) payload(e *Event) ([]byte, error) {
+	switch s.format {
+	case config.SlackFormat:
+		return json.Marshal(map[string]string{"text": e.Text()})
+	case config.DiscordFormat:
+		return json.Marshal(map[string]string{"content": e.Text()})
+	case config.TelegramFormat:
+		return json.Marshal(map[string]string{"chat_id": s.chatID, "text": e.Text()})
+	default:
+		return json.Marshal(e)
+	}
+}
+
+func (s *sink) send(e *Event) error {
+	body, err := s.payload(e)
+	if err != nil {
+		return fmt.Errorf("notifier json marshal failed:%w, sink:%s", err, s.name)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("notifier new request failed:%w, sink:%s", redact(err), s.name)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	rep, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("notifier request failed:%w, sink:%s", redact(err), s.name)
+	}
+	defer rep.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, rep.Body)
+
+	if rep.StatusCode/100 != 2 {
+		return fmt.Errorf("notifier sink:%s responded status:%s", s.name, rep.Status)
+	}
+	return nil
+}
+
+// redact drops the url out of the error, as the url of a sink holds the secrets like the telegram bot token or the webhook key
+func redact(err error) error {
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		return fmt.Errorf("%s: %w", uerr.Op, uerr.Err)
+	}
+	return err
+}
+
+// Notifier sends the events to the webhooks in a forked out goroutine
+type Notifier struct {
+	sinks  []*sink
+	events chan *Event
+	wg     sync.WaitGroup
+
+	mux    sync.RWMutex
+	closed bool
+
+	stderrlogger *log.Logger
+}
+
+// New returns a Notifier and starts sending, a nil config returns a nil Notifier which drops everything
+func New(conf *config.Notifier) (*Notifier, error) {
+	if conf == nil {
+		return nil, nil
+	}
+
+	queueSize := 100
+	if conf.QueueSize > 0 {
+		queueSize = conf.QueueSize
+	}
+
+	n := &Notifier{
+		events:       make(chan *Event, queueSize),
+		stderrlogger: log.New(os.Stderr, "notifier:", log.Lmsgprefix),
+	}
+
+	for i, sc := range conf.Sinks {
+		if sc.URL == "" {
+			return nil, fmt.Errorf("notifier sink:%d url is a MUST filled field", i)
+		}
+
+		switch sc.Format {
+		case "", config.JSONFormat, config.SlackFormat, config.DiscordFormat:
+		case config.TelegramFormat:
+			if sc.ChatID == "" {
+				return nil, errors.New("notifier telegram format needs the chat_id")
+			}
+		default:
+			return nil, fmt.Errorf("notifier unknown format:%q", sc.Format)
+		}
+
+		timeout := 10 * time.Second
+		if sc.TimeoutSec > 0 {
+			timeout = time.Duration(sc.TimeoutSec) * time.Second
+		}
+
+		s := &sink{
+			name:   sc.Name,
+			format: sc.Format,
+			url:    sc.URL,
+			chatID: sc.ChatID,
+			events: make(map[Kind]struct{}, len(sc.Events)),
+			max:    sc.MaxPerMinute,
+			client: &http.Client{Timeout: timeout},
+		}
+		if s.name == "" {
+			s.name = fmt.Sprintf("%d", i)
+		}
+		for _, kind := range sc.Events {
+			s.events[Kind(kind)] = struct{}{}
+		}
+		n.sinks = append(n.sinks, s)
+	}
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		for e := range n.events {
+			n.dispatch(e)
+		}
+	}()
+
+	return n, nil
+}
+
+func (n *Notifier) dispatch(e *Event) {
+	for _, s := range n.sinks {
+		if !s.routes(e.Kind) {
+			continue
+		}
+		if !s.allow(time.Now()) {
+			n.stderrlogger.Printf("sink:%s rate limited, dropped event kind:%s, service:%s", s.name, e.Kind, e.Service)
+			continue
+		}
+		if err := s.send(e); err != nil {
+			n.stderrlogger.Println(err)
+		}
+	}
+}
+
+// Notify queues the event without blocking, the event is dropped once the queue is full
+func (n *Notifier) Notify(kind Kind, service, message string, fields map[string]interface{}) {
+	if n == nil {
+		return
+	}
+
+	n.mux.RLock()
+	defer n.mux.RUnlock()
+	if n.closed {
+		return
+	}
+
+	select {
+	case n.events <- &Event{Kind: kind, Service: service, At: time.Now().UTC(), Message: message, Fields: fields}:
+	default:
+		n.stderrlogger.Printf("queue is full, dropped event kind:%s, service:%s", kind, service)
+	}
+}
+
+// Close sends the queued events then stops
+func (n *Notifier) Close() {
+	if n == nil {
+		return
+	}
+
+	n.mux.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.events)
+	}
+	n.mux.Unlock()
+
+	n.wg.Wait()
+}
@@ -0,0 +1,104 @@
+package notifier_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/FindoraNetwork/refunder/config"
+	"github.com/FindoraNetwork/refunder/notifier"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type receiver struct {
+	mux    sync.Mutex
+	bodies map[string][]map[string]interface{}
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body := map[string]interface{}{}
+	_ = json.NewDecoder(req.Body).Decode(&body)
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.bodies[req.URL.Path] = append(r.bodies[req.URL.Path], body)
+}
+
+func Test_Notifier(t *testing.T) {
+	r := &receiver{bodies: make(map[string][]map[string]interface{})}
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	n, err := notifier.New(&config.Notifier{Sinks: []*config.NotifierSink{
+		{Name: "json", URL: srv.URL + "/json"},
+		{Name: "slack", Format: config.SlackFormat, URL: srv.URL + "/slack", Events: []string{"payout_failed"}},
+		{Name: "discord", Format: config.DiscordFormat, URL: srv.URL + "/discord", MaxPerMinute: 1},
+		{Name: "telegram", Format: config.TelegramFormat, URL: srv.URL + "/telegram", ChatID: "42", Events: []string{"low_balance"}},
+	}})
+	assert.NoError(t, err)
+
+	n.Notify(notifier.PayoutSent, "giveaway", "sent", map[string]interface{}{"wei": "1"})
+	n.Notify(notifier.PayoutFailed, "gasfee", "nonce too low", nil)
+	n.Notify(notifier.LowBalance, "gasfee", "below warning", nil)
+	n.Close()
+
+	// dropped after closed
+	n.Notify(notifier.PayoutSent, "giveaway", "sent", nil)
+
+	assert.Len(t, r.bodies["/json"], 3)
+	assert.Equal(t, "payout_sent", r.bodies["/json"][0]["kind"])
+	assert.Equal(t, "giveaway", r.bodies["/json"][0]["service"])
+	assert.Equal(t, map[string]interface{}{"wei": "1"}, r.bodies["/json"][0]["fields"])
+
+	assert.Equal(t, []map[string]interface{}{{"text": "[gasfee] payout_failed: nonce too low"}}, r.bodies["/slack"])
+
+	// rate limited
+	assert.Equal(t, []map[string]interface{}{{"content": "[giveaway] payout_sent: sent\nwei: 1"}}, r.bodies["/discord"])
+
+	assert.Equal(t, []map[string]interface{}{{"chat_id": "42", "text": "[gasfee] low_balance: below warning"}}, r.bodies["/telegram"])
+}
+
+func Test_New(t *testing.T) {
+	n, err := notifier.New(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, n)
+	n.Notify(notifier.PayoutSent, "giveaway", "nothing happens", nil)
+	n.Close()
+
+	_, err = notifier.New(&config.Notifier{Sinks: []*config.NotifierSink{{Format: config.SlackFormat}}})
+	assert.Error(t, err)
+	_, err = notifier.New(&config.Notifier{Sinks: []*config.NotifierSink{{Format: config.TelegramFormat, URL: "http://127.0.0.1"}}})
+	assert.Error(t, err)
+	_, err = notifier.New(&config.Notifier{Sinks: []*config.NotifierSink{{Format: "sms", URL: "http://127.0.0.1"}}})
+	assert.Error(t, err)
+}
+
+func Test_RedactedErrors(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	stderr := os.Stderr
+	os.Stderr = w
+	n, err := notifier.New(&config.Notifier{Sinks: []*config.NotifierSink{
+		{Name: "telegram", Format: config.TelegramFormat, URL: srv.URL + "/bot123:SECRET/sendMessage", ChatID: "42"},
+	}})
+	os.Stderr = stderr
+	assert.NoError(t, err)
+
+	n.Notify(notifier.PayoutFailed, "gasfee", "nonce too low", nil)
+	n.Close()
+	w.Close()
+
+	b, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "notifier request failed")
+	assert.Contains(t, string(b), "sink:telegram")
+	assert.NotContains(t, string(b), "SECRET", "the url of the sink is never logged")
+}
@@ -0,0 +1,123 @@
+package payout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/client"
+	"github.com/FindoraNetwork/refunder/config"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	defaultBatchSize   = 100
+	defaultBatchWindow = time.Minute
+)
+
+const disperseABI = `[
+	{"type":"function","name":"disperseEther","stateMutability":"payable","inputs":[{"name":"recipients","type":"address[]"},{"name":"values","type":"uint256[]"}],"outputs":[]},
+	{"type":"function","name":"disperseToken","stateMutability":"nonpayable","inputs":[{"name":"token","type":"address"},{"name":"recipients","type":"address[]"},{"name":"values","type":"uint256[]"}],"outputs":[]}
+]`
+
+var disperse, _ = abi.JSON(strings.NewReader(disperseABI))
+
+// ErrInsufficientAllowance stops a token batch the founding source has not approved the multisend contract to spend,
+// the contract is never approved by the service itself
+var ErrInsufficientAllowance = errors.New("founding source allowance for the batch contract is insufficient")
+
+// Batcher builds the payouts into a single call of a multisend contract
+type Batcher struct {
+	contract common.Address
+	maxSize  int
+	window   time.Duration
+}
+
+// NewBatcher returns a Batcher of the contract, a nil config returns a nil Batcher and the payouts are sent one by one
+func NewBatcher(conf *config.Batch) (*Batcher, error) {
+	if conf == nil {
+		return nil, nil
+	}
+	if !common.IsHexAddress(conf.ContractAddress) {
+		return nil, fmt.Errorf("batch contract_address:%q is not an address", conf.ContractAddress)
+	}
+
+	b := &Batcher{contract: common.HexToAddress(conf.ContractAddress), maxSize: defaultBatchSize, window: defaultBatchWindow}
+	if conf.MaxSize > 0 {
+		b.maxSize = conf.MaxSize
+	}
+	if conf.WindowSec > 0 {
+		b.window = time.Duration(conf.WindowSec) * time.Second
+	}
+	return b, nil
+}
+
+// MaxSize is the most payouts in a batch
+func (b *Batcher) MaxSize() int {
+	return b.maxSize
+}
+
+// Window is how long the payouts are collected into a batch
+func (b *Batcher) Window() time.Duration {
+	return b.window
+}
+
+// Tx returns the unsigned multisend of the amounts to the recipients in the token of the Payer,
+// a token batch needs the allowance of the founding source for the contract covering the total,
+// it's estimated by the node, so a batch going to revert fails here and the payouts can be sent one by one
+func (b *Batcher) Tx(ctx context.Context, c client.Client, g *Gas, p *Payer, from common.Address, recipients []common.Address, amounts []*big.Int, nonce uint64, gasPrice *big.Int) (*types.Transaction, error) {
+	if len(recipients) == 0 || len(recipients) != len(amounts) {
+		return nil, errors.New("batch recipients and amounts are not paired")
+	}
+
+	total := big.NewInt(0)
+	for _, amount := range amounts {
+		total.Add(total, amount)
+	}
+
+	var (
+		data  []byte
+		value = big.NewInt(0)
+		err   error
+	)
+	if token := p.Token(); token != nil {
+		if err := p.covers(ctx, c, from, total); err != nil {
+			return nil, err
+		}
+		allowance, err := p.Allowance(ctx, c, from, b.contract)
+		if err != nil {
+			return nil, err
+		}
+		if allowance.Cmp(total) < 0 {
+			return nil, fmt.Errorf("%w, token_address:%s, contract_address:%s, allowance:%s, total:%s", ErrInsufficientAllowance, *token, b.contract, allowance, total)
+		}
+		data, err = disperse.Pack("disperseToken", *token, recipients, amounts)
+	} else {
+		data, err = disperse.Pack("disperseEther", recipients, amounts)
+		value = total
+	}
+	if err != nil {
+		return nil, fmt.Errorf("packing batch failed:%w", err)
+	}
+
+	gas, err := g.estimate(ctx, c, ethereum.CallMsg{From: from, To: &b.contract, GasPrice: gasPrice, Value: value, Data: data})
+	if err != nil {
+		return nil, fmt.Errorf("batch %w, size:%d", err, len(recipients))
+	}
+
+	return types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		To:       &b.contract,
+		Value:    value,
+		Gas:      gas,
+		GasPrice: gasPrice,
+		Data:     data,
+	}), nil
+}
@@ -0,0 +1,73 @@
+package payout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/FindoraNetwork/refunder/client"
+	"github.com/FindoraNetwork/refunder/config"
+
+	"github.com/ethereum/go-ethereum"
+)
+
+// ErrGasEstimate stops a payout whose gas estimate fails or is over the ceiling, like a recipient contract reverting
+var ErrGasEstimate = errors.New("payout gas estimate failed")
+
+const (
+	onFailureSkip = "skip"
+	onFailureHold = "hold"
+)
+
+// Gas pads and caps the gas estimated by the node
+type Gas struct {
+	multiplier float64
+	ceiling    uint64
+	hold       bool
+}
+
+// NewGas returns the Gas of the config, a nil config returns a nil Gas taking the estimates as they are
+func NewGas(conf *config.Gas) (*Gas, error) {
+	if conf == nil {
+		return nil, nil
+	}
+	if conf.Multiplier != 0 && conf.Multiplier < 1 {
+		return nil, fmt.Errorf("gas multiplier:%v is less than 1", conf.Multiplier)
+	}
+
+	g := &Gas{multiplier: 1, ceiling: conf.Ceiling}
+	if conf.Multiplier > 0 {
+		g.multiplier = conf.Multiplier
+	}
+	switch conf.OnFailure {
+	case "", onFailureSkip:
+	case onFailureHold:
+		g.hold = true
+	default:
+		return nil, fmt.Errorf("gas on_failure:%q is not skip or hold", conf.OnFailure)
+	}
+	return g, nil
+}
+
+// Holds tells the recipient whose estimate fails is put into the approval queue instead of skipped
+func (g *Gas) Holds() bool {
+	return g != nil && g.hold
+}
+
+// estimate returns the padded gas of the call, ErrGasEstimate if the node fails it or it's over the ceiling
+func (g *Gas) estimate(ctx context.Context, c client.Client, msg ethereum.CallMsg) (uint64, error) {
+	gas, err := c.EstimateGas(ctx, msg)
+	if err != nil {
+		return 0, fmt.Errorf("%w:%v, to_address:%s", ErrGasEstimate, err, msg.To)
+	}
+	if g == nil {
+		return gas, nil
+	}
+
+	gas = uint64(math.Ceil(float64(gas) * g.multiplier))
+	if g.ceiling > 0 && gas > g.ceiling {
+		return 0, fmt.Errorf("%w: gas:%d is over the ceiling:%d, to_address:%s", ErrGasEstimate, gas, g.ceiling, msg.To)
+	}
+	return gas, nil
+}
@@ -0,0 +1,182 @@
+package payout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/FindoraNetwork/refunder/client"
+	"github.com/FindoraNetwork/refunder/config"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// NativeDecimal is the decimal of the native token in wei
+const NativeDecimal = 18
+
+const erc20ABI = `[
+	{"type":"function","name":"transfer","stateMutability":"nonpayable","inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]},
+	{"type":"function","name":"balanceOf","stateMutability":"view","inputs":[{"name":"owner","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"allowance","stateMutability":"view","inputs":[{"name":"owner","type":"address"},{"name":"spender","type":"address"}],"outputs":[{"name":"","type":"uint256"}]}
+]`
+
+var erc20, _ = abi.JSON(strings.NewReader(erc20ABI))
+
+// ErrInsufficientBalance stops a payout the founding source cannot cover
+var ErrInsufficientBalance = errors.New("founding source token balance is insufficient")
+
+// Payer builds the payout transactions, of the native token or of an ERC20 token
+type Payer struct {
+	token   common.Address
+	decimal int
+}
+
+// New returns a Payer of the ERC20 token, a nil config returns a nil Payer which pays the native token
+func New(conf *config.Payout) (*Payer, error) {
+	if conf == nil {
+		return nil, nil
+	}
+	if !common.IsHexAddress(conf.TokenAddress) {
+		return nil, fmt.Errorf("payout token_address:%q is not an address", conf.TokenAddress)
+	}
+
+	p := &Payer{token: common.HexToAddress(conf.TokenAddress), decimal: NativeDecimal}
+	if conf.Decimal > 0 {
+		p.decimal = conf.Decimal
+	}
+	return p, nil
+}
+
+// Token returns the ERC20 token paid out, nil for the native token
+func (p *Payer) Token() *common.Address {
+	if p == nil {
+		return nil
+	}
+	token := p.token
+	return &token
+}
+
+// Decimal returns the decimal of the token paid out
+func (p *Payer) Decimal() int {
+	if p == nil {
+		return NativeDecimal
+	}
+	return p.decimal
+}
+
+// BalanceOf returns the balance of the owner in the token paid out
+func (p *Payer) BalanceOf(ctx context.Context, c client.Client, owner common.Address) (*big.Int, error) {
+	if p == nil {
+		v, err := c.BalanceAt(ctx, owner, nil)
+		if err != nil {
+			return nil, fmt.Errorf("BalanceAt failed:%w, address:%s", err, owner)
+		}
+		return v, nil
+	}
+
+	data, err := erc20.Pack("balanceOf", owner)
+	if err != nil {
+		return nil, fmt.Errorf("packing balanceOf failed:%w", err)
+	}
+	out, err := c.CallContract(ctx, ethereum.CallMsg{From: owner, To: &p.token, Data: data}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("CallContract balanceOf failed:%w, token_address:%s, address:%s", err, p.token, owner)
+	}
+	values, err := erc20.Unpack("balanceOf", out)
+	if err != nil {
+		return nil, fmt.Errorf("unpacking balanceOf failed:%w, token_address:%s", err, p.token)
+	}
+	return values[0].(*big.Int), nil
+}
+
+// Allowance returns the amount of the token paid out the owner allows the spender to transfer, the native token has no allowance
+func (p *Payer) Allowance(ctx context.Context, c client.Client, owner, spender common.Address) (*big.Int, error) {
+	if p == nil {
+		return nil, errors.New("allowance of the native token")
+	}
+
+	data, err := erc20.Pack("allowance", owner, spender)
+	if err != nil {
+		return nil, fmt.Errorf("packing allowance failed:%w", err)
+	}
+	out, err := c.CallContract(ctx, ethereum.CallMsg{From: owner, To: &p.token, Data: data}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("CallContract allowance failed:%w, token_address:%s, address:%s", err, p.token, owner)
+	}
+	values, err := erc20.Unpack("allowance", out)
+	if err != nil {
+		return nil, fmt.Errorf("unpacking allowance failed:%w, token_address:%s", err, p.token)
+	}
+	return values[0].(*big.Int), nil
+}
+
+// covers checks the token balance of the founding source covers the amount
+func (p *Payer) covers(ctx context.Context, c client.Client, from common.Address, amount *big.Int) error {
+	balance, err := p.BalanceOf(ctx, c, from)
+	if err != nil {
+		return err
+	}
+	if balance.Cmp(amount) < 0 {
+		return fmt.Errorf("%w, token_address:%s, balance:%s, amount:%s", ErrInsufficientBalance, p.token, balance, amount)
+	}
+	return nil
+}
+
+// msg returns the call of the payout of the amount to the recipient
+func (p *Payer) msg(from, to common.Address, amount, gasPrice *big.Int) (ethereum.CallMsg, error) {
+	if p == nil {
+		return ethereum.CallMsg{From: from, To: &to, GasPrice: gasPrice, Value: amount}, nil
+	}
+
+	data, err := erc20.Pack("transfer", to, amount)
+	if err != nil {
+		return ethereum.CallMsg{}, fmt.Errorf("packing transfer failed:%w", err)
+	}
+	return ethereum.CallMsg{From: from, To: &p.token, GasPrice: gasPrice, Value: big.NewInt(0), Data: data}, nil
+}
+
+// Estimate returns the gas of the payout of the amount to the recipient, padded and capped by the Gas,
+// ErrGasEstimate tells the recipient cannot be paid, like a contract reverting on the value,
+// and the ERC20 balance of the founding source is checked first, so a short balance is not taken for the recipient
+func (p *Payer) Estimate(ctx context.Context, c client.Client, g *Gas, from, to common.Address, amount, gasPrice *big.Int) (uint64, error) {
+	if p != nil {
+		if err := p.covers(ctx, c, from, amount); err != nil {
+			return 0, err
+		}
+	}
+
+	msg, err := p.msg(from, to, amount, gasPrice)
+	if err != nil {
+		return 0, err
+	}
+	return g.estimate(ctx, c, msg)
+}
+
+// Tx returns the unsigned payout of the amount to the recipient of the gas returned by Estimate,
+// a gas of 0 is estimated by the node here, so a payout going to revert fails here instead of on the chain
+func (p *Payer) Tx(ctx context.Context, c client.Client, g *Gas, from, to common.Address, amount *big.Int, gas, nonce uint64, gasPrice *big.Int) (*types.Transaction, error) {
+	if gas == 0 {
+		var err error
+		if gas, err = p.Estimate(ctx, c, g, from, to, amount, gasPrice); err != nil {
+			return nil, err
+		}
+	}
+
+	msg, err := p.msg(from, to, amount, gasPrice)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		To:       msg.To,
+		Value:    msg.Value,
+		Gas:      gas,
+		GasPrice: gasPrice,
+		Data:     msg.Data,
+	}), nil
+}
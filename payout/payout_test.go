@@ -0,0 +1,222 @@
+package payout_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/client"
+	"github.com/FindoraNetwork/refunder/config"
+	"github.com/FindoraNetwork/refunder/e2e/giveaway/contract"
+	"github.com/FindoraNetwork/refunder/payout"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Payer(t *testing.T) {
+	ctx := context.Background()
+	priv, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	auth, err := bind.NewKeyedTransactorWithChainID(priv, big.NewInt(1337))
+	assert.NoError(t, err)
+	from := auth.From
+	recipient := common.HexToAddress("0xb0b")
+
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{
+		from: {Balance: big.NewInt(0).Mul(big.NewInt(10), big.NewInt(1e18))},
+	}, 4712388)
+	c := &client.MockClient{Client: backend}
+
+	token, _, frc20, err := contract.DeployContract(auth, backend)
+	assert.NoError(t, err)
+	backend.Commit()
+	_, err = frc20.Mint(auth, from, big.NewInt(1000))
+	assert.NoError(t, err)
+	backend.Commit()
+
+	nonce, err := backend.PendingNonceAt(ctx, from)
+	assert.NoError(t, err)
+	gasPrice, err := backend.SuggestGasPrice(ctx)
+	assert.NoError(t, err)
+
+	_, err = payout.New(&config.Payout{TokenAddress: "token"})
+	assert.Error(t, err, "the token address is not an address")
+
+	// a nil Payer pays the native token
+	native, err := payout.New(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, native.Token())
+	assert.Equal(t, payout.NativeDecimal, native.Decimal())
+	tx, err := native.Tx(ctx, c, nil, from, recipient, big.NewInt(42), 0, 7, gasPrice)
+	assert.NoError(t, err)
+	assert.Equal(t, recipient, *tx.To())
+	assert.Equal(t, "42", tx.Value().String())
+	assert.Equal(t, uint64(21000), tx.Gas())
+	assert.Empty(t, tx.Data())
+
+	payer, err := payout.New(&config.Payout{TokenAddress: token.String(), Decimal: 6})
+	assert.NoError(t, err)
+	assert.Equal(t, token, *payer.Token())
+	assert.Equal(t, 6, payer.Decimal())
+
+	balance, err := payer.BalanceOf(ctx, c, from)
+	assert.NoError(t, err)
+	assert.Equal(t, "1000", balance.String())
+
+	// the transfer is over the balance of the founding source
+	_, err = payer.Tx(ctx, c, nil, from, recipient, big.NewInt(1001), 0, nonce, gasPrice)
+	assert.True(t, errors.Is(err, payout.ErrInsufficientBalance))
+
+	gas, err := payer.Estimate(ctx, c, nil, from, recipient, big.NewInt(400), nil)
+	assert.NoError(t, err)
+	assert.Greater(t, gas, uint64(21000))
+
+	// the given estimate is taken as it is, without estimating again
+	tx, err = payer.Tx(ctx, c, nil, from, recipient, big.NewInt(400), gas, nonce, gasPrice)
+	assert.NoError(t, err)
+	assert.Equal(t, token, *tx.To())
+	assert.Equal(t, "0", tx.Value().String())
+	assert.Equal(t, gas, tx.Gas())
+
+	signed, err := types.SignTx(tx, types.LatestSignerForChainID(big.NewInt(1337)), priv)
+	assert.NoError(t, err)
+	assert.NoError(t, backend.SendTransaction(ctx, signed))
+	backend.Commit()
+
+	balance, err = payer.BalanceOf(ctx, c, recipient)
+	assert.NoError(t, err)
+	assert.Equal(t, "400", balance.String())
+	balance, err = payer.BalanceOf(ctx, c, from)
+	assert.NoError(t, err)
+	assert.Equal(t, "600", balance.String())
+}
+
+func Test_Batcher(t *testing.T) {
+	ctx := context.Background()
+	priv, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	auth, err := bind.NewKeyedTransactorWithChainID(priv, big.NewInt(1337))
+	assert.NoError(t, err)
+	from := auth.From
+	recipients := []common.Address{common.HexToAddress("0xb0b"), common.HexToAddress("0xca1")}
+	amounts := []*big.Int{big.NewInt(400), big.NewInt(700)}
+
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{
+		from: {Balance: big.NewInt(0).Mul(big.NewInt(10), big.NewInt(1e18))},
+	}, 4712388)
+	c := &client.MockClient{Client: backend}
+
+	token, _, frc20, err := contract.DeployContract(auth, backend)
+	assert.NoError(t, err)
+	backend.Commit()
+	_, err = frc20.Mint(auth, from, big.NewInt(1000))
+	assert.NoError(t, err)
+	backend.Commit()
+
+	gasPrice, err := backend.SuggestGasPrice(ctx)
+	assert.NoError(t, err)
+
+	batcher, err := payout.NewBatcher(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, batcher)
+
+	_, err = payout.NewBatcher(&config.Batch{ContractAddress: "disperse"})
+	assert.Error(t, err, "the contract address is not an address")
+
+	batcher, err = payout.NewBatcher(&config.Batch{ContractAddress: "0x000000000000000000000000000000000000d15e"})
+	assert.NoError(t, err)
+	assert.Equal(t, 100, batcher.MaxSize())
+	assert.Equal(t, time.Minute, batcher.Window())
+
+	_, err = batcher.Tx(ctx, c, nil, nil, from, recipients, amounts[:1], 0, gasPrice)
+	assert.Error(t, err, "the recipients and the amounts are not paired")
+
+	// the native batch pays the total as the value
+	tx, err := batcher.Tx(ctx, c, nil, nil, from, recipients, amounts, 0, gasPrice)
+	assert.NoError(t, err)
+	assert.Equal(t, common.HexToAddress("0x000000000000000000000000000000000000d15e"), *tx.To())
+	assert.Equal(t, "1100", tx.Value().String())
+	assert.NotEmpty(t, tx.Data())
+
+	// the token batch is over the balance of the founding source
+	payer, err := payout.New(&config.Payout{TokenAddress: token.String()})
+	assert.NoError(t, err)
+	_, err = batcher.Tx(ctx, c, nil, payer, from, recipients, amounts, 0, gasPrice)
+	assert.True(t, errors.Is(err, payout.ErrInsufficientBalance))
+
+	// the token batch is over the allowance for the contract
+	_, err = frc20.Mint(auth, from, big.NewInt(1000))
+	assert.NoError(t, err)
+	_, err = frc20.Approve(auth, common.HexToAddress("0x000000000000000000000000000000000000d15e"), big.NewInt(1099))
+	assert.NoError(t, err)
+	backend.Commit()
+	_, err = batcher.Tx(ctx, c, nil, payer, from, recipients, amounts, 0, gasPrice)
+	assert.True(t, errors.Is(err, payout.ErrInsufficientAllowance), err)
+
+	// the token resets the allowance to 0 before changing it
+	for _, allowance := range []int64{0, 1100} {
+		_, err = frc20.Approve(auth, common.HexToAddress("0x000000000000000000000000000000000000d15e"), big.NewInt(allowance))
+		assert.NoError(t, err)
+		backend.Commit()
+	}
+	tx, err = batcher.Tx(ctx, c, nil, payer, from, recipients, amounts, 0, gasPrice)
+	assert.NoError(t, err)
+	assert.Equal(t, common.HexToAddress("0x000000000000000000000000000000000000d15e"), *tx.To())
+	assert.Equal(t, "0", tx.Value().String(), "the token batch pays no native value")
+}
+
+func Test_Gas(t *testing.T) {
+	ctx := context.Background()
+	priv, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	auth, err := bind.NewKeyedTransactorWithChainID(priv, big.NewInt(1337))
+	assert.NoError(t, err)
+	from := auth.From
+	recipient := common.HexToAddress("0xb0b")
+
+	backend := backends.NewSimulatedBackend(core.GenesisAlloc{
+		from: {Balance: big.NewInt(0).Mul(big.NewInt(10), big.NewInt(1e18))},
+	}, 4712388)
+	c := &client.MockClient{Client: backend}
+
+	// the token contract has no payable fallback, so it cannot be paid the native token
+	token, _, _, err := contract.DeployContract(auth, backend)
+	assert.NoError(t, err)
+	backend.Commit()
+
+	_, err = payout.NewGas(&config.Gas{Multiplier: 0.5})
+	assert.Error(t, err, "the multiplier is less than 1")
+	_, err = payout.NewGas(&config.Gas{OnFailure: "queue"})
+	assert.Error(t, err, "the on_failure is not skip or hold")
+
+	// a nil Gas takes the estimate as it is and skips the failures
+	gas, err := payout.NewGas(nil)
+	assert.NoError(t, err)
+	assert.False(t, gas.Holds())
+	estimated, err := (*payout.Payer)(nil).Estimate(ctx, c, gas, from, recipient, big.NewInt(42), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(21000), estimated)
+
+	_, err = (*payout.Payer)(nil).Estimate(ctx, c, gas, from, token, big.NewInt(42), nil)
+	assert.True(t, errors.Is(err, payout.ErrGasEstimate))
+
+	gas, err = payout.NewGas(&config.Gas{Multiplier: 1.5, OnFailure: "hold"})
+	assert.NoError(t, err)
+	assert.True(t, gas.Holds())
+	estimated, err = (*payout.Payer)(nil).Estimate(ctx, c, gas, from, recipient, big.NewInt(42), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(31500), estimated)
+
+	gas, err = payout.NewGas(&config.Gas{Multiplier: 1.5, Ceiling: 30000})
+	assert.NoError(t, err)
+	_, err = (*payout.Payer)(nil).Estimate(ctx, c, gas, from, recipient, big.NewInt(42), nil)
+	assert.True(t, errors.Is(err, payout.ErrGasEstimate), "the padded gas is over the ceiling")
+}
@@ -0,0 +1,309 @@
+package payout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/balance"
+	"github.com/FindoraNetwork/refunder/client"
+	"github.com/FindoraNetwork/refunder/ledger"
+	"github.com/FindoraNetwork/refunder/notifier"
+	"github.com/FindoraNetwork/refunder/signer"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	// receiptInterval is the polling interval of the batch receipt
+	receiptInterval = time.Second
+	// receiptTimeout bounds the waiting of the batch receipt, a batch not mined by then is kept as sent
+	receiptTimeout = 2 * time.Minute
+)
+
+// SenderOptions are the parts of a service sending the payouts
+type SenderOptions struct {
+	// Name is the service name of the ledger records, the notifications and the logs
+	Name     string
+	Signer   signer.Signer
+	Payer    *Payer
+	Batcher  *Batcher
+	Gas      *Gas
+	Balance  *balance.Monitor
+	Ledger   *ledger.Ledger
+	Notifier *notifier.Notifier
+}
+
+// Settle books a sent payout into the totals of the service, like the paid out wei and the limits, and returns the total
+type Settle func(rec *ledger.Record) (*big.Int, error)
+
+// Result is the payout of a record in a batch
+type Result struct {
+	Tx *types.Transaction
+	// Total is returned by the Settle
+	Total *big.Int
+	Err   error
+}
+
+// Sender signs and broadcasts the payouts of a founding source and records them into the ledger,
+// the sendings are serialized to avoid the nonce conflicts
+type Sender struct {
+	name     string
+	signer   signer.Signer
+	from     common.Address
+	payer    *Payer
+	batcher  *Batcher
+	gas      *Gas
+	balance  *balance.Monitor
+	ledger   *ledger.Ledger
+	notifier *notifier.Notifier
+
+	stderrlogger *log.Logger
+
+	mux sync.Mutex
+}
+
+// NewSender returns the Sender of the options
+func NewSender(opts *SenderOptions) *Sender {
+	return &Sender{
+		name:         opts.Name,
+		signer:       opts.Signer,
+		from:         opts.Signer.Address(),
+		payer:        opts.Payer,
+		batcher:      opts.Batcher,
+		gas:          opts.Gas,
+		balance:      opts.Balance,
+		ledger:       opts.Ledger,
+		notifier:     opts.Notifier,
+		stderrlogger: log.New(os.Stderr, opts.Name+"Service:", log.Lmsgprefix),
+	}
+}
+
+// Failed records the failure of a payout into the ledger, notifies it and returns the err
+func (s *Sender) Failed(rec *ledger.Record, err error) error {
+	rec.Service, rec.Status, rec.Error = s.name, ledger.Failed, err.Error()
+	if lerr := s.ledger.Append(rec); lerr != nil {
+		s.stderrlogger.Printf("ledger appending failed:%v", lerr)
+	}
+
+	s.notifier.Notify(notifier.PayoutFailed, s.name, err.Error(), map[string]interface{}{
+		"token_address": rec.Token,
+		"to_address":    rec.Recipient,
+		"wei":           rec.Wei.String(),
+		"tx_hash":       rec.SourceTxHash,
+	})
+	return err
+}
+
+// Send signs and broadcasts the payout of the record, then records it and books it by the settle,
+// balance.ErrPaused is returned as it is, the other failures are recorded
+func (s *Sender) Send(ctx context.Context, c client.Client, rec *ledger.Record, settle Settle) (*types.Transaction, *big.Int, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.balance.Paused() {
+		return nil, nil, balance.ErrPaused
+	}
+	return s.send(ctx, c, rec, settle)
+}
+
+func (s *Sender) send(ctx context.Context, c client.Client, rec *ledger.Record, settle Settle) (*types.Transaction, *big.Int, error) {
+	rec.Service = s.name
+
+	nonce, err := c.PendingNonceAt(ctx, s.from)
+	if err != nil {
+		return nil, nil, s.Failed(rec, fmt.Errorf("PendingNonceAt failed:%w", err))
+	}
+
+	gasPrice, err := c.SuggestGasPrice(ctx)
+	if err != nil {
+		return nil, nil, s.Failed(rec, fmt.Errorf("SuggestGasPrice failed:%w", err))
+	}
+
+	chainID, err := c.NetworkID(ctx)
+	if err != nil {
+		return nil, nil, s.Failed(rec, fmt.Errorf("NetworkID failed:%w", err))
+	}
+
+	rec.Nonce, rec.GasPrice, rec.PayoutToken = &nonce, gasPrice, s.payer.Token()
+
+	tx, err := s.payer.Tx(ctx, c, s.gas, s.from, rec.Recipient, rec.Wei, rec.Gas, nonce, gasPrice)
+	if err != nil {
+		return nil, nil, s.Failed(rec, err)
+	}
+
+	tx, err = s.signer.SignTx(ctx, tx, chainID)
+	if err != nil {
+		return nil, nil, s.Failed(rec, fmt.Errorf("SignTx failed:%w", err))
+	}
+
+	if err := c.SendTransaction(ctx, tx); err != nil {
+		return nil, nil, s.Failed(rec, fmt.Errorf("SendTransaction failed:%w, refund_tx_hash:%s", err, tx.Hash()))
+	}
+
+	total, err := s.sent(rec, tx, settle)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, total, nil
+}
+
+// sent records the payout sent by the tx into the ledger, notifies it and books it by the settle
+func (s *Sender) sent(rec *ledger.Record, tx *types.Transaction, settle Settle) (*big.Int, error) {
+	refundTxHash := tx.Hash()
+	rec.RefundTxHash, rec.Status, rec.At = &refundTxHash, ledger.Sent, time.Now().UTC()
+	if err := s.ledger.Append(rec); err != nil {
+		s.stderrlogger.Printf("ledger appending failed:%v, refund_tx_hash:%s", err, refundTxHash)
+	}
+	s.notifier.Notify(notifier.PayoutSent, s.name, "payout sent", map[string]interface{}{
+		"token_address":  rec.Token,
+		"to_address":     rec.Recipient,
+		"wei":            rec.Wei.String(),
+		"refund_tx_hash": refundTxHash,
+	})
+	return settle(rec)
+}
+
+// SendBatch sends the payouts of the records by a single multisend and returns the result of each record in order,
+// the batch falls back to the payouts one by one only if it never reached the node or reverted, so no recipient is paid twice
+func (s *Sender) SendBatch(ctx context.Context, c client.Client, recs []*ledger.Record, settle Settle) []*Result {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.balance.Paused() {
+		return s.failEach(recs, balance.ErrPaused)
+	}
+
+	tx, err := s.signBatch(ctx, c, recs)
+	if err != nil {
+		s.stderrlogger.Printf("batch of size:%d failed:%v, sending one by one", len(recs), err)
+		return s.sendEach(ctx, c, recs, settle)
+	}
+
+	if err := c.SendTransaction(ctx, tx); err != nil {
+		// the node may take the batch even though the reply is lost, so it's looked up before sending again
+		_, _, lerr := c.TransactionByHash(ctx, tx.Hash())
+		switch {
+		case errors.Is(lerr, ethereum.NotFound):
+			s.stderrlogger.Printf("batch of size:%d SendTransaction failed:%v, refund_tx_hash:%s, sending one by one", len(recs), err, tx.Hash())
+			return s.sendEach(ctx, c, recs, settle)
+		case lerr != nil:
+			err = fmt.Errorf("batch SendTransaction failed:%w, refund_tx_hash:%s, TransactionByHash failed:%v", err, tx.Hash(), lerr)
+			for _, rec := range recs {
+				s.Failed(rec, err)
+			}
+			return s.failEach(recs, err)
+		}
+		s.stderrlogger.Printf("batch SendTransaction failed:%v, but the node has it, refund_tx_hash:%s", err, tx.Hash())
+	}
+
+	receipt, err := s.waitReceipt(ctx, c, tx.Hash())
+	switch {
+	case err != nil:
+		// the ledger reconciliation reports the batch once it's mined or reverted
+		s.stderrlogger.Printf("batch receipt failed:%v, refund_tx_hash:%s, kept as sent", err, tx.Hash())
+	case receipt.Status == types.ReceiptStatusFailed:
+		s.stderrlogger.Printf("batch of size:%d reverted, refund_tx_hash:%s, sending one by one", len(recs), tx.Hash())
+		return s.sendEach(ctx, c, recs, settle)
+	}
+
+	results := make([]*Result, len(recs))
+	for i, rec := range recs {
+		r := &Result{Tx: tx}
+		r.Total, r.Err = s.sent(rec, tx, settle)
+		results[i] = r
+	}
+	return results
+}
+
+// sendEach sends the payouts of the records one by one
+func (s *Sender) sendEach(ctx context.Context, c client.Client, recs []*ledger.Record, settle Settle) []*Result {
+	results := make([]*Result, len(recs))
+	for i, rec := range recs {
+		r := &Result{}
+		r.Tx, r.Total, r.Err = s.send(ctx, c, rec, settle)
+		results[i] = r
+	}
+	return results
+}
+
+// failEach returns the err as the result of each record
+func (s *Sender) failEach(recs []*ledger.Record, err error) []*Result {
+	results := make([]*Result, len(recs))
+	for i := range recs {
+		results[i] = &Result{Err: err}
+	}
+	return results
+}
+
+// signBatch builds and signs the multisend paying the records, nothing is sent yet
+func (s *Sender) signBatch(ctx context.Context, c client.Client, recs []*ledger.Record) (*types.Transaction, error) {
+	nonce, err := c.PendingNonceAt(ctx, s.from)
+	if err != nil {
+		return nil, fmt.Errorf("PendingNonceAt failed:%w", err)
+	}
+
+	gasPrice, err := c.SuggestGasPrice(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("SuggestGasPrice failed:%w", err)
+	}
+
+	chainID, err := c.NetworkID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("NetworkID failed:%w", err)
+	}
+
+	recipients := make([]common.Address, 0, len(recs))
+	amounts := make([]*big.Int, 0, len(recs))
+	for _, rec := range recs {
+		recipients = append(recipients, rec.Recipient)
+		amounts = append(amounts, rec.Wei)
+	}
+
+	tx, err := s.batcher.Tx(ctx, c, s.gas, s.payer, s.from, recipients, amounts, nonce, gasPrice)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err = s.signer.SignTx(ctx, tx, chainID)
+	if err != nil {
+		return nil, fmt.Errorf("SignTx failed:%w", err)
+	}
+
+	for _, rec := range recs {
+		rec.Service = s.name
+		rec.Nonce, rec.GasPrice, rec.PayoutToken = &nonce, gasPrice, s.payer.Token()
+	}
+	return tx, nil
+}
+
+// waitReceipt polls the receipt of the tx until it's mined or the receiptTimeout passes
+func (s *Sender) waitReceipt(ctx context.Context, c client.Client, hash common.Hash) (*types.Receipt, error) {
+	ctx, cancel := context.WithTimeout(ctx, receiptTimeout)
+	defer cancel()
+
+	tick := time.NewTicker(receiptInterval)
+	defer tick.Stop()
+	for {
+		receipt, err := c.TransactionReceipt(ctx, hash)
+		if err != nil && !errors.Is(err, ethereum.NotFound) {
+			return nil, fmt.Errorf("TransactionReceipt failed:%w", err)
+		}
+		if receipt != nil {
+			return receipt, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting receipt failed:%w", ctx.Err())
+		case <-tick.C:
+		}
+	}
+}
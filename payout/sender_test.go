@@ -0,0 +1,123 @@
+package payout_test
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/FindoraNetwork/refunder/client"
+	"github.com/FindoraNetwork/refunder/config"
+	"github.com/FindoraNetwork/refunder/ledger"
+	"github.com/FindoraNetwork/refunder/payout"
+	"github.com/FindoraNetwork/refunder/signer"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+// node mines each sent tx, and may drop the tx, lose the reply of it or revert the first one
+type node struct {
+	*client.MockClient
+	drop, lose, revert bool
+	reverted           *common.Hash
+}
+
+func (n *node) NetworkID(context.Context) (*big.Int, error) {
+	return big.NewInt(1337), nil
+}
+
+func (n *node) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if n.drop {
+		n.drop = false
+		return errors.New("connection refused")
+	}
+	if err := n.MockClient.SendTransaction(ctx, tx); err != nil {
+		return err
+	}
+	n.Client.Commit()
+	if n.revert && n.reverted == nil {
+		hash := tx.Hash()
+		n.reverted = &hash
+	}
+	if n.lose {
+		n.lose = false
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+func (n *node) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	receipt, err := n.MockClient.TransactionReceipt(ctx, txHash)
+	if err == nil && n.reverted != nil && *n.reverted == txHash {
+		receipt.Status = types.ReceiptStatusFailed
+	}
+	return receipt, err
+}
+
+func Test_SenderBatch(t *testing.T) {
+	ctx := context.Background()
+	priv, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	key := signer.FromECDSA(priv)
+	from := key.Address()
+	recipients := []common.Address{common.HexToAddress("0xb0b"), common.HexToAddress("0xca1")}
+
+	batcher, err := payout.NewBatcher(&config.Batch{ContractAddress: "0x000000000000000000000000000000000000d15e"})
+	assert.NoError(t, err)
+	ledgerFile := t.TempDir() + "/ledger.jsonl"
+	sender := payout.NewSender(&payout.SenderOptions{
+		Name:    "giveaway",
+		Signer:  key,
+		Batcher: batcher,
+		Ledger:  ledger.Open(ledgerFile),
+	})
+
+	for _, tc := range []struct {
+		name    string
+		node    *node
+		txs     uint64
+		batched bool
+	}{
+		{name: "the batch is sent", node: &node{}, txs: 1, batched: true},
+		{name: "the reply of the batch is lost, it's not sent again", node: &node{lose: true}, txs: 1, batched: true},
+		{name: "the batch never reached the node", node: &node{drop: true}, txs: 2},
+		{name: "the batch reverted", node: &node{revert: true}, txs: 3},
+	} {
+		backend := backends.NewSimulatedBackend(core.GenesisAlloc{
+			from: {Balance: big.NewInt(0).Mul(big.NewInt(10), big.NewInt(1e18))},
+		}, 4712388)
+		tc.node.MockClient = &client.MockClient{Client: backend}
+
+		recs := []*ledger.Record{
+			{Recipient: recipients[0], Wei: big.NewInt(400)},
+			{Recipient: recipients[1], Wei: big.NewInt(700)},
+		}
+		settled := 0
+		results := sender.SendBatch(ctx, tc.node, recs, func(rec *ledger.Record) (*big.Int, error) {
+			settled++
+			return big.NewInt(int64(settled)), nil
+		})
+
+		nonce, err := backend.NonceAt(ctx, from, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.txs, nonce, tc.name)
+		assert.Equal(t, 2, settled, tc.name)
+		for i, r := range results {
+			assert.NoError(t, r.Err, tc.name)
+			assert.Equal(t, ledger.Sent, recs[i].Status, tc.name)
+			assert.Equal(t, r.Tx.Hash(), *recs[i].RefundTxHash, tc.name)
+			if tc.batched {
+				assert.Equal(t, results[0].Tx.Hash(), r.Tx.Hash(), tc.name)
+				continue
+			}
+			balance, err := backend.BalanceAt(ctx, recs[i].Recipient, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, recs[i].Wei.String(), balance.String(), tc.name)
+		}
+	}
+}
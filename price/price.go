@@ -0,0 +1,89 @@
+package price
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/FindoraNetwork/refunder/config"
+	"github.com/FindoraNetwork/refunder/money"
+)
+
+// Candle is the latest candlestick of a currency pair, the prices are taken exactly as the api writes them
+type Candle struct {
+	Close *money.Decimal
+	High  *money.Decimal
+	Low   *money.Decimal
+}
+
+// Pick returns the price of the kind
+func (c *Candle) Pick(kind config.PriceKind) *money.Decimal {
+	if kind == config.Lowest {
+		return c.Low
+	}
+	return c.High
+}
+
+// GateIO fetches the prices from the gate.io candlesticks api
+// https://www.gate.io/docs/apiv4/en/#market-candlesticks
+type GateIO struct {
+	Address string
+	Client  *http.Client
+}
+
+// NewGateIO returns a gate.io fetcher with the http.DefaultClient
+func NewGateIO(address string) *GateIO {
+	return &GateIO{Address: address, Client: http.DefaultClient}
+}
+
+// Fetch gets the latest 15 minutes candlestick of the currency pair
+func (g *GateIO) Fetch(ctx context.Context, pair config.CurrencyPair) (*Candle, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.Address, nil)
+	if err != nil {
+		return nil, fmt.Errorf("http.NewRequestWithContext failed:%w", err)
+	}
+
+	q := req.URL.Query()
+	q.Add("currency_pair", string(pair))
+	q.Add("interval", "15m")
+	q.Add("limit", "1")
+
+	req.Header.Add("Accept", "application/json")
+	req.URL.RawQuery = q.Encode()
+
+	rep, err := g.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http.Client.Do failed:%w, currency_pair:%s", err, pair)
+	}
+	defer rep.Body.Close()
+
+	// curl -H 'Accept: application/json' -X GET https://api.gateio.ws/api/v4/spot/candlesticks\?currency_pair\=FRA_USDT\&interval\=15m\&limit\=1
+	// [[unix_timestamp, trading_volume, close_price, highest_price, lowest_price, open_price]]
+	// [["1645749900","2839.79160470986265","0.01815","0.01897","0.01793","0.01889"]]
+	data := make([][]string, 0, 1)
+	if err := json.NewDecoder(rep.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("json decode failed:%w, currency_pair:%s", err, pair)
+	}
+
+	if len(data) == 0 || len(data[0]) < 5 {
+		return nil, fmt.Errorf("http response not correct:%v, currency_pair:%s", data, pair)
+	}
+
+	closed, err := money.Parse(data[0][2])
+	if err != nil {
+		return nil, fmt.Errorf("parse close price failed:%w, currency_pair:%s", err, pair)
+	}
+
+	high, err := money.Parse(data[0][3])
+	if err != nil {
+		return nil, fmt.Errorf("parse highest price failed:%w, currency_pair:%s", err, pair)
+	}
+
+	low, err := money.Parse(data[0][4])
+	if err != nil {
+		return nil, fmt.Errorf("parse lowest price failed:%w, currency_pair:%s", err, pair)
+	}
+
+	return &Candle{Close: closed, High: high, Low: low}, nil
+}
@@ -0,0 +1,42 @@
+package price_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/FindoraNetwork/refunder/config"
+	"github.com/FindoraNetwork/refunder/price"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GateIO(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("currency_pair") {
+		case "FRA_USDT":
+			_ = json.NewEncoder(w).Encode([][]string{{"1645749900", "2839.79160470986265", "0.01815", "0.01897", "0.01793", "0.01889"}})
+		case "EMPTY_USDT":
+			_ = json.NewEncoder(w).Encode([][]string{})
+		default:
+			_ = json.NewEncoder(w).Encode([][]string{{"1645749900", "2839.79160470986265", "0.01815", "not-a-number", "0.01793", "0.01889"}})
+		}
+	}))
+	defer srv.Close()
+
+	g := price.NewGateIO(srv.URL)
+
+	got, err := g.Fetch(context.Background(), config.CurrencyPair("FRA_USDT"))
+	assert.NoError(t, err)
+	assert.Equal(t, "0.01815", got.Close.String())
+	assert.Equal(t, "0.01897", got.Pick(config.Highest).String())
+	assert.Equal(t, "0.01793", got.Pick(config.Lowest).String())
+
+	_, err = g.Fetch(context.Background(), config.CurrencyPair("EMPTY_USDT"))
+	assert.Error(t, err)
+
+	_, err = g.Fetch(context.Background(), config.CurrencyPair("BROKEN_USDT"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,303 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/config"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type Status string
+
+const (
+	Sent    = Status("sent")
+	Held    = Status("held")
+	Skipped = Status("skipped")
+	Failed  = Status("failed")
+)
+
+// Entry is a handled event log of a run
+type Entry struct {
+	TxHash           common.Hash    `json:"tx_hash"`
+	Token            common.Address `json:"token_address"`
+	Recipient        common.Address `json:"to_address"`
+	TransferredUsdt  *big.Float     `json:"transferred_usdt,omitempty"`
+	TokenPrice       *big.Float     `json:"token_price,omitempty"`
+	NumeratorPrice   *big.Float     `json:"numerator_price,omitempty"`
+	DenominatorPrice *big.Float     `json:"denominator_price,omitempty"`
+	Eligible         bool           `json:"eligible"`
+	RefundWei        *big.Int       `json:"refund_wei,omitempty"`
+	RefundUsdt       *big.Float     `json:"refund_usdt,omitempty"`
+	RefundTxHash     *common.Hash   `json:"refund_tx_hash,omitempty"`
+	Status           Status         `json:"status"`
+	Reason           string         `json:"reason,omitempty"`
+}
+
+// Report is the structured result of a run
+type Report struct {
+	Service         string         `json:"service"`
+	StartedAt       time.Time      `json:"started_at"`
+	FinishedAt      time.Time      `json:"finished_at"`
+	FromBlock       uint64         `json:"from_block"`
+	ToBlock         uint64         `json:"to_block"`
+	LogsSeen        int            `json:"logs_seen"`
+	Eligible        int            `json:"eligible"`
+	Sent            int            `json:"sent"`
+	Held            int            `json:"held"`
+	Failed          int            `json:"failed"`
+	Skipped         map[string]int `json:"skipped"`
+	TotalWei        *big.Int       `json:"total_wei"`
+	CapRemainingWei *big.Int       `json:"cap_remaining_wei,omitempty"`
+	Entries         []*Entry       `json:"entries"`
+	Errors          []string       `json:"errors"`
+}
+
+// New returns an empty report of the service started now
+func New(service string, now time.Time) *Report {
+	return &Report{
+		Service:   service,
+		StartedAt: now.UTC(),
+		Skipped:   make(map[string]int),
+		TotalWei:  big.NewInt(0),
+		Entries:   []*Entry{},
+		Errors:    []string{},
+	}
+}
+
+// Add appends the entry and updates the counts
+func (r *Report) Add(e *Entry) {
+	r.LogsSeen++
+	if e.Eligible {
+		r.Eligible++
+	}
+
+	switch e.Status {
+	case Sent:
+		r.Sent++
+		if e.RefundWei != nil {
+			r.TotalWei.Add(r.TotalWei, e.RefundWei)
+		}
+	case Held:
+		r.Held++
+	case Failed:
+		r.Failed++
+	case Skipped:
+		r.Skipped[e.Reason]++
+	}
+
+	r.Entries = append(r.Entries, e)
+}
+
+// AddError records an error which is not bound to any entry
+func (r *Report) AddError(err error) {
+	r.Errors = append(r.Errors, err.Error())
+}
+
+// Finish sets the finished time and the remaining of the cap, a nil maxCapWei means no cap
+func (r *Report) Finish(now time.Time, spentWei, maxCapWei *big.Int) {
+	r.FinishedAt = now.UTC()
+	if maxCapWei != nil && spentWei != nil {
+		remain := big.NewInt(0).Sub(maxCapWei, spentWei)
+		if remain.Sign() < 0 {
+			remain.SetInt64(0)
+		}
+		r.CapRemainingWei = remain
+	}
+}
+
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func text(v fmt.Stringer, isNil bool) string {
+	if isNil {
+		return ""
+	}
+	return v.String()
+}
+
+// WriteCSV writes the entries, one row each
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	rows := [][]string{{
+		"tx_hash", "token_address", "to_address", "transferred_usdt", "token_price", "numerator_price", "denominator_price",
+		"eligible", "status", "reason", "refund_wei", "refund_usdt", "refund_tx_hash",
+	}}
+	for _, e := range r.Entries {
+		rows = append(rows, []string{
+			e.TxHash.String(),
+			e.Token.String(),
+			e.Recipient.String(),
+			text(e.TransferredUsdt, e.TransferredUsdt == nil),
+			text(e.TokenPrice, e.TokenPrice == nil),
+			text(e.NumeratorPrice, e.NumeratorPrice == nil),
+			text(e.DenominatorPrice, e.DenominatorPrice == nil),
+			strconv.FormatBool(e.Eligible),
+			string(e.Status),
+			e.Reason,
+			text(e.RefundWei, e.RefundWei == nil),
+			text(e.RefundUsdt, e.RefundUsdt == nil),
+			text(e.RefundTxHash, e.RefundTxHash == nil),
+		})
+	}
+	return cw.WriteAll(rows)
+}
+
+// WriteSummaryCSV writes the summary as key and value rows
+func (r *Report) WriteSummaryCSV(w io.Writer) error {
+	rows := [][]string{
+		{"key", "value"},
+		{"service", r.Service},
+		{"started_at", r.StartedAt.Format(time.RFC3339)},
+		{"finished_at", r.FinishedAt.Format(time.RFC3339)},
+		{"from_block", strconv.FormatUint(r.FromBlock, 10)},
+		{"to_block", strconv.FormatUint(r.ToBlock, 10)},
+		{"logs_seen", strconv.Itoa(r.LogsSeen)},
+		{"eligible", strconv.Itoa(r.Eligible)},
+		{"sent", strconv.Itoa(r.Sent)},
+		{"held", strconv.Itoa(r.Held)},
+		{"failed", strconv.Itoa(r.Failed)},
+		{"total_wei", r.TotalWei.String()},
+		{"cap_remaining_wei", text(r.CapRemainingWei, r.CapRemainingWei == nil)},
+		{"errors", strconv.Itoa(len(r.Errors))},
+	}
+
+	reasons := make([]string, 0, len(r.Skipped))
+	for reason := range r.Skipped {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		rows = append(rows, []string{"skipped:" + reason, strconv.Itoa(r.Skipped[reason])})
+	}
+
+	return csv.NewWriter(w).WriteAll(rows)
+}
+
+// Exporter writes the reports into a directory and posts them to a webhook
+type Exporter struct {
+	dir        string
+	json       bool
+	csv        bool
+	webhookURL string
+	client     *http.Client
+}
+
+// NewExporter returns an Exporter, a nil config returns a nil Exporter which exports nothing
+func NewExporter(conf *config.Report) (*Exporter, error) {
+	if conf == nil {
+		return nil, nil
+	}
+
+	if conf.Dir == "" && conf.WebhookURL == "" {
+		return nil, errors.New("report needs either dir or webhook_url")
+	}
+
+	e := &Exporter{dir: conf.Dir, webhookURL: conf.WebhookURL, client: &http.Client{Timeout: 10 * time.Second}}
+	if conf.TimeoutSec > 0 {
+		e.client.Timeout = time.Duration(conf.TimeoutSec) * time.Second
+	}
+
+	if len(conf.Formats) == 0 {
+		e.json, e.csv = true, true
+	}
+	for _, format := range conf.Formats {
+		switch format {
+		case "json":
+			e.json = true
+		case "csv":
+			e.csv = true
+		default:
+			return nil, fmt.Errorf("report unknown format:%q", format)
+		}
+	}
+
+	if e.dir != "" {
+		if err := os.MkdirAll(e.dir, 0o755); err != nil {
+			return nil, fmt.Errorf("report mkdir:%q failed:%w", e.dir, err)
+		}
+	}
+
+	return e, nil
+}
+
+// Export writes the report files and posts the json to the webhook, it returns the written file paths
+func (e *Exporter) Export(ctx context.Context, r *Report) ([]string, error) {
+	if e == nil {
+		return nil, nil
+	}
+
+	var paths []string
+	if e.dir != "" {
+		prefix := filepath.Join(e.dir, fmt.Sprintf("%s-%s", r.Service, r.StartedAt.Format("20060102T150405Z")))
+
+		write := func(path string, fn func(io.Writer) error) error {
+			var b bytes.Buffer
+			if err := fn(&b); err != nil {
+				return fmt.Errorf("report encoding:%q failed:%w", path, err)
+			}
+			if err := ioutil.WriteFile(path, b.Bytes(), 0o644); err != nil {
+				return fmt.Errorf("report write file:%q failed:%w", path, err)
+			}
+			paths = append(paths, path)
+			return nil
+		}
+
+		if e.json {
+			if err := write(prefix+".json", r.WriteJSON); err != nil {
+				return paths, err
+			}
+		}
+		if e.csv {
+			if err := write(prefix+".csv", r.WriteCSV); err != nil {
+				return paths, err
+			}
+			if err := write(prefix+"-summary.csv", r.WriteSummaryCSV); err != nil {
+				return paths, err
+			}
+		}
+	}
+
+	if e.webhookURL != "" {
+		var b bytes.Buffer
+		if err := r.WriteJSON(&b); err != nil {
+			return paths, fmt.Errorf("report json encoding failed:%w", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.webhookURL, &b)
+		if err != nil {
+			return paths, fmt.Errorf("report new request failed:%w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		rep, err := e.client.Do(req)
+		if err != nil {
+			return paths, fmt.Errorf("report posting webhook failed:%w", err)
+		}
+		defer rep.Body.Close()
+		_, _ = io.Copy(ioutil.Discard, rep.Body)
+
+		if rep.StatusCode/100 != 2 {
+			return paths, fmt.Errorf("report webhook responded status:%s", rep.Status)
+		}
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,108 @@
+package report_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/config"
+	"github.com/FindoraNetwork/refunder/report"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func newReport() *report.Report {
+	r := report.New("gasfee", time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC))
+	r.FromBlock, r.ToBlock = 100, 200
+
+	refundTxHash := common.HexToHash("0xbeef")
+	r.Add(&report.Entry{
+		TxHash:          common.HexToHash("0x1"),
+		Token:           common.HexToAddress("0xa"),
+		Recipient:       common.HexToAddress("0xb"),
+		TransferredUsdt: big.NewFloat(120),
+		TokenPrice:      big.NewFloat(1),
+		Eligible:        true,
+		RefundWei:       big.NewInt(300),
+		RefundUsdt:      big.NewFloat(0.5),
+		RefundTxHash:    &refundTxHash,
+		Status:          report.Sent,
+	})
+	r.Add(&report.Entry{TxHash: common.HexToHash("0x2"), Status: report.Skipped, Reason: "not_over_threshold"})
+	r.Add(&report.Entry{TxHash: common.HexToHash("0x3"), Status: report.Skipped, Reason: "not_over_threshold"})
+	r.Add(&report.Entry{TxHash: common.HexToHash("0x4"), Eligible: true, RefundWei: big.NewInt(50), Status: report.Held, Reason: "approval"})
+	r.Finish(time.Date(2022, 7, 1, 0, 1, 0, 0, time.UTC), big.NewInt(1000), big.NewInt(1200))
+	return r
+}
+
+func Test_Report(t *testing.T) {
+	r := newReport()
+	assert.Equal(t, 4, r.LogsSeen)
+	assert.Equal(t, 2, r.Eligible)
+	assert.Equal(t, 1, r.Sent)
+	assert.Equal(t, 1, r.Held)
+	assert.Equal(t, map[string]int{"not_over_threshold": 2}, r.Skipped)
+	assert.Equal(t, "300", r.TotalWei.String())
+	assert.Equal(t, "200", r.CapRemainingWei.String())
+
+	var b bytes.Buffer
+	assert.NoError(t, r.WriteCSV(&b))
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	assert.Len(t, lines, 5)
+	assert.Equal(t, "0x0000000000000000000000000000000000000000000000000000000000000001,"+
+		"0x000000000000000000000000000000000000000A,0x000000000000000000000000000000000000000b,"+
+		"120,1,,,true,sent,,300,0.5,0x000000000000000000000000000000000000000000000000000000000000beef", lines[1])
+
+	b.Reset()
+	assert.NoError(t, r.WriteSummaryCSV(&b))
+	assert.Contains(t, b.String(), "total_wei,300\n")
+	assert.Contains(t, b.String(), "cap_remaining_wei,200\n")
+	assert.Contains(t, b.String(), "skipped:not_over_threshold,2\n")
+}
+
+func Test_Exporter(t *testing.T) {
+	e, err := report.NewExporter(nil)
+	assert.NoError(t, err)
+	paths, err := e.Export(context.Background(), newReport())
+	assert.NoError(t, err)
+	assert.Nil(t, paths)
+
+	var posted map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&posted))
+	}))
+	defer srv.Close()
+
+	dir := filepath.Join(t.TempDir(), "reports")
+	e, err = report.NewExporter(&config.Report{Dir: dir, WebhookURL: srv.URL})
+	assert.NoError(t, err)
+
+	paths, err = e.Export(context.Background(), newReport())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "gasfee-20220701T000000Z.json"),
+		filepath.Join(dir, "gasfee-20220701T000000Z.csv"),
+		filepath.Join(dir, "gasfee-20220701T000000Z-summary.csv"),
+	}, paths)
+
+	b, err := ioutil.ReadFile(paths[0])
+	assert.NoError(t, err)
+	got := &report.Report{}
+	assert.NoError(t, json.Unmarshal(b, got))
+	assert.Equal(t, uint64(100), got.FromBlock)
+	assert.Len(t, got.Entries, 4)
+
+	assert.Equal(t, float64(4), posted["logs_seen"])
+
+	_, err = report.NewExporter(&config.Report{Dir: dir, Formats: []string{"xml"}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,243 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule tells the next run time strictly after the given time
+type Schedule interface {
+	Next(after time.Time) time.Time
+}
+
+// Daily runs every day at the HH:MM:SS of the at in UTC
+type Daily struct {
+	At time.Time
+}
+
+func (d *Daily) Next(after time.Time) time.Time {
+	after = after.UTC()
+	next := time.Date(after.Year(), after.Month(), after.Day(), d.At.Hour(), d.At.Minute(), d.At.Second(), 0, time.UTC)
+	if !next.After(after) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// Every runs in a fixed period
+type Every struct {
+	Period time.Duration
+}
+
+func (e *Every) Next(after time.Time) time.Time {
+	return after.Add(e.Period)
+}
+
+// Cron is a standard five fields cron expression "minute hour day-of-month month day-of-week" in a location
+// every field takes "*", numbers, ranges "a-b", steps "*/n" or "a-b/n", and lists of them joined by ","
+// the day-of-week is 0 to 7, both 0 and 7 are Sunday
+// the day-of-month and the day-of-week are matched as either of them if both are restricted, like the classic cron
+type Cron struct {
+	expr   string
+	loc    *time.Location
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// domAny and dowAny tell the fields are "*"
+	domAny bool
+	dowAny bool
+}
+
+// NewCron parses the expression, an empty timezone is UTC
+func NewCron(expr, timezone string) (*Cron, error) {
+	loc := time.UTC
+	if timezone != "" {
+		l, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("schedule loading timezone:%q failed:%w", timezone, err)
+		}
+		loc = l
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule cron:%q expecting 5 fields", expr)
+	}
+
+	c := &Cron{expr: expr, loc: loc, domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+	for i, f := range []struct {
+		bits     *uint64
+		min, max int
+	}{
+		{&c.minute, 0, 59},
+		{&c.hour, 0, 23},
+		{&c.dom, 1, 31},
+		{&c.month, 1, 12},
+		{&c.dow, 0, 7},
+	} {
+		bits, err := parseField(fields[i], f.min, f.max)
+		if err != nil {
+			return nil, fmt.Errorf("schedule cron:%q field:%d %w", expr, i+1, err)
+		}
+		*f.bits = bits
+	}
+
+	// 7 is Sunday too
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	return c, nil
+}
+
+func parseField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step:%q", part)
+			}
+			rng, step = part[:i], n
+		}
+
+		lo, hi := min, max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			bounds := strings.SplitN(rng, "-", 2)
+			a, err1 := strconv.Atoi(bounds[0])
+			b, err2 := strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("invalid range:%q", part)
+			}
+			lo, hi = a, b
+		default:
+			n, err := strconv.Atoi(rng)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value:%q", part)
+			}
+			lo, hi = n, n
+			if step > 1 {
+				hi = max
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("out of range:%q, expecting %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom, dow := has(c.dom, t.Day()), has(c.dow, int(t.Weekday()))
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the next matched minute after the time, a zero time if nothing matches in 5 years
+func (c *Cron) Next(after time.Time) time.Time {
+	t := after.In(c.loc).Truncate(time.Minute).Add(time.Minute)
+	// walking the wall clock, a skipped wall clock in the daylight saving change may not move forward by time.Date
+	// so it falls back to the next minute
+	forward := func(next time.Time) time.Time {
+		if next.After(t) {
+			return next
+		}
+		return t.Add(time.Minute)
+	}
+
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); {
+		switch {
+		case !has(c.month, int(t.Month())):
+			t = forward(time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.loc))
+		case !c.dayMatches(t):
+			t = forward(time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.loc))
+		case !has(c.hour, t.Hour()):
+			t = forward(time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, c.loc))
+		case !has(c.minute, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *Cron) String() string {
+	return fmt.Sprintf("%s (%s)", c.expr, c.loc)
+}
+
+// LastRun stores the time of the last run, for detecting the missed runs during a downtime
+type LastRun struct {
+	filepath string
+}
+
+// NewLastRun returns the LastRun, an empty filepath returns a nil LastRun which remembers nothing
+func NewLastRun(filepath string) *LastRun {
+	if filepath == "" {
+		return nil
+	}
+	return &LastRun{filepath: filepath}
+}
+
+// Get returns the last run time, a zero time if it never ran
+func (l *LastRun) Get() (time.Time, error) {
+	if l == nil {
+		return time.Time{}, nil
+	}
+
+	b, err := ioutil.ReadFile(l.filepath)
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("schedule read file:%q failed:%w", l.filepath, err)
+	}
+
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(string(b)))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("schedule parsing last run:%q failed:%w", l.filepath, err)
+	}
+	return t, nil
+}
+
+// Set stores the last run time
+func (l *LastRun) Set(t time.Time) error {
+	if l == nil {
+		return nil
+	}
+
+	if err := ioutil.WriteFile(l.filepath, []byte(t.UTC().Format(time.RFC3339)), 0o600); err != nil {
+		return fmt.Errorf("schedule write file:%q failed:%w", l.filepath, err)
+	}
+	return nil
+}
+
+// Missed returns the first scheduled time missed since the last run, a zero time if nothing missed
+func Missed(s Schedule, lastRun, now time.Time) time.Time {
+	if lastRun.IsZero() {
+		return time.Time{}
+	}
+	if next := s.Next(lastRun); !next.IsZero() && !next.After(now) {
+		return next
+	}
+	return time.Time{}
+}
@@ -0,0 +1,73 @@
+package schedule_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/schedule"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Cron(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.Parse(time.RFC3339, s)
+		assert.NoError(t, err)
+		return v
+	}
+
+	for _, tt := range []struct {
+		expr, timezone, after, want string
+	}{
+		{"*/15 * * * *", "", "2022-07-01T10:07:30Z", "2022-07-01T10:15:00Z"},
+		{"0 */6 * * *", "", "2022-07-01T18:00:00Z", "2022-07-02T00:00:00Z"},
+		{"30 9 * * 1-5", "", "2022-07-01T10:00:00Z", "2022-07-04T09:30:00Z"},
+		{"0 0 1 * *", "", "2022-12-15T00:00:00Z", "2023-01-01T00:00:00Z"},
+		{"0 0 * * 7", "", "2022-07-01T00:00:00Z", "2022-07-03T00:00:00Z"},
+		// either of the day fields
+		{"0 0 15 * 1", "", "2022-07-01T00:00:00Z", "2022-07-04T00:00:00Z"},
+		{"5,10 8 * * *", "Asia/Taipei", "2022-07-01T00:07:00Z", "2022-07-01T00:10:00Z"},
+		// the wall clock of the timezone across the daylight saving change
+		{"0 2 * * *", "America/New_York", "2022-03-12T08:00:00Z", "2022-03-14T06:00:00Z"},
+	} {
+		c, err := schedule.NewCron(tt.expr, tt.timezone)
+		assert.NoError(t, err, tt.expr)
+		assert.Equal(t, at(tt.want).Unix(), c.Next(at(tt.after)).Unix(), tt.expr)
+	}
+
+	for _, expr := range []string{"* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "a * * * *", "5-1 * * * *"} {
+		_, err := schedule.NewCron(expr, "")
+		assert.Error(t, err, expr)
+	}
+	_, err := schedule.NewCron("* * * * *", "Mars/Olympus")
+	assert.Error(t, err)
+}
+
+func Test_Missed(t *testing.T) {
+	now := time.Date(2022, 7, 3, 12, 0, 0, 0, time.UTC)
+	daily := &schedule.Daily{At: time.Date(0, 1, 1, 8, 0, 0, 0, time.UTC)}
+
+	assert.Equal(t, time.Date(2022, 7, 4, 8, 0, 0, 0, time.UTC), daily.Next(now))
+	assert.True(t, schedule.Missed(daily, time.Time{}, now).IsZero())
+	assert.True(t, schedule.Missed(daily, time.Date(2022, 7, 3, 8, 0, 0, 0, time.UTC), now).IsZero())
+	assert.Equal(t, time.Date(2022, 7, 2, 8, 0, 0, 0, time.UTC), schedule.Missed(daily, time.Date(2022, 7, 1, 9, 0, 0, 0, time.UTC), now))
+
+	every := &schedule.Every{Period: 10 * time.Minute}
+	assert.Equal(t, now.Add(-5*time.Minute), schedule.Missed(every, now.Add(-15*time.Minute), now))
+
+	l := schedule.NewLastRun("")
+	assert.NoError(t, l.Set(now))
+	got, err := l.Get()
+	assert.NoError(t, err)
+	assert.True(t, got.IsZero())
+
+	l = schedule.NewLastRun(filepath.Join(t.TempDir(), "last_run"))
+	got, err = l.Get()
+	assert.NoError(t, err)
+	assert.True(t, got.IsZero())
+	assert.NoError(t, l.Set(now))
+	got, err = l.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, now, got)
+}
@@ -0,0 +1,185 @@
+package signer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const defaultClefMethod = "account_signTransaction"
+
+// Clef asks an external signer speaking the Clef account_signTransaction
+// or the node eth_signTransaction JSON-RPC protocol
+type Clef struct {
+	client  *rpc.Client
+	address common.Address
+	method  string
+	timeout time.Duration
+}
+
+// sendTxArgs is the transaction arguments of the Clef and the eth_signTransaction protocol
+type sendTxArgs struct {
+	From     common.Address  `json:"from"`
+	To       *common.Address `json:"to,omitempty"`
+	Gas      hexutil.Uint64  `json:"gas"`
+	GasPrice *hexutil.Big    `json:"gasPrice"`
+	Value    *hexutil.Big    `json:"value"`
+	Nonce    hexutil.Uint64  `json:"nonce"`
+	Data     hexutil.Bytes   `json:"data"`
+	ChainID  *hexutil.Big    `json:"chainId,omitempty"`
+}
+
+// signTxResult is the result of the Clef and the eth_signTransaction protocol
+type signTxResult struct {
+	Raw hexutil.Bytes `json:"raw"`
+}
+
+// NewClef returns a Clef signer of the url, an empty method is "account_signTransaction"
+func NewClef(url string, address common.Address, method string, timeout time.Duration) (*Clef, error) {
+	client, err := rpc.DialHTTP(url)
+	if err != nil {
+		return nil, fmt.Errorf("signer clef dial url:%q failed:%w", url, err)
+	}
+
+	if method == "" {
+		method = defaultClefMethod
+	}
+
+	return &Clef{client: client, address: address, method: method, timeout: timeout}, nil
+}
+
+func (c *Clef) Address() common.Address {
+	return c.address
+}
+
+func (c *Clef) SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	args := &sendTxArgs{
+		From:     c.address,
+		To:       tx.To(),
+		Gas:      hexutil.Uint64(tx.Gas()),
+		GasPrice: (*hexutil.Big)(tx.GasPrice()),
+		Value:    (*hexutil.Big)(tx.Value()),
+		Nonce:    hexutil.Uint64(tx.Nonce()),
+		Data:     tx.Data(),
+	}
+	if chainID != nil {
+		args.ChainID = (*hexutil.Big)(chainID)
+	}
+
+	result := &signTxResult{}
+	if err := c.client.CallContext(ctx, result, c.method, args); err != nil {
+		return nil, fmt.Errorf("signer clef %s failed:%w", c.method, err)
+	}
+
+	signed := &types.Transaction{}
+	if err := signed.UnmarshalBinary(result.Raw); err != nil {
+		return nil, fmt.Errorf("signer clef decode raw transaction failed:%w", err)
+	}
+
+	if err := verify(c.address, tx, signed); err != nil {
+		return nil, err
+	}
+	return signed, nil
+}
+
+// Remote asks a generic remote http signing service
+//
+//	POST <url> {"address": <address>, "chain_id": <hex>, "tx": <hex unsigned transaction>}
+//	200 {"raw": <hex signed transaction>}
+type Remote struct {
+	url       string
+	address   common.Address
+	authToken string
+	client    *http.Client
+}
+
+type remoteRequest struct {
+	Address common.Address `json:"address"`
+	ChainID *hexutil.Big   `json:"chain_id"`
+	Tx      hexutil.Bytes  `json:"tx"`
+}
+
+type remoteResponse struct {
+	Raw   hexutil.Bytes `json:"raw"`
+	Error string        `json:"error"`
+}
+
+// NewRemote returns a Remote signer of the url, a non-empty authToken is sent as a bearer token
+func NewRemote(url string, address common.Address, authToken string, timeout time.Duration) *Remote {
+	return &Remote{
+		url:       url,
+		address:   address,
+		authToken: authToken,
+		client:    &http.Client{Timeout: timeout},
+	}
+}
+
+func (r *Remote) Address() common.Address {
+	return r.address
+}
+
+func (r *Remote) SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	unsigned, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("signer remote encode transaction failed:%w", err)
+	}
+
+	if chainID == nil {
+		chainID = big.NewInt(0)
+	}
+	body, err := json.Marshal(&remoteRequest{Address: r.address, ChainID: (*hexutil.Big)(chainID), Tx: unsigned})
+	if err != nil {
+		return nil, fmt.Errorf("signer remote json marshal failed:%w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("signer remote new request failed:%w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+r.authToken)
+	}
+
+	rep, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("signer remote request failed:%w", err)
+	}
+	defer rep.Body.Close()
+
+	b, err := ioutil.ReadAll(rep.Body)
+	if err != nil {
+		return nil, fmt.Errorf("signer remote read response failed:%w", err)
+	}
+
+	result := &remoteResponse{}
+	if err := json.Unmarshal(b, result); err != nil {
+		return nil, fmt.Errorf("signer remote json unmarshal failed:%w, status:%s", err, rep.Status)
+	}
+	if rep.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("signer remote responded status:%s, error:%s", rep.Status, result.Error)
+	}
+
+	signed := &types.Transaction{}
+	if err := signed.UnmarshalBinary(result.Raw); err != nil {
+		return nil, fmt.Errorf("signer remote decode raw transaction failed:%w", err)
+	}
+
+	if err := verify(r.address, tx, signed); err != nil {
+		return nil, err
+	}
+	return signed, nil
+}
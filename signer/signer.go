@@ -0,0 +1,151 @@
+package signer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/config"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Signer signs the payout transactions of a founding source
+type Signer interface {
+	// Address is the founding source address
+	Address() common.Address
+	// SignTx returns the signed transaction for the chain
+	SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+}
+
+const defaultTimeout = 30 * time.Second
+
+// New returns the Signer of the config, a nil config signs with the hex private key
+func New(conf *config.Signer, privateKey string) (Signer, error) {
+	if conf == nil {
+		return NewKey(privateKey)
+	}
+
+	timeout := defaultTimeout
+	if conf.TimeoutSec > 0 {
+		timeout = time.Duration(conf.TimeoutSec) * time.Second
+	}
+
+	switch conf.Kind {
+	case "", config.KeySigner:
+		return NewKey(privateKey)
+	case config.KeystoreSigner:
+		passphrase := conf.Passphrase
+		if passphrase == "" && conf.PassphraseFilepath != "" {
+			var err error
+			if passphrase, err = ReadPassphrase(conf.PassphraseFilepath); err != nil {
+				return nil, err
+			}
+		}
+		return NewKeystore(conf.KeystoreFilepath, passphrase)
+	case config.ClefSigner:
+		if conf.URL == "" || !common.IsHexAddress(conf.Address) {
+			return nil, errors.New("signer clef needs both url and address")
+		}
+		return NewClef(conf.URL, common.HexToAddress(conf.Address), conf.Method, timeout)
+	case config.RemoteSigner:
+		if conf.URL == "" || !common.IsHexAddress(conf.Address) {
+			return nil, errors.New("signer remote needs both url and address")
+		}
+		return NewRemote(conf.URL, common.HexToAddress(conf.Address), conf.AuthToken, timeout), nil
+	default:
+		return nil, fmt.Errorf("signer unknown kind:%q", conf.Kind)
+	}
+}
+
+// Key signs with an in-memory private key
+type Key struct {
+	key     *ecdsa.PrivateKey
+	address common.Address
+}
+
+// NewKey returns a Key of the hex private key
+func NewKey(privateKey string) (*Key, error) {
+	key, err := crypto.HexToECDSA(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("signer crypto.HexToECDSA private key failed:%w", err)
+	}
+	return FromECDSA(key), nil
+}
+
+// FromECDSA returns a Key of the private key
+func FromECDSA(key *ecdsa.PrivateKey) *Key {
+	return &Key{key: key, address: crypto.PubkeyToAddress(key.PublicKey)}
+}
+
+// NewKeystore decrypts the go-ethereum keystore file with the passphrase into a Key
+func NewKeystore(filepath, passphrase string) (*Key, error) {
+	if filepath == "" {
+		return nil, errors.New("signer keystore_filepath is a MUST filled field")
+	}
+
+	b, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("signer read keystore file:%q failed:%w", filepath, err)
+	}
+
+	k, err := keystore.DecryptKey(b, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("signer decrypt keystore file:%q failed:%w", filepath, err)
+	}
+
+	return FromECDSA(k.PrivateKey), nil
+}
+
+// ReadPassphrase reads the passphrase file, the trailing line breaks are trimmed
+func ReadPassphrase(filepath string) (string, error) {
+	b, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return "", fmt.Errorf("signer read passphrase file:%q failed:%w", filepath, err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+func (k *Key) Address() common.Address {
+	return k.address
+}
+
+func (k *Key) SignTx(_ context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	signed, err := types.SignTx(tx, types.NewEIP155Signer(chainID), k.key)
+	if err != nil {
+		return nil, fmt.Errorf("signer SignTx failed:%w", err)
+	}
+	return signed, nil
+}
+
+// verify makes sure the remote signer signs exactly the transaction asked, by the address expected
+func verify(address common.Address, tx, signed *types.Transaction) error {
+	switch {
+	case signed.Nonce() != tx.Nonce(),
+		signed.Gas() != tx.Gas(),
+		signed.GasPrice().Cmp(tx.GasPrice()) != 0,
+		signed.Value().Cmp(tx.Value()) != 0,
+		(signed.To() == nil) != (tx.To() == nil),
+		signed.To() != nil && *signed.To() != *tx.To(),
+		string(signed.Data()) != string(tx.Data()):
+		return fmt.Errorf("signer signed a different transaction, tx_hash:%s", signed.Hash())
+	}
+
+	sender, err := types.Sender(types.LatestSignerForChainID(signed.ChainId()), signed)
+	if err != nil {
+		return fmt.Errorf("signer recover sender failed:%w", err)
+	}
+	if sender != address {
+		return fmt.Errorf("signer signed by:%s, expecting:%s", sender, address)
+	}
+
+	return nil
+}
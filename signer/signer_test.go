@@ -0,0 +1,205 @@
+package signer_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/config"
+	"github.com/FindoraNetwork/refunder/signer"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+var chainID = big.NewInt(2153)
+
+func newTx() *types.Transaction {
+	to := common.HexToAddress("0x1")
+	return types.NewTx(&types.LegacyTx{
+		Nonce:    7,
+		To:       &to,
+		Value:    big.NewInt(1000),
+		Gas:      21000,
+		GasPrice: big.NewInt(10),
+	})
+}
+
+func assertSigned(t *testing.T, s signer.Signer, address common.Address) {
+	signed, err := s.SignTx(context.Background(), newTx(), chainID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, signed) {
+		sender, err := types.Sender(types.NewEIP155Signer(chainID), signed)
+		assert.NoError(t, err)
+		assert.Equal(t, address, sender)
+		assert.Equal(t, uint64(7), signed.Nonce())
+	}
+}
+
+func Test_Key(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+
+	s, err := signer.New(nil, strings.TrimPrefix(hexutil.Encode(crypto.FromECDSA(key)), "0x"))
+	assert.NoError(t, err)
+	assert.Equal(t, crypto.PubkeyToAddress(key.PublicKey), s.Address())
+	assertSigned(t, s, s.Address())
+
+	_, err = signer.New(&config.Signer{Kind: config.KeySigner}, "not hex")
+	assert.Error(t, err)
+
+	_, err = signer.New(&config.Signer{Kind: "unknown"}, "")
+	assert.Error(t, err)
+}
+
+func Test_Keystore(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+
+	b, err := keystore.EncryptKey(&keystore.Key{
+		Id:         uuid.New(),
+		Address:    crypto.PubkeyToAddress(key.PublicKey),
+		PrivateKey: key,
+	}, "secret", keystore.LightScryptN, keystore.LightScryptP)
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "key.json")
+	assert.NoError(t, ioutil.WriteFile(path, b, 0600))
+
+	s, err := signer.New(&config.Signer{Kind: config.KeystoreSigner, KeystoreFilepath: path, Passphrase: "secret"}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, crypto.PubkeyToAddress(key.PublicKey), s.Address())
+	assertSigned(t, s, s.Address())
+
+	_, err = signer.New(&config.Signer{Kind: config.KeystoreSigner, KeystoreFilepath: path, Passphrase: "wrong"}, "")
+	assert.Error(t, err)
+}
+
+type clefArgs struct {
+	From     common.Address  `json:"from"`
+	To       *common.Address `json:"to"`
+	Gas      hexutil.Uint64  `json:"gas"`
+	GasPrice *hexutil.Big    `json:"gasPrice"`
+	Value    *hexutil.Big    `json:"value"`
+	Nonce    hexutil.Uint64  `json:"nonce"`
+	Data     hexutil.Bytes   `json:"data"`
+	ChainID  *hexutil.Big    `json:"chainId"`
+}
+
+type clefResult struct {
+	Raw hexutil.Bytes `json:"raw"`
+}
+
+// clefStub signs the asked transaction with its key, tamper changes the value before signing
+type clefStub struct {
+	key    *ecdsa.PrivateKey
+	tamper bool
+}
+
+func (c *clefStub) SignTransaction(args clefArgs) (*clefResult, error) {
+	value := args.Value.ToInt()
+	if c.tamper {
+		value = big.NewInt(0).Add(value, big.NewInt(1))
+	}
+
+	tx, err := types.SignTx(types.NewTx(&types.LegacyTx{
+		Nonce:    uint64(args.Nonce),
+		To:       args.To,
+		Value:    value,
+		Gas:      uint64(args.Gas),
+		GasPrice: args.GasPrice.ToInt(),
+		Data:     args.Data,
+	}), types.NewEIP155Signer(args.ChainID.ToInt()), c.key)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := tx.MarshalBinary()
+	return &clefResult{Raw: raw}, err
+}
+
+func Test_Clef(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	address := crypto.PubkeyToAddress(key.PublicKey)
+
+	srv := rpc.NewServer()
+	assert.NoError(t, srv.RegisterName("account", &clefStub{key: key}))
+	assert.NoError(t, srv.RegisterName("eth", &clefStub{key: key, tamper: true}))
+	stub := httptest.NewServer(srv)
+	defer stub.Close()
+
+	s, err := signer.New(&config.Signer{Kind: config.ClefSigner, URL: stub.URL, Address: address.String()}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, address, s.Address())
+	assertSigned(t, s, address)
+
+	// signed by another key
+	s, err = signer.NewClef(stub.URL, common.HexToAddress("0x2"), "", time.Second)
+	assert.NoError(t, err)
+	_, err = s.SignTx(context.Background(), newTx(), chainID)
+	assert.Error(t, err)
+
+	// signed a different transaction
+	s, err = signer.NewClef(stub.URL, address, "eth_signTransaction", time.Second)
+	assert.NoError(t, err)
+	_, err = s.SignTx(context.Background(), newTx(), chainID)
+	assert.Error(t, err)
+
+	_, err = signer.New(&config.Signer{Kind: config.ClefSigner, URL: stub.URL}, "")
+	assert.Error(t, err)
+}
+
+func Test_Remote(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	assert.NoError(t, err)
+	address := crypto.PubkeyToAddress(key.PublicKey)
+
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+			return
+		}
+
+		req := struct {
+			Address common.Address `json:"address"`
+			ChainID *hexutil.Big   `json:"chain_id"`
+			Tx      hexutil.Bytes  `json:"tx"`
+		}{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, address, req.Address)
+
+		tx := &types.Transaction{}
+		assert.NoError(t, tx.UnmarshalBinary(req.Tx))
+		signed, err := types.SignTx(tx, types.NewEIP155Signer(req.ChainID.ToInt()), key)
+		assert.NoError(t, err)
+		raw, err := signed.MarshalBinary()
+		assert.NoError(t, err)
+
+		_ = json.NewEncoder(w).Encode(map[string]hexutil.Bytes{"raw": raw})
+	}))
+	defer stub.Close()
+
+	s, err := signer.New(&config.Signer{Kind: config.RemoteSigner, URL: stub.URL, Address: address.String(), AuthToken: "token"}, "")
+	assert.NoError(t, err)
+	assertSigned(t, s, address)
+
+	s = signer.NewRemote(stub.URL, address, "wrong", time.Second)
+	_, err = s.SignTx(context.Background(), newTx(), chainID)
+	assert.Error(t, err)
+}
@@ -0,0 +1,140 @@
+package sybil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/config"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Observation is an eligible payout waiting for the detection
+type Observation struct {
+	At        time.Time      `json:"at"`
+	Source    common.Address `json:"source"`
+	Bridge    common.Address `json:"bridge"`
+	TxHash    common.Hash    `json:"tx_hash"`
+	Token     common.Address `json:"token"`
+	Recipient common.Address `json:"recipient"`
+}
+
+// Path is the funding path of the observation
+func (o *Observation) Path() string {
+	return fmt.Sprintf("%s>%s>%s", o.Source, o.Bridge, o.Token)
+}
+
+// Detector tracks the recipients in a rolling window and flags the suspicious ones
+type Detector struct {
+	mux sync.Mutex
+
+	window                 time.Duration
+	maxRecipientsPerSource int
+	maxRecipientsPerTx     int
+	maxRecipientsPerPath   int
+	maxRecipientsPerWindow int
+	filepath               string
+
+	observations []*Observation
+}
+
+// New returns a Detector and loads the previous observations from the state file
+// a nil config returns a nil Detector which flags nothing
+func New(conf *config.SybilDetection) (*Detector, error) {
+	if conf == nil {
+		return nil, nil
+	}
+
+	if conf.WindowSec == 0 || conf.StateFilepath == "" {
+		return nil, errors.New("sybil detection needs both window_sec and state_filepath")
+	}
+
+	d := &Detector{
+		window:                 time.Duration(conf.WindowSec) * time.Second,
+		maxRecipientsPerSource: conf.MaxRecipientsPerSource,
+		maxRecipientsPerTx:     conf.MaxRecipientsPerTx,
+		maxRecipientsPerPath:   conf.MaxRecipientsPerPath,
+		maxRecipientsPerWindow: conf.MaxRecipientsPerWindow,
+		filepath:               conf.StateFilepath,
+	}
+
+	b, err := ioutil.ReadFile(d.filepath)
+	switch {
+	case os.IsNotExist(err):
+		// first time start up
+	case err != nil:
+		return nil, fmt.Errorf("sybil read file:%q failed:%w", d.filepath, err)
+	case len(b) > 0:
+		if err := json.Unmarshal(b, &d.observations); err != nil {
+			return nil, fmt.Errorf("sybil json unmarshal state failed:%w", err)
+		}
+	}
+
+	return d, nil
+}
+
+// recipients counts the distinct recipients in the window matching the filter, including the new one
+func (d *Detector) recipients(since time.Time, o *Observation, match func(*Observation) bool) int {
+	set := map[common.Address]struct{}{o.Recipient: {}}
+	for _, prev := range d.observations {
+		if prev.At.After(since) && match(prev) {
+			set[prev.Recipient] = struct{}{}
+		}
+	}
+	return len(set)
+}
+
+// Observe records the observation and returns the reasons if it's suspicious, nil means it's fine
+func (d *Detector) Observe(o *Observation) ([]string, error) {
+	if d == nil {
+		return nil, nil
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	since := o.At.Add(-d.window)
+	var reasons []string
+
+	check := func(name string, max int, match func(*Observation) bool) {
+		if max <= 0 {
+			return
+		}
+		if n := d.recipients(since, o, match); n > max {
+			reasons = append(reasons, fmt.Sprintf("%s:%d > %d", name, n, max))
+		}
+	}
+
+	check("recipients_per_source", d.maxRecipientsPerSource, func(prev *Observation) bool {
+		return prev.Source == o.Source
+	})
+	check("recipients_per_tx", d.maxRecipientsPerTx, func(prev *Observation) bool {
+		return prev.TxHash == o.TxHash
+	})
+	check("recipients_per_path", d.maxRecipientsPerPath, func(prev *Observation) bool {
+		return prev.Path() == o.Path()
+	})
+	check("recipients_per_window", d.maxRecipientsPerWindow, func(*Observation) bool {
+		return true
+	})
+
+	d.observations = append(d.observations, o)
+	i := sort.Search(len(d.observations), func(i int) bool { return d.observations[i].At.After(since) })
+	d.observations = d.observations[i:]
+
+	b, err := json.Marshal(d.observations)
+	if err != nil {
+		return nil, fmt.Errorf("sybil json marshal state failed:%w", err)
+	}
+	if err := ioutil.WriteFile(d.filepath, b, 0o600); err != nil {
+		return nil, fmt.Errorf("sybil write file:%q failed:%w", d.filepath, err)
+	}
+
+	return reasons, nil
+}
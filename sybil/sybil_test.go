@@ -0,0 +1,59 @@
+package sybil_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/config"
+	"github.com/FindoraNetwork/refunder/sybil"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Detector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "Test_Detector_*")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	conf := &config.SybilDetection{
+		WindowSec:              3600,
+		MaxRecipientsPerSource: 2,
+		MaxRecipientsPerTx:     1,
+		StateFilepath:          filepath.Join(dir, "sybil.json"),
+	}
+	d, err := sybil.New(conf)
+	assert.NoError(t, err)
+
+	now := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+	farmer := common.HexToAddress("0xfa")
+	observe := func(at time.Time, source common.Address, tx, recipient string) []string {
+		reasons, err := d.Observe(&sybil.Observation{
+			At:        at,
+			Source:    source,
+			TxHash:    common.HexToHash(tx),
+			Recipient: common.HexToAddress(recipient),
+		})
+		assert.NoError(t, err)
+		return reasons
+	}
+
+	assert.Nil(t, observe(now, farmer, "0x01", "0x11"))
+	assert.Nil(t, observe(now, farmer, "0x02", "0x12"))
+	// a bridge transaction split into two recipients
+	assert.Equal(t, []string{"recipients_per_tx:2 > 1"}, observe(now, common.HexToAddress("0xbb"), "0x02", "0x13"))
+
+	// the observations survive a restart
+	d, err = sybil.New(conf)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"recipients_per_source:3 > 2"}, observe(now, farmer, "0x03", "0x14"))
+
+	// out of the window
+	assert.Nil(t, observe(now.Add(2*time.Hour), farmer, "0x04", "0x15"))
+
+	_, err = sybil.New(&config.SybilDetection{WindowSec: 3600})
+	assert.Error(t, err)
+}
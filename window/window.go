@@ -0,0 +1,101 @@
+package window
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/config"
+)
+
+// Position is where a block and a time are, relative to a Window
+type Position int
+
+const (
+	Before = Position(iota)
+	Within
+	After
+)
+
+func (p Position) String() string {
+	switch p {
+	case Before:
+		return "before"
+	case Within:
+		return "within"
+	default:
+		return "after"
+	}
+}
+
+// Window is an activation window bounded by the timestamps and/or the block numbers, every zero bound is open
+type Window struct {
+	startAt    time.Time
+	endAt      time.Time
+	startBlock uint64
+	endBlock   uint64
+}
+
+// New returns the Window, a nil config returns a nil Window which is always open
+func New(conf *config.Window) *Window {
+	if conf == nil {
+		return nil
+	}
+	return &Window{startAt: conf.StartAt, endAt: conf.EndAt, startBlock: conf.StartBlock, endBlock: conf.EndBlock}
+}
+
+// At returns the position of the block at the time, the end bounds take the precedence
+func (w *Window) At(block uint64, now time.Time) Position {
+	if w == nil {
+		return Within
+	}
+	if (w.endBlock > 0 && block > w.endBlock) || (!w.endAt.IsZero() && !now.Before(w.endAt)) {
+		return After
+	}
+	if (w.startBlock > 0 && block < w.startBlock) || (!w.startAt.IsZero() && now.Before(w.startAt)) {
+		return Before
+	}
+	return Within
+}
+
+// HasTime tells the window is bounded by any timestamp, so the callers know whether the time matters
+func (w *Window) HasTime() bool {
+	return w != nil && (!w.startAt.IsZero() || !w.endAt.IsZero())
+}
+
+// EndAt returns the end time, a zero time means no time bound
+func (w *Window) EndAt() time.Time {
+	if w == nil {
+		return time.Time{}
+	}
+	return w.endAt
+}
+
+// Ended tells the window is closed for good at the latest block and the time
+func (w *Window) Ended(latestBlock uint64, now time.Time) bool {
+	return w.At(latestBlock, now) == After
+}
+
+func (w *Window) String() string {
+	if w == nil {
+		return "always"
+	}
+
+	var bounds []string
+	if !w.startAt.IsZero() {
+		bounds = append(bounds, "start_at:"+w.startAt.UTC().Format(time.RFC3339))
+	}
+	if !w.endAt.IsZero() {
+		bounds = append(bounds, "end_at:"+w.endAt.UTC().Format(time.RFC3339))
+	}
+	if w.startBlock > 0 {
+		bounds = append(bounds, fmt.Sprintf("start_block:%d", w.startBlock))
+	}
+	if w.endBlock > 0 {
+		bounds = append(bounds, fmt.Sprintf("end_block:%d", w.endBlock))
+	}
+	if len(bounds) == 0 {
+		return "always"
+	}
+	return strings.Join(bounds, ", ")
+}
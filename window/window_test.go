@@ -0,0 +1,42 @@
+package window_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FindoraNetwork/refunder/config"
+	"github.com/FindoraNetwork/refunder/window"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Window(t *testing.T) {
+	var w *window.Window
+	assert.Equal(t, window.Within, w.At(0, time.Now()))
+	assert.False(t, w.Ended(1<<62, time.Now()))
+	assert.Equal(t, "always", w.String())
+	assert.False(t, w.HasTime())
+
+	day := func(d int) time.Time { return time.Date(2022, 7, d, 0, 0, 0, 0, time.UTC) }
+
+	w = window.New(&config.Window{StartAt: day(10), EndAt: day(20), StartBlock: 100, EndBlock: 200})
+	assert.Equal(t, window.Before, w.At(150, day(9)))
+	assert.Equal(t, window.Before, w.At(99, day(15)))
+	assert.Equal(t, window.Within, w.At(100, day(10)))
+	assert.Equal(t, window.Within, w.At(200, day(15)))
+	assert.Equal(t, window.After, w.At(201, day(15)))
+	// the end time is exclusive
+	assert.Equal(t, window.After, w.At(150, day(20)))
+	// the end bounds take the precedence
+	assert.Equal(t, window.After, w.At(50, day(21)))
+	assert.True(t, w.Ended(201, day(11)))
+	assert.Equal(t, "start_at:2022-07-10T00:00:00Z, end_at:2022-07-20T00:00:00Z, start_block:100, end_block:200", w.String())
+
+	assert.True(t, w.HasTime())
+	assert.Equal(t, day(20), w.EndAt())
+
+	w = window.New(&config.Window{StartBlock: 100})
+	assert.False(t, w.HasTime())
+	assert.Equal(t, window.Within, w.At(1<<62, day(1)))
+	assert.Equal(t, "start_block:100", w.String())
+}